@@ -18,7 +18,7 @@ func (a *accountJsTieredLimits) Add(tier int8) (JetStreamLimits, error) {
 		return nil, err
 	}
 	if exists != nil {
-		return nil, fmt.Errorf("tier %d already exists", tier)
+		return nil, fmt.Errorf("tier %d: %w", tier, ErrAlreadyExists)
 	}
 	if len(a.data.Claim.Limits.JetStreamTieredLimits) == 0 {
 		a.data.Claim.Limits.JetStreamTieredLimits = make(map[string]jwt.JetStreamLimits)
@@ -37,11 +37,12 @@ func (a *accountJsTieredLimits) Delete(tier int8) (bool, error) {
 		ok = true
 	} else {
 		k := fmt.Sprintf("R%d", tier)
-		if _, ok = a.data.Claim.Limits.JetStreamTieredLimits[k]; ok {
-			delete(a.data.Claim.Limits.JetStreamTieredLimits, k)
-			if len(a.data.Claim.Limits.JetStreamTieredLimits) == 0 {
-				a.data.Claim.Limits.JetStreamTieredLimits = nil
-			}
+		if _, ok = a.data.Claim.Limits.JetStreamTieredLimits[k]; !ok {
+			return false, fmt.Errorf("tier %d: %w", tier, ErrNotFound)
+		}
+		delete(a.data.Claim.Limits.JetStreamTieredLimits, k)
+		if len(a.data.Claim.Limits.JetStreamTieredLimits) == 0 {
+			a.data.Claim.Limits.JetStreamTieredLimits = nil
 		}
 	}
 	if err := a.data.update(); err != nil {
@@ -78,7 +79,7 @@ func (l *jsLimits) limit() (*jwt.JetStreamLimits, error) {
 	}
 	lim, ok := l.limits.data.Claim.Limits.JetStreamTieredLimits[fmt.Sprintf("R%d", l.tier)]
 	if !ok {
-		return nil, fmt.Errorf("limit not found for tier %d", l.tier)
+		return nil, fmt.Errorf("limit for tier %d: %w", l.tier, ErrNotFound)
 	}
 	l.lim = &lim
 	return l.lim, nil
@@ -221,7 +222,7 @@ func (l *jsLimits) SetUnlimited() error {
 
 func (l *jsLimits) checkDeleted() error {
 	if l.tier == -1 {
-		return fmt.Errorf("limit deleted")
+		return fmt.Errorf("limit deleted: %w", ErrNotFound)
 	}
 	return nil
 }
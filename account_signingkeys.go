@@ -19,12 +19,15 @@ func (as *accountSigningKeys) Add() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	as.data.AccountSigningKeys = append(as.data.AccountSigningKeys, k)
+	as.data.AccountSigningKeys = as.data.signingKeys.append(as.data.AccountSigningKeys, k)
 	as.data.Operator.AddedKeys = append(as.data.Operator.AddedKeys, k)
 	return k.Public, nil
 }
 
 func (as *accountSigningKeys) AddScope(role string) (ScopeLimits, error) {
+	if as.GetScopeByRole(role) != nil {
+		return nil, alreadyExists("scope", role)
+	}
 	k, err := KeyFor(nkeys.PrefixByteAccount)
 	if err != nil {
 		return nil, err
@@ -37,7 +40,7 @@ func (as *accountSigningKeys) AddScope(role string) (ScopeLimits, error) {
 		return nil, err
 	}
 	as.data.Operator.AddedKeys = append(as.data.Operator.AddedKeys, k)
-	as.data.AccountSigningKeys = append(as.data.AccountSigningKeys, k)
+	as.data.AccountSigningKeys = as.data.signingKeys.append(as.data.AccountSigningKeys, k)
 	return toScopeLimits(as.data, conf), nil
 }
 
@@ -64,11 +67,15 @@ func (as *accountSigningKeys) GetScopeByRole(role string) ScopeLimits {
 
 func (as *accountSigningKeys) Delete(key string) (bool, error) {
 	_, ok := as.data.Claim.SigningKeys[key]
-	if ok {
-		delete(as.data.Claim.SigningKeys, key)
-		as.data.Operator.DeletedKeys = append(as.data.Operator.DeletedKeys, key)
+	if !ok {
+		return false, keyNotFound(key)
+	}
+	delete(as.data.Claim.SigningKeys, key)
+	as.data.Operator.DeletedKeys = append(as.data.Operator.DeletedKeys, key)
+	if i := as.data.signingKeys.find(as.data.AccountSigningKeys, key); i != -1 {
+		as.data.AccountSigningKeys = as.data.signingKeys.remove(as.data.AccountSigningKeys, i)
 	}
-	err := as.data.Operator.update()
+	err := as.data.update()
 	return ok, err
 }
 
@@ -94,6 +101,8 @@ func (as *accountSigningKeys) Rotate(key string) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		as.data.Operator.AddedKeys = append(as.data.Operator.AddedKeys, k)
+		as.data.AccountSigningKeys = as.data.signingKeys.append(as.data.AccountSigningKeys, k)
 		for _, u := range as.data.UserDatas {
 			if u.Claim.Issuer == key {
 				if err := u.issue(k); err != nil {
@@ -103,5 +112,5 @@ func (as *accountSigningKeys) Rotate(key string) (string, error) {
 		}
 		return k.Public, nil
 	}
-	return "", nil
+	return "", keyNotFound(key)
 }
@@ -1,7 +1,6 @@
 package authb
 
 import (
-	"errors"
 	"github.com/nats-io/jwt/v2"
 )
 
@@ -49,6 +48,9 @@ func (a *AccountData) update() error {
 }
 
 func (a *AccountData) SetExpiry(exp int64) error {
+	if err := checkValidity(a.Claim.NotBefore, exp); err != nil {
+		return err
+	}
 	a.Claim.Expires = exp
 	return a.update()
 }
@@ -57,6 +59,18 @@ func (a *AccountData) Expiry() int64 {
 	return a.Claim.Expires
 }
 
+func (a *AccountData) SetNotBefore(nbf int64) error {
+	if err := checkValidity(nbf, a.Claim.Expires); err != nil {
+		return err
+	}
+	a.Claim.NotBefore = nbf
+	return a.update()
+}
+
+func (a *AccountData) NotBefore() int64 {
+	return a.Claim.NotBefore
+}
+
 func (a *AccountData) Users() Users {
 	return &UsersImpl{accountData: a}
 }
@@ -65,12 +79,10 @@ func (a *AccountData) getKey(key string) (*Key, bool, error) {
 	if key == a.Key.Public {
 		return a.Key, false, nil
 	}
-	for _, k := range a.AccountSigningKeys {
-		if k.Public == key {
-			return k, true, nil
-		}
+	if idx := a.signingKeys.find(a.AccountSigningKeys, key); idx != -1 {
+		return a.AccountSigningKeys[idx], true, nil
 	}
-	return nil, false, errors.New("key not found")
+	return nil, false, keyNotFound(key)
 }
 
 func (a *AccountData) Limits() AccountLimits {
@@ -84,3 +96,27 @@ func (a *AccountData) Exports() Exports {
 func (a *AccountData) Imports() Imports {
 	panic("not implemented")
 }
+
+func (a *AccountData) SetExports(exports jwt.Exports) error {
+	a.Claim.Exports = exports
+	return a.update()
+}
+
+func (a *AccountData) SetImports(imports jwt.Imports) error {
+	a.Claim.Imports = imports
+	return a.update()
+}
+
+func (a *AccountData) SetExternalAuthorization(users []string, accounts []string, xkey string) error {
+	a.Claim.Authorization = jwt.ExternalAuthorization{
+		AuthUsers:       users,
+		AllowedAccounts: accounts,
+		XKey:            xkey,
+	}
+	return a.update()
+}
+
+func (a *AccountData) ExternalAuthorization() ([]string, []string, string) {
+	ea := a.Claim.Authorization
+	return ea.AuthUsers, ea.AllowedAccounts, ea.XKey
+}
@@ -0,0 +1,266 @@
+// Package accountserver provides an http.Handler that serves the account
+// JWTs of an operator using the nats account server protocol, so it can be
+// advertised with Operator.SetAccountServerURL and used by servers with a
+// URL account resolver.
+package accountserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// BasePath is the path prefix of the protocol
+	BasePath = "/jwt/v1"
+	// AccountsPath is the path of the account JWTs, servers resolve accounts
+	// by appending the account public key
+	AccountsPath = BasePath + "/accounts/"
+	// OperatorPath is the path of the operator JWT
+	OperatorPath = BasePath + "/operator"
+	// HelpPath is the path of the help text
+	HelpPath = BasePath + "/help"
+
+	jwtContentType = "application/jwt"
+	// maxJwtSize is the largest JWT accepted in an update
+	maxJwtSize = 1 << 20
+)
+
+// Options configures the Handler
+type Options struct {
+	// AllowUpdates enables storing account JWTs posted to the server
+	AllowUpdates bool
+}
+
+// Handler serves the account JWTs of an operator. Updates are validated
+// against the operator's keys and stored through the AuthProvider of the Auth.
+// Updates reload the Auth, so it should not be used to make other changes.
+type Handler struct {
+	mu       sync.RWMutex
+	auth     authb.Auth
+	operator string
+	opts     Options
+	mux      *http.ServeMux
+}
+
+// NewHandler creates a Handler for the operator with the specified name
+// or public key
+func NewHandler(auth authb.Auth, operator string, opts Options) (*Handler, error) {
+	if auth.Operators().Get(operator) == nil {
+		return nil, fmt.Errorf("operator %q not found", operator)
+	}
+	h := &Handler{auth: auth, operator: operator, opts: opts, mux: http.NewServeMux()}
+	h.mux.HandleFunc(HelpPath, h.help)
+	h.mux.HandleFunc(OperatorPath, h.getOperator)
+	h.mux.HandleFunc(AccountsPath, h.account)
+	return h, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Reload reloads the Auth, so that changes committed by other processes
+// are served
+func (h *Handler) Reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.auth.Reload()
+}
+
+func (h *Handler) getOperatorData() (*authb.OperatorData, error) {
+	o := h.auth.Operators().Get(h.operator)
+	if o == nil {
+		return nil, fmt.Errorf("operator %q not found", h.operator)
+	}
+	return o.(*authb.OperatorData), nil
+}
+
+func (h *Handler) help(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = fmt.Fprintf(w, "GET %s - returns the operator JWT\n", OperatorPath)
+	_, _ = fmt.Fprintf(w, "GET %s<pubkey> - returns the account JWT (?decode=true, ?text=true)\n", AccountsPath)
+	if h.opts.AllowUpdates {
+		_, _ = fmt.Fprintf(w, "POST %s<pubkey> - updates the account JWT\n", AccountsPath)
+	}
+}
+
+func (h *Handler) getOperator(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	o, err := h.getOperatorData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJwt(w, r, o.Token, o.Claim.ID, o.Claim)
+}
+
+func (h *Handler) account(w http.ResponseWriter, r *http.Request) {
+	pk := strings.TrimPrefix(r.URL.Path, AccountsPath)
+	if pk == "" && r.Method == http.MethodGet {
+		// servers check that the resolver URL is reachable on startup
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !nkeys.IsValidPublicAccountKey(pk) {
+		http.Error(w, "invalid account public key", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		h.getAccount(w, r, pk)
+	case http.MethodPost:
+		if !h.opts.AllowUpdates {
+			http.Error(w, "updates are not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.updateAccount(w, r, pk)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) getAccount(w http.ResponseWriter, r *http.Request, pk string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	o, err := h.getOperatorData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a := o.Get(pk)
+	if a == nil {
+		http.Error(w, "account not found", http.StatusNotFound)
+		return
+	}
+	ad := a.(*authb.AccountData)
+	writeJwt(w, r, ad.Token, ad.Claim.ID, ad.Claim)
+}
+
+// writeJwt writes the token, or its decoded claims if requested
+func writeJwt(w http.ResponseWriter, r *http.Request, token string, id string, claims any) {
+	etag := fmt.Sprintf("%q", id)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	q := r.URL.Query()
+	switch {
+	case q.Get("decode") == "true":
+		d, err := json.MarshalIndent(claims, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(d)
+	case q.Get("text") == "true":
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, token)
+	default:
+		w.Header().Set("Content-Type", jwtContentType)
+		_, _ = io.WriteString(w, token)
+	}
+}
+
+// validate checks that the account JWT is for the account and is issued
+// by the operator or one of its signing keys
+func validate(o *authb.OperatorData, pk string, token string) (*jwt.AccountClaims, error) {
+	ac, err := jwt.DecodeAccountClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	if ac.Subject != pk {
+		return nil, fmt.Errorf("JWT subject %s doesn't match %s", ac.Subject, pk)
+	}
+	if ac.Issuer == o.Claim.Subject {
+		if o.Claim.StrictSigningKeyUsage {
+			return nil, errors.New("operator requires account JWTs to be issued by a signing key")
+		}
+	} else if !o.Claim.SigningKeys.Contains(ac.Issuer) {
+		return nil, fmt.Errorf("JWT issuer %s is not a key of the operator", ac.Issuer)
+	}
+	var vr jwt.ValidationResults
+	ac.Validate(&vr)
+	if vr.IsBlocking(true) {
+		return nil, vr.Errors()[0]
+	}
+	return ac, nil
+}
+
+func (h *Handler) updateAccount(w http.ResponseWriter, r *http.Request, pk string) {
+	d, err := io.ReadAll(io.LimitReader(r.Body, maxJwtSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token := strings.TrimSpace(string(d))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// apply the update to the latest stored state
+	if err := h.auth.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	o, err := h.getOperatorData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac, err := validate(o, pk, token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if a := o.Get(pk); a != nil {
+		ad := a.(*authb.AccountData)
+		if ad.Claim.IssuedAt > ac.IssuedAt {
+			http.Error(w, "stored JWT is newer", http.StatusConflict)
+			return
+		}
+		ad.Claim = ac
+		ad.Token = token
+	} else {
+		key, err := authb.KeyFrom(pk)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := ac.Name
+		if name == "" || o.Get(name) != nil {
+			name = pk
+		}
+		o.AccountDatas = append(o.AccountDatas, &authb.AccountData{
+			BaseData: authb.BaseData{EntityName: name, Key: key, Token: token},
+			Operator: o,
+			Claim:    ac,
+		})
+	}
+
+	if err := h.auth.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// resolve the keys of the updated account
+	if err := h.auth.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,27 +1,192 @@
 package authb
 
 import (
+	"errors"
 	"fmt"
 	"github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nkeys"
 )
 
 type AuthImpl struct {
-	provider  AuthProvider
-	operators []*OperatorData
+	provider    AuthProvider
+	keys        KeyStore
+	mode        LoadMode
+	operators   []*OperatorData
+	quarantined []*VerifyError
 }
 
-func NewAuth(provider AuthProvider) (*AuthImpl, error) {
-	auth := &AuthImpl{provider: provider}
-	auth.provider = provider
-	operators, err := auth.provider.Load()
-	if err != nil {
+// NewAuth creates an Auth that uses the provider to store both the JWTs
+// and the keys. The provider must implement KeyStore.
+func NewAuth(provider AuthProvider, opts ...AuthOption) (*AuthImpl, error) {
+	keys, ok := provider.(KeyStore)
+	if !ok {
+		return nil, errors.New("provider is not a KeyStore - use NewAuthWithKeyStore")
+	}
+	return NewAuthWithKeyStore(provider, keys, opts...)
+}
+
+// NewAuthWithKeyStore creates an Auth that stores JWTs using the provider
+// and seeds using the specified KeyStore.
+func NewAuthWithKeyStore(provider AuthProvider, keys KeyStore, opts ...AuthOption) (*AuthImpl, error) {
+	auth := &AuthImpl{provider: provider, keys: keys}
+	for _, opt := range opts {
+		if err := opt(auth); err != nil {
+			return nil, err
+		}
+	}
+	if err := auth.load(); err != nil {
 		return nil, err
 	}
-	auth.operators = operators
 	return auth, nil
 }
 
+// ProviderKeyStore returns ks, or the provider if ks is nil and the
+// provider is also a KeyStore
+func ProviderKeyStore(ks KeyStore, p AuthProvider) (KeyStore, error) {
+	if ks != nil {
+		return ks, nil
+	}
+	ks, ok := p.(KeyStore)
+	if !ok {
+		return nil, errors.New("provider is not a KeyStore and no KeyStore was specified")
+	}
+	return ks, nil
+}
+
+func (a *AuthImpl) load() error {
+	operators, err := a.provider.Load()
+	if err != nil {
+		return err
+	}
+	for _, o := range operators {
+		if err := a.resolveKeys(o); err != nil {
+			return err
+		}
+	}
+	if a.mode != LoadTrusted {
+		if operators, err = a.verify(operators); err != nil {
+			return err
+		}
+	}
+	for _, o := range operators {
+		o.setCommitted()
+	}
+	a.operators = operators
+	return nil
+}
+
+// verify checks the operators as specified by the LoadMode, returning the
+// operators that should be loaded
+func (a *AuthImpl) verify(operators []*OperatorData) ([]*OperatorData, error) {
+	var failed []*VerifyError
+	var verified []*OperatorData
+	for _, o := range operators {
+		errs, ok := verify(o, a.mode == LoadQuarantine)
+		failed = append(failed, errs...)
+		if ok {
+			verified = append(verified, o)
+		}
+	}
+	if a.mode == LoadStrict {
+		if len(failed) > 0 {
+			return nil, &LoadError{Errors: failed}
+		}
+		return operators, nil
+	}
+	a.quarantined = failed
+	return verified, nil
+}
+
+// Quarantined returns the entities removed by the last load because they
+// failed verification. Only set when using LoadQuarantine.
+func (a *AuthImpl) Quarantined() []*VerifyError {
+	return a.quarantined
+}
+
+// resolveKey returns the Key for the public key from the KeyStore. If the
+// KeyStore doesn't have the seed, the returned key only has the public key.
+func (a *AuthImpl) resolveKey(k *Key, pk string) (*Key, error) {
+	if k != nil && k.Seed != nil {
+		return k, nil
+	}
+	key, err := a.keys.GetKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return KeyFrom(pk)
+	}
+	return key, nil
+}
+
+// resolveSigningKeys returns the Keys the KeyStore has for the public keys
+func (a *AuthImpl) resolveSigningKeys(pks []string) ([]*Key, error) {
+	var keys []*Key
+	for _, pk := range pks {
+		k, err := a.keys.GetKey(pk)
+		if err != nil {
+			return nil, err
+		}
+		if k != nil {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (a *AuthImpl) resolveKeys(o *OperatorData) error {
+	var err error
+	if o.Key, err = a.resolveKey(o.Key, o.Claim.Subject); err != nil {
+		return err
+	}
+	if o.OperatorSigningKeys == nil {
+		if o.OperatorSigningKeys, err = a.resolveSigningKeys(o.Claim.SigningKeys); err != nil {
+			return err
+		}
+	}
+	for _, ad := range o.AccountDatas {
+		if ad.Key, err = a.resolveKey(ad.Key, ad.Claim.Subject); err != nil {
+			return err
+		}
+		if ad.AccountSigningKeys == nil {
+			if ad.AccountSigningKeys, err = a.resolveSigningKeys(ad.Claim.SigningKeys.Keys()); err != nil {
+				return err
+			}
+		}
+		for _, ud := range ad.UserDatas {
+			if ud.Key, err = a.resolveKey(ud.Key, ud.Claim.Subject); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// storeKeys writes the keys added since the last commit to the KeyStore.
+// Keys are written before the entities that reference them are stored.
+func (a *AuthImpl) storeKeys(o *OperatorData) error {
+	for _, k := range o.AddedKeys {
+		if err := a.keys.PutKey(k); err != nil {
+			return err
+		}
+	}
+	o.AddedKeys = nil
+	return nil
+}
+
+// deleteKeys removes the keys deleted since the last commit from the
+// KeyStore. Keys are only deleted after the entities that referenced them
+// were stored, so a failed Store doesn't lose the seeds.
+func (a *AuthImpl) deleteKeys(o *OperatorData) error {
+	for _, k := range o.DeletedKeys {
+		if err := a.keys.DeleteKey(k); err != nil {
+			return err
+		}
+	}
+	o.DeletedKeys = nil
+	return nil
+}
+
 type OperatorsImpl struct {
 	auth *AuthImpl
 }
@@ -48,6 +213,9 @@ func (a *OperatorsImpl) Get(name string) Operator {
 }
 
 func (a *OperatorsImpl) Add(name string) (Operator, error) {
+	if a.Get(name) != nil {
+		return nil, alreadyExists("operator", name)
+	}
 	var err error
 	data := &OperatorData{}
 	data.EntityName = name
@@ -57,6 +225,7 @@ func (a *OperatorsImpl) Add(name string) (Operator, error) {
 	}
 	data.Claim = jwt.NewOperatorClaims(data.Key.Public)
 	data.Claim.Name = name
+	data.AddedKeys = append(data.AddedKeys, data.Key)
 
 	a.auth.operators = append(a.auth.operators, data)
 	if err := data.update(); err != nil {
@@ -73,10 +242,11 @@ func (a *OperatorsImpl) Delete(name string) error {
 			break
 		}
 	}
-	if idx != -1 {
-		a.auth.operators[idx] = a.auth.operators[len(a.auth.operators)-1]
-		a.auth.operators = a.auth.operators[:len(a.auth.operators)-1]
+	if idx == -1 {
+		return notFound("operator", name)
 	}
+	a.auth.operators[idx] = a.auth.operators[len(a.auth.operators)-1]
+	a.auth.operators = a.auth.operators[:len(a.auth.operators)-1]
 	return nil
 }
 
@@ -100,7 +270,12 @@ func (a *OperatorsImpl) Import(token []byte, keys []string) (Operator, error) {
 		m[key.Public] = key
 	}
 	if len(keys) != len(claim.SigningKeys)+1 {
-		return nil, fmt.Errorf("not all keys are provided: %d", len(keys))
+		return nil, fmt.Errorf("not all keys are provided: %d: %w", len(keys), ErrKeyNotFound)
+	}
+	for _, o := range a.auth.operators {
+		if o.Subject() == claim.Subject || o.EntityName == claim.Name {
+			return nil, alreadyExists("operator", claim.Name)
+		}
 	}
 
 	var ok bool
@@ -109,15 +284,17 @@ func (a *OperatorsImpl) Import(token []byte, keys []string) (Operator, error) {
 	data.EntityName = claim.Name
 	data.Key, ok = m[claim.Subject]
 	if !ok {
-		return nil, fmt.Errorf("%s was not provided", claim.Subject)
+		return nil, fmt.Errorf("%s was not provided: %w", claim.Subject, ErrKeyNotFound)
 	}
 	for _, k := range claim.SigningKeys {
 		key, ok := m[k]
 		if !ok {
-			return nil, fmt.Errorf("%s was not provided", k)
+			return nil, fmt.Errorf("%s was not provided: %w", k, ErrKeyNotFound)
 		}
 		data.OperatorSigningKeys = append(data.OperatorSigningKeys, key)
 	}
+	data.AddedKeys = append(data.AddedKeys, data.Key)
+	data.AddedKeys = append(data.AddedKeys, data.OperatorSigningKeys...)
 	a.auth.operators = append(a.auth.operators, data)
 	if err := data.update(); err != nil {
 		return nil, err
@@ -126,11 +303,43 @@ func (a *OperatorsImpl) Import(token []byte, keys []string) (Operator, error) {
 }
 
 func (a *AuthImpl) Commit() error {
-	return a.provider.Store(a.operators)
+	for _, o := range a.operators {
+		if err := a.storeKeys(o); err != nil {
+			return err
+		}
+	}
+	// some providers clear DeletedAccounts on Store
+	removed := make([][]*AccountData, len(a.operators))
+	for i, o := range a.operators {
+		removed[i] = o.DeletedAccounts
+	}
+	if err := a.provider.Store(a.operators); err != nil {
+		return err
+	}
+	for i, o := range a.operators {
+		o.setCommitted()
+		o.addRemoved(removed[i])
+	}
+	for _, o := range a.operators {
+		if err := a.deleteKeys(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *AuthImpl) HasChanges() bool {
+	return len(a.Changes()) > 0
+}
+
+func (a *AuthImpl) Changes() []Change {
+	var changes []Change
+	for _, o := range a.operators {
+		changes = append(changes, o.changes()...)
+	}
+	return changes
 }
 
 func (a *AuthImpl) Reload() error {
-	var err error
-	a.operators, err = a.provider.Load()
-	return err
+	return a.load()
 }
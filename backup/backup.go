@@ -0,0 +1,382 @@
+// Package backup writes the operators, accounts, users and seeds stored by an
+// AuthProvider into a single archive, and restores them into any AuthProvider.
+// The archive is a tar.gz with a manifest listing every file and its checksum.
+// Seeds are sealed to a recipient curve key, so the archive can be kept
+// with the same care as the JWTs.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"io"
+	"path"
+	"time"
+)
+
+const (
+	// Version is the version of the archive format
+	Version = 1
+	// ManifestName is the name of the manifest in the archive
+	ManifestName = "manifest.json"
+)
+
+const (
+	KindOperator = "operator"
+	KindAccount  = "account"
+	KindUser     = "user"
+)
+
+var (
+	// ErrChecksum is returned when a file in the archive doesn't match
+	// the checksum recorded in the manifest
+	ErrChecksum = errors.New("checksum mismatch")
+	// ErrRecipient is returned when the curve key used to restore is not
+	// the recipient of the archive
+	ErrRecipient = errors.New("archive was not sealed for this key")
+)
+
+// Manifest describes the contents of an archive
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Recipient is the public curve key the seeds are sealed to
+	Recipient string `json:"recipient"`
+	// Sender is the public curve key of the ephemeral key that sealed the seeds
+	Sender   string   `json:"sender"`
+	Entities []Entity `json:"entities"`
+	Keys     []File   `json:"keys"`
+}
+
+// Entity is an operator, account or user JWT in the archive
+type Entity struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	// Parent is the subject of the operator of an account, or the subject of
+	// the account of a user
+	Parent string `json:"parent,omitempty"`
+	File
+}
+
+// File is a file in the archive
+type File struct {
+	Path string `json:"path"`
+	// Public is the public key of a seed file
+	Public string `json:"public,omitempty"`
+	Sha256 string `json:"sha256"`
+}
+
+func checksum(d []byte) string {
+	h := sha256.Sum256(d)
+	return hex.EncodeToString(h[:])
+}
+
+// Export writes all the operators in the provider and the seeds the KeyStore
+// has for them to w. Seeds are sealed to the recipient public curve key.
+// If ks is nil the provider must be a KeyStore.
+func Export(w io.Writer, p authb.AuthProvider, ks authb.KeyStore, recipient string) (*Manifest, error) {
+	ks, err := authb.ProviderKeyStore(ks, p)
+	if err != nil {
+		return nil, err
+	}
+	if !nkeys.IsValidPublicCurveKey(recipient) {
+		return nil, fmt.Errorf("%q is not a public curve key", recipient)
+	}
+	sender, err := nkeys.CreateCurveKeys()
+	if err != nil {
+		return nil, err
+	}
+	spk, err := sender.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	operators, err := p.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{
+		Version:   Version,
+		Created:   time.Now().UTC().Truncate(time.Second),
+		Recipient: recipient,
+		Sender:    spk,
+	}
+	files := make(map[string][]byte)
+	add := func(kind string, name string, subject string, parent string, token string) {
+		fp := path.Join(kind+"s", subject+".jwt")
+		files[fp] = []byte(token)
+		m.Entities = append(m.Entities, Entity{
+			Kind:    kind,
+			Name:    name,
+			Subject: subject,
+			Parent:  parent,
+			File:    File{Path: fp, Sha256: checksum(files[fp])},
+		})
+	}
+	seen := make(map[string]bool)
+	for _, o := range operators {
+		add(KindOperator, o.EntityName, o.Claim.Subject, "", o.Token)
+		for _, a := range o.AccountDatas {
+			add(KindAccount, a.EntityName, a.Claim.Subject, o.Claim.Subject, a.Token)
+			for _, u := range a.UserDatas {
+				add(KindUser, u.EntityName, u.Claim.Subject, a.Claim.Subject, u.Token)
+			}
+		}
+		for _, pk := range o.ReferencedKeys() {
+			if seen[pk] {
+				continue
+			}
+			seen[pk] = true
+			k, err := ks.GetKey(pk)
+			if err != nil {
+				return nil, err
+			}
+			if k == nil || k.Seed == nil {
+				continue
+			}
+			sealed, err := sender.Seal(k.Seed, recipient)
+			if err != nil {
+				return nil, err
+			}
+			fp := path.Join("keys", pk+".nk")
+			files[fp] = sealed
+			m.Keys = append(m.Keys, File{Path: fp, Public: pk, Sha256: checksum(sealed)})
+		}
+	}
+
+	md, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	write := func(name string, d []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(d)), ModTime: m.Created}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(d)
+		return err
+	}
+	if err := write(ManifestName, md); err != nil {
+		return nil, err
+	}
+	for _, e := range m.Entities {
+		if err := write(e.Path, files[e.Path]); err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range m.Keys {
+		if err := write(k.Path, files[k.Path]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// read returns the manifest and the files in the archive, after verifying
+// the checksums of all the files listed in the manifest
+func read(r io.Reader) (*Manifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		var b bytes.Buffer
+		if _, err := io.Copy(&b, tr); err != nil {
+			return nil, nil, err
+		}
+		files[hdr.Name] = b.Bytes()
+	}
+	md, ok := files[ManifestName]
+	if !ok {
+		return nil, nil, errors.New("archive has no manifest")
+	}
+	var m Manifest
+	if err := json.Unmarshal(md, &m); err != nil {
+		return nil, nil, fmt.Errorf("error parsing manifest: %w", err)
+	}
+	if m.Version != Version {
+		return nil, nil, fmt.Errorf("unsupported archive version %d", m.Version)
+	}
+	verify := func(f File) error {
+		d, ok := files[f.Path]
+		if !ok {
+			return fmt.Errorf("archive is missing %s", f.Path)
+		}
+		if checksum(d) != f.Sha256 {
+			return fmt.Errorf("%s: %w", f.Path, ErrChecksum)
+		}
+		return nil
+	}
+	for _, e := range m.Entities {
+		if err := verify(e.File); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, k := range m.Keys {
+		if err := verify(k); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &m, files, nil
+}
+
+// ReadManifest returns the manifest of the archive after verifying the
+// checksums of its files
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	m, _, err := read(r)
+	return m, err
+}
+
+// Restore reads an archive written by Export and stores its operators in the
+// provider and its seeds in the KeyStore. The curveSeed must be the seed of
+// the recipient of the archive. The provider must not contain the operators.
+// If ks is nil the provider must be a KeyStore.
+func Restore(r io.Reader, to authb.AuthProvider, ks authb.KeyStore, curveSeed string) (*Manifest, error) {
+	ks, err := authb.ProviderKeyStore(ks, to)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := nkeys.FromCurveSeed([]byte(curveSeed))
+	if err != nil {
+		return nil, err
+	}
+	rpk, err := recipient.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	m, files, err := read(r)
+	if err != nil {
+		return nil, err
+	}
+	if m.Recipient != rpk {
+		return nil, ErrRecipient
+	}
+
+	keys := make(map[string]*authb.Key)
+	for _, f := range m.Keys {
+		seed, err := recipient.Open(files[f.Path], m.Sender)
+		if err != nil {
+			return nil, fmt.Errorf("error opening %s: %w", f.Path, err)
+		}
+		k, err := authb.KeyFrom(string(seed))
+		if err != nil {
+			return nil, err
+		}
+		if k.Public != f.Public {
+			return nil, fmt.Errorf("%s contains the seed for %s", f.Path, k.Public)
+		}
+		keys[k.Public] = k
+	}
+	key := func(pk string) (*authb.Key, error) {
+		if k, ok := keys[pk]; ok {
+			return k, nil
+		}
+		return authb.KeyFrom(pk)
+	}
+
+	existing, err := to.Load()
+	if err != nil {
+		return nil, err
+	}
+	var operators []*authb.OperatorData
+	accounts := make(map[string]*authb.AccountData)
+	opsBySubject := make(map[string]*authb.OperatorData)
+	for _, e := range m.Entities {
+		token := string(files[e.Path])
+		k, err := key(e.Subject)
+		if err != nil {
+			return nil, err
+		}
+		bd := authb.BaseData{EntityName: e.Name, Key: k, Token: token}
+		switch e.Kind {
+		case KindOperator:
+			for _, o := range existing {
+				if o.Claim.Subject == e.Subject || o.EntityName == e.Name {
+					return nil, fmt.Errorf("operator %q already exists in the target", e.Name)
+				}
+			}
+			oc, err := jwt.DecodeOperatorClaims(token)
+			if err != nil {
+				return nil, err
+			}
+			if oc.Subject != e.Subject {
+				return nil, fmt.Errorf("%s is not the JWT for %s", e.Path, e.Subject)
+			}
+			od := &authb.OperatorData{BaseData: bd, Claim: oc}
+			opsBySubject[oc.Subject] = od
+			operators = append(operators, od)
+		case KindAccount:
+			od, ok := opsBySubject[e.Parent]
+			if !ok {
+				return nil, fmt.Errorf("account %q references unknown operator %s", e.Name, e.Parent)
+			}
+			ac, err := jwt.DecodeAccountClaims(token)
+			if err != nil {
+				return nil, err
+			}
+			if ac.Subject != e.Subject {
+				return nil, fmt.Errorf("%s is not the JWT for %s", e.Path, e.Subject)
+			}
+			ad := &authb.AccountData{BaseData: bd, Operator: od, Claim: ac}
+			accounts[ac.Subject] = ad
+			od.AccountDatas = append(od.AccountDatas, ad)
+		case KindUser:
+			ad, ok := accounts[e.Parent]
+			if !ok {
+				return nil, fmt.Errorf("user %q references unknown account %s", e.Name, e.Parent)
+			}
+			uc, err := jwt.DecodeUserClaims(token)
+			if err != nil {
+				return nil, err
+			}
+			if uc.Subject != e.Subject {
+				return nil, fmt.Errorf("%s is not the JWT for %s", e.Path, e.Subject)
+			}
+			ud := &authb.UserData{BaseData: bd, AccountData: ad, Claim: uc}
+			ud.RejectEdits = ud.IsScoped()
+			ad.UserDatas = append(ad.UserDatas, ud)
+		default:
+			return nil, fmt.Errorf("unknown entity kind %q", e.Kind)
+		}
+	}
+
+	for _, f := range m.Keys {
+		if err := ks.PutKey(keys[f.Public]); err != nil {
+			return nil, err
+		}
+	}
+	if err := to.Store(operators); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,214 @@
+// Package callout implements a NATS auth callout service that authorizes
+// clients by issuing users for the accounts managed by the library.
+package callout
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"time"
+)
+
+const (
+	// AuthSubject is the subject servers send authorization requests on
+	AuthSubject = "$SYS.REQ.USER.AUTH"
+	// ServerXKeyHeader is the header with the server curve key when the
+	// request is encrypted
+	ServerXKeyHeader = "Nats-Server-Xkey"
+	// QueueGroup is the queue group used to load balance the requests
+	QueueGroup = "authb.callout"
+)
+
+// Authorization describes the user to issue for a request
+type Authorization struct {
+	// Account is the account the user is placed in
+	Account authb.Account
+	// ScopedKey is the public key of a scoped signing key of the Account
+	// that issues the user. The user gets the permissions of the scope.
+	ScopedKey string
+	// Template is a User of the Account whose permissions and limits are
+	// copied to the issued user, which is issued by the same key as the
+	// Template. Used when ScopedKey is not set.
+	Template authb.User
+	// Name is the name of the issued user
+	Name string
+	// Expiry is the time the issued user is valid for, 0 never expires
+	Expiry time.Duration
+}
+
+// Hook maps the identity in an authorization request to the user to issue.
+// Returning an error rejects the client, and the error is returned to the
+// server.
+type Hook func(req *jwt.AuthorizationRequest) (*Authorization, error)
+
+// Options configures a Responder
+type Options struct {
+	// Hook authorizes the requests, required
+	Hook Hook
+	// XKey is the curve seed used to decrypt requests and encrypt responses,
+	// its public key must be set in the account's external authorization
+	XKey string
+	// SigningKey is the public key of a signing key of the callout account
+	// used to sign responses. If not set, the account key is used.
+	SigningKey string
+}
+
+// Responder answers authorization requests for an account configured with
+// external authorization
+type Responder struct {
+	account *authb.AccountData
+	signer  *authb.Key
+	xkp     nkeys.KeyPair
+	hook    Hook
+}
+
+// findKey returns the key of the account with the specified public key
+func findKey(ad *authb.AccountData, pk string) (*authb.Key, error) {
+	if ad.Key != nil && ad.Key.Public == pk {
+		return ad.Key, nil
+	}
+	for _, k := range ad.AccountSigningKeys {
+		if k.Public == pk {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("account %q: %s: %w", ad.Name(), pk, authb.ErrKeyNotFound)
+}
+
+// NewResponder creates a Responder for the callout account, that is the
+// account with the external authorization configuration
+func NewResponder(account authb.Account, opts Options) (*Responder, error) {
+	if opts.Hook == nil {
+		return nil, errors.New("a hook is required")
+	}
+	ad := account.(*authb.AccountData)
+	pk := opts.SigningKey
+	if pk == "" {
+		pk = ad.Subject()
+	}
+	signer, err := findKey(ad, pk)
+	if err != nil {
+		return nil, err
+	}
+	r := &Responder{account: ad, signer: signer, hook: opts.Hook}
+	if opts.XKey != "" {
+		if r.xkp, err = nkeys.FromCurveSeed([]byte(opts.XKey)); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Serve subscribes to authorization requests using a connection of one of
+// the auth users of the callout account
+func (r *Responder) Serve(nc *nats.Conn) (*nats.Subscription, error) {
+	return nc.QueueSubscribe(AuthSubject, QueueGroup, func(m *nats.Msg) {
+		resp, err := r.Respond(m.Data, m.Header.Get(ServerXKeyHeader))
+		if err != nil {
+			// the request can't be answered, the server times out
+			return
+		}
+		_ = m.Respond(resp)
+	})
+}
+
+// Respond returns the response for a request. The serverXKey is the value of
+// the ServerXKeyHeader, set when the request is encrypted. Errors are only
+// returned when the request can't be decoded, authorization failures are
+// returned to the server in the response.
+func (r *Responder) Respond(data []byte, serverXKey string) ([]byte, error) {
+	if serverXKey != "" {
+		if r.xkp == nil {
+			return nil, errors.New("encrypted request but no xkey is configured")
+		}
+		var err error
+		if data, err = r.xkp.Open(data, serverXKey); err != nil {
+			return nil, err
+		}
+	}
+	rc, err := jwt.DecodeAuthorizationRequestClaims(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	rr := jwt.NewAuthorizationResponseClaims(rc.UserNkey)
+	rr.Audience = rc.Server.ID
+	if token, err := r.authorize(&rc.AuthorizationRequest); err != nil {
+		rr.Error = err.Error()
+	} else {
+		rr.Jwt = token
+	}
+	if r.signer.Public != r.account.Subject() {
+		rr.IssuerAccount = r.account.Subject()
+	}
+	token, err := rr.Encode(r.signer.Pair)
+	if err != nil {
+		return nil, err
+	}
+	if serverXKey != "" {
+		return r.xkp.Seal([]byte(token), serverXKey)
+	}
+	return []byte(token), nil
+}
+
+// authorize calls the hook and issues the user
+func (r *Responder) authorize(req *jwt.AuthorizationRequest) (string, error) {
+	a, err := r.hook(req)
+	if err != nil {
+		return "", err
+	}
+	if a == nil || a.Account == nil {
+		return "", errors.New("not authorized")
+	}
+	return Issue(req.UserNkey, a)
+}
+
+// Issue returns a user JWT for the user public key as described by the
+// Authorization
+func Issue(user string, a *Authorization) (string, error) {
+	ad, ok := a.Account.(*authb.AccountData)
+	if !ok {
+		return "", errors.New("unsupported account")
+	}
+	uc := jwt.NewUserClaims(user)
+	uc.Name = a.Name
+	if a.Expiry > 0 {
+		uc.Expires = time.Now().Add(a.Expiry).Unix()
+	}
+
+	var pk string
+	switch {
+	case a.ScopedKey != "":
+		if scope, ok := ad.Claim.SigningKeys.GetScope(a.ScopedKey); !ok || scope == nil {
+			return "", fmt.Errorf("%s is not a scoped signing key of account %q", a.ScopedKey, ad.Name())
+		}
+		pk = a.ScopedKey
+		// scoped users can't have permissions or limits
+		uc.UserPermissionLimits = jwt.UserPermissionLimits{}
+	case a.Template != nil:
+		t, ok := a.Template.(*authb.UserData)
+		if !ok || t.AccountData != ad {
+			return "", fmt.Errorf("template user %s is not a user of account %q", a.Template.Subject(), ad.Name())
+		}
+		pk = t.Claim.Issuer
+		if t.IsScoped() {
+			uc.UserPermissionLimits = jwt.UserPermissionLimits{}
+		} else {
+			uc.UserPermissionLimits = t.Claim.UserPermissionLimits
+		}
+	default:
+		return "", errors.New("a scoped key or a template user is required")
+	}
+
+	key, err := findKey(ad, pk)
+	if err != nil {
+		return "", err
+	}
+	if pk != ad.Subject() {
+		uc.IssuerAccount = ad.Subject()
+	}
+	return uc.Encode(key.Pair)
+}
@@ -0,0 +1,310 @@
+package authb
+
+import (
+	"errors"
+	"github.com/nats-io/jwt/v2"
+)
+
+// ChangeType describes how an entity changed since the last Load or Commit
+type ChangeType string
+
+const (
+	// ChangeAdded means the entity was added
+	ChangeAdded ChangeType = "added"
+	// ChangeModified means the JWT of the entity was re-issued
+	ChangeModified ChangeType = "modified"
+	// ChangeDeleted means the entity was deleted
+	ChangeDeleted ChangeType = "deleted"
+)
+
+// Change describes a pending change to an entity
+type Change struct {
+	Type ChangeType
+	// Kind is one of "operator", "account" or "user"
+	Kind string
+	// Path is the name of the entity qualified by its parents' names
+	Path string
+	// Subject is the public key of the entity
+	Subject string
+	// Committed is the JWT of the entity at the last Load or Commit, empty
+	// if the entity was added
+	Committed string
+	// Token is the current JWT of the entity, empty if the entity was deleted
+	Token string
+}
+
+// Modified returns true if the JWT of the entity was issued since the last
+// Load or Commit, providers use it to detect edits made in the same second
+func (b *BaseData) Modified() bool {
+	return b.committed != b.Token
+}
+
+// change returns the Change for the entity or nil if it didn't change
+func (b *BaseData) change(kind string, path string, subject string) *Change {
+	c := &Change{Kind: kind, Path: path, Subject: subject, Committed: b.committed, Token: b.Token}
+	switch {
+	case b.committed == "":
+		c.Type = ChangeAdded
+	case b.committed != b.Token:
+		c.Type = ChangeModified
+	default:
+		return nil
+	}
+	return c
+}
+
+func (o *OperatorData) changes() []Change {
+	var changes []Change
+	add := func(c *Change) {
+		if c != nil {
+			changes = append(changes, *c)
+		}
+	}
+	add(o.change("operator", o.EntityName, o.Subject()))
+	for _, a := range o.AccountDatas {
+		path := o.EntityName + "/" + a.EntityName
+		add(a.change("account", path, a.Subject()))
+		for _, u := range a.UserDatas {
+			add(u.change("user", path+"/"+u.EntityName, u.Subject()))
+		}
+		for _, u := range a.DeletedUsers {
+			if u.committed != "" {
+				changes = append(changes, Change{Type: ChangeDeleted, Kind: "user", Path: path + "/" + u.EntityName, Subject: u.Subject(), Committed: u.committed})
+			}
+		}
+	}
+	for _, a := range o.DeletedAccounts {
+		if a.committed != "" {
+			changes = append(changes, Change{Type: ChangeDeleted, Kind: "account", Path: o.EntityName + "/" + a.EntityName, Subject: a.Subject(), Committed: a.committed})
+		}
+	}
+	return changes
+}
+
+// setCommitted records the current JWTs as the committed state, and drops
+// the deleted entities, which not all providers clear on Store
+func (o *OperatorData) setCommitted() {
+	o.committed = o.Token
+	o.committedKeys = append([]*Key(nil), o.OperatorSigningKeys...)
+	o.DeletedAccounts = nil
+	for _, a := range o.AccountDatas {
+		a.committed = a.Token
+		a.committedKeys = append([]*Key(nil), a.AccountSigningKeys...)
+		a.DeletedUsers = nil
+		for _, u := range a.UserDatas {
+			u.committed = u.Token
+		}
+	}
+}
+
+// addRemoved records the accounts removed by a commit once, and drops the
+// removed accounts that were added back with the same public key
+func (o *OperatorData) addRemoved(accounts []*AccountData) {
+	var v []*AccountData
+	seen := make(map[string]bool)
+	for _, a := range append(o.RemovedAccounts, accounts...) {
+		pk := a.Subject()
+		if seen[pk] || o.accounts.find(o.AccountDatas, pk) != -1 {
+			continue
+		}
+		seen[pk] = true
+		v = append(v, a)
+	}
+	o.RemovedAccounts = v
+}
+
+// PendingDeletes returns the accounts deleted since the last Commit() and
+// the accounts removed by previous commits, skipping accounts that were
+// added back with the same public key
+func (o *OperatorData) PendingDeletes() []*AccountData {
+	var v []*AccountData
+	seen := make(map[string]bool)
+	add := func(accounts []*AccountData) {
+		for _, a := range accounts {
+			pk := a.Subject()
+			if seen[pk] || o.accounts.find(o.AccountDatas, pk) != -1 {
+				continue
+			}
+			seen[pk] = true
+			v = append(v, a)
+		}
+	}
+	add(o.DeletedAccounts)
+	add(o.RemovedAccounts)
+	return v
+}
+
+// ReferencedKeys returns all the public keys referenced by the operator
+// tree: the operator, its signing keys, the accounts, their signing keys
+// and the users
+func (o *OperatorData) ReferencedKeys() []string {
+	keys := []string{o.Claim.Subject}
+	keys = append(keys, o.Claim.SigningKeys...)
+	for _, a := range o.AccountDatas {
+		keys = append(keys, a.Claim.Subject)
+		keys = append(keys, a.Claim.SigningKeys.Keys()...)
+		for _, u := range a.UserDatas {
+			keys = append(keys, u.Claim.Subject)
+		}
+	}
+	return keys
+}
+
+// reconcileKeys drops the added keys that are no longer referenced by the
+// operator tree, and the deleted keys that are referenced again
+func (o *OperatorData) reconcileKeys() {
+	refs := make(map[string]bool)
+	for _, k := range o.ReferencedKeys() {
+		refs[k] = true
+	}
+	var added []*Key
+	for _, k := range o.AddedKeys {
+		if refs[k.Public] {
+			added = append(added, k)
+		}
+	}
+	o.AddedKeys = added
+	var deleted []string
+	for _, k := range o.DeletedKeys {
+		if !refs[k] {
+			deleted = append(deleted, k)
+		}
+	}
+	o.DeletedKeys = deleted
+}
+
+// filterKeys returns the keys whose public key is in the list
+func filterKeys(keys []*Key, pks []string) []*Key {
+	var v []*Key
+	for _, k := range keys {
+		for _, pk := range pks {
+			if k.Public == pk {
+				v = append(v, k)
+				break
+			}
+		}
+	}
+	return v
+}
+
+// restoreKeys returns the keys whose public key is in the list, adding
+// back the committed keys that were deleted
+func restoreKeys(keys []*Key, committed []*Key, pks []string) []*Key {
+	v := filterKeys(keys, pks)
+	for _, k := range filterKeys(committed, pks) {
+		if len(filterKeys(v, []string{k.Public})) == 0 {
+			v = append(v, k)
+		}
+	}
+	return v
+}
+
+func removeUser(users []*UserData, u *UserData) ([]*UserData, bool) {
+	for i, v := range users {
+		if v == u {
+			return append(users[:i], users[i+1:]...), true
+		}
+	}
+	return users, false
+}
+
+func removeAccount(accounts []*AccountData, a *AccountData) ([]*AccountData, bool) {
+	for i, v := range accounts {
+		if v == a {
+			return append(accounts[:i], accounts[i+1:]...), true
+		}
+	}
+	return accounts, false
+}
+
+func (o *OperatorData) Discard() error {
+	if o.committed == "" {
+		return errors.New("operator was never committed, use Operators().Delete()")
+	}
+	if o.Token != o.committed {
+		claim, err := jwt.DecodeOperatorClaims(o.committed)
+		if err != nil {
+			return err
+		}
+		o.Claim = claim
+		o.Token = o.committed
+		o.OperatorSigningKeys = restoreKeys(o.OperatorSigningKeys, o.committedKeys, o.Claim.SigningKeys)
+	}
+	accounts := append([]*AccountData{}, o.AccountDatas...)
+	accounts = append(accounts, o.DeletedAccounts...)
+	for _, a := range accounts {
+		if err := a.discard(); err != nil {
+			return err
+		}
+	}
+	o.reconcileKeys()
+	return nil
+}
+
+func (a *AccountData) Discard() error {
+	if err := a.discard(); err != nil {
+		return err
+	}
+	a.Operator.reconcileKeys()
+	return nil
+}
+
+func (a *AccountData) discard() error {
+	o := a.Operator
+	var deleted bool
+	o.DeletedAccounts, deleted = removeAccount(o.DeletedAccounts, a)
+	if a.committed == "" {
+		o.AccountDatas, _ = o.accounts.delete(o.AccountDatas, a)
+		return nil
+	}
+	if deleted {
+		o.AccountDatas = o.accounts.append(o.AccountDatas, a)
+	}
+	if a.Token != a.committed {
+		claim, err := jwt.DecodeAccountClaims(a.committed)
+		if err != nil {
+			return err
+		}
+		a.Claim = claim
+		a.Token = a.committed
+		a.AccountSigningKeys = restoreKeys(a.AccountSigningKeys, a.committedKeys, a.Claim.SigningKeys.Keys())
+	}
+	users := append([]*UserData{}, a.UserDatas...)
+	users = append(users, a.DeletedUsers...)
+	for _, u := range users {
+		if err := u.discard(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *UserData) Discard() error {
+	if err := u.discard(); err != nil {
+		return err
+	}
+	u.AccountData.Operator.reconcileKeys()
+	return nil
+}
+
+func (u *UserData) discard() error {
+	a := u.AccountData
+	var deleted bool
+	a.DeletedUsers, deleted = removeUser(a.DeletedUsers, u)
+	if u.committed == "" {
+		a.UserDatas, _ = a.users.delete(a.UserDatas, u)
+		return nil
+	}
+	if deleted {
+		a.UserDatas = a.users.append(a.UserDatas, u)
+	}
+	if u.Token != u.committed {
+		claim, err := jwt.DecodeUserClaims(u.committed)
+		if err != nil {
+			return err
+		}
+		u.Claim = claim
+		u.Token = u.committed
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// entity is the output of list and add
+type entity struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Issuer  string `json:"issuer,omitempty"`
+	// Scope is the role of the scope that issued a user
+	Scope string `json:"scope,omitempty"`
+}
+
+// signingKey is the output of list keys and add key
+type signingKey struct {
+	Key    string `json:"key"`
+	Scoped bool   `json:"scoped"`
+	Role   string `json:"role,omitempty"`
+}
+
+// description is the output of describe
+type description struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Subject   string `json:"subject"`
+	Issuer    string `json:"issuer"`
+	Expires   int64  `json:"expires,omitempty"`
+	NotBefore int64  `json:"not_before,omitempty"`
+	Claims    any    `json:"claims"`
+}
+
+func printEntities(w io.Writer, entities []entity) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSUBJECT\tSCOPE")
+	for _, e := range entities {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Name, e.Subject, e.Scope)
+	}
+	_ = tw.Flush()
+}
+
+func printKeys(w io.Writer, keys []signingKey) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tSCOPED\tROLE")
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s\t%t\t%s\n", k.Key, k.Scoped, k.Role)
+	}
+	_ = tw.Flush()
+}
+
+func userEntity(ad *authb.AccountData, u authb.User) entity {
+	ud := u.(*authb.UserData)
+	e := entity{Name: ud.Name(), Subject: u.Subject(), Issuer: u.Issuer()}
+	if scope, _ := ad.ScopedSigningKeys().GetScope(u.Issuer()); scope != nil {
+		e.Scope = scope.Role()
+	}
+	return e
+}
+
+func accountKeys(ad *authb.AccountData) []signingKey {
+	var keys []signingKey
+	for k := range ad.Claim.SigningKeys {
+		sk := signingKey{Key: k}
+		if scope, _ := ad.ScopedSigningKeys().GetScope(k); scope != nil {
+			sk.Scoped = true
+			sk.Role = scope.Role()
+		}
+		keys = append(keys, sk)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	return keys
+}
+
+func list(c *cli, args []string) error {
+	fs := flagSet("list", "operators|accounts|users|keys [args]")
+	args, err := parse(fs, args, 1, 3)
+	if err != nil {
+		return err
+	}
+	var entities []entity
+	switch args[0] {
+	case "operators":
+		for _, o := range c.auth.Operators().List() {
+			entities = append(entities, entity{Name: o.Name(), Subject: o.Subject()})
+		}
+	case "accounts":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: list accounts <operator>")
+		}
+		o, err := c.operator(args[1])
+		if err != nil {
+			return err
+		}
+		for _, a := range o.Accounts().List() {
+			entities = append(entities, entity{Name: a.Name(), Subject: a.Subject(), Issuer: a.Issuer()})
+		}
+	case "users":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: list users <operator> <account>")
+		}
+		a, err := c.account(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		for _, u := range a.Users().List() {
+			entities = append(entities, userEntity(a.(*authb.AccountData), u))
+		}
+	case "keys":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: list keys <operator> [account]")
+		}
+		var keys []signingKey
+		if len(args) == 2 {
+			o, err := c.operator(args[1])
+			if err != nil {
+				return err
+			}
+			for _, k := range o.SigningKeys().List() {
+				keys = append(keys, signingKey{Key: k})
+			}
+		} else {
+			a, err := c.account(args[1], args[2])
+			if err != nil {
+				return err
+			}
+			keys = accountKeys(a.(*authb.AccountData))
+		}
+		return c.print(keys, func(w io.Writer) { printKeys(w, keys) })
+	default:
+		return fmt.Errorf("unknown entity %q", args[0])
+	}
+	return c.print(entities, func(w io.Writer) { printEntities(w, entities) })
+}
+
+func operatorDescription(o authb.Operator) description {
+	od := o.(*authb.OperatorData)
+	return description{Kind: "operator", Name: od.Name(), Subject: od.Subject(), Issuer: od.Claim.Issuer,
+		Expires: od.Expiry(), NotBefore: od.NotBefore(), Claims: od.Claim}
+}
+
+func accountDescription(a authb.Account) description {
+	ad := a.(*authb.AccountData)
+	return description{Kind: "account", Name: ad.Name(), Subject: ad.Subject(), Issuer: ad.Issuer(),
+		Expires: ad.Expiry(), NotBefore: ad.NotBefore(), Claims: ad.Claim}
+}
+
+func userDescription(u authb.User) description {
+	ud := u.(*authb.UserData)
+	return description{Kind: "user", Name: ud.Name(), Subject: ud.Subject(), Issuer: ud.Issuer(),
+		Expires: ud.Expiry(), NotBefore: ud.NotBefore(), Claims: ud.Claim}
+}
+
+func printDescription(w io.Writer, d description) {
+	fmt.Fprintf(w, "%s %s\n", d.Kind, d.Name)
+	fmt.Fprintf(w, "  subject:    %s\n", d.Subject)
+	fmt.Fprintf(w, "  issuer:     %s\n", d.Issuer)
+	fmt.Fprintf(w, "  expires:    %s\n", formatTime(d.Expires))
+	fmt.Fprintf(w, "  not before: %s\n", formatTime(d.NotBefore))
+	fmt.Fprint(w, "  claims:     ")
+	_ = encode(w, d.Claims, "  ")
+}
+
+// commitDescription commits the changes and describes the edited entity
+func (c *cli) commitDescription(d description) error {
+	return c.commit(d, func(w io.Writer) { printDescription(w, d) })
+}
+
+func describe(c *cli, args []string) error {
+	fs := flagSet("describe", "operator|account|user <names>")
+	args, err := parse(fs, args, 2, 4)
+	if err != nil {
+		return err
+	}
+	var d description
+	switch {
+	case args[0] == "operator" && len(args) == 2:
+		o, err := c.operator(args[1])
+		if err != nil {
+			return err
+		}
+		d = operatorDescription(o)
+	case args[0] == "account" && len(args) == 3:
+		a, err := c.account(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		d = accountDescription(a)
+	case args[0] == "user" && len(args) == 4:
+		u, err := c.user(args[1], args[2], args[3])
+		if err != nil {
+			return err
+		}
+		d = userDescription(u)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown entity or wrong number of arguments")
+	}
+	return c.print(d, func(w io.Writer) { printDescription(w, d) })
+}
+
+func formatTime(v int64) string {
+	if v == 0 {
+		return "-"
+	}
+	return time.Unix(v, 0).UTC().Format(time.RFC3339)
+}
+
+func add(c *cli, args []string) error {
+	fs := flagSet("add", "operator|account|user|key <names>")
+	scope := fs.String("scope", "", "role of the scope that issues the user")
+	key := fs.String("key", "", "public key of the account signing key that issues the user")
+	role := fs.String("role", "", "role of the scope of a new account signing key")
+	args, err := parse(fs, args, 2, 4)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "operator":
+		o, err := c.auth.Operators().Add(args[1])
+		if err != nil {
+			return err
+		}
+		e := entity{Name: o.Name(), Subject: o.Subject()}
+		return c.commit(e, func(w io.Writer) { printEntities(w, []entity{e}) })
+	case "account":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: add account <operator> <name>")
+		}
+		o, err := c.operator(args[1])
+		if err != nil {
+			return err
+		}
+		a, err := o.Accounts().Add(args[2])
+		if err != nil {
+			return err
+		}
+		e := entity{Name: a.Name(), Subject: a.Subject(), Issuer: a.Issuer()}
+		return c.commit(e, func(w io.Writer) { printEntities(w, []entity{e}) })
+	case "user":
+		if len(args) != 4 {
+			return fmt.Errorf("usage: add user <operator> <account> <name>")
+		}
+		a, err := c.account(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		pk := *key
+		if *scope != "" {
+			if pk != "" {
+				return fmt.Errorf("-scope and -key are exclusive")
+			}
+			sl := a.ScopedSigningKeys().GetScopeByRole(*scope)
+			if sl == nil {
+				return fmt.Errorf("scope %q in account %q: %w", *scope, args[2], authb.ErrNotFound)
+			}
+			pk = sl.Key()
+		}
+		u, err := a.Users().Add(args[3], pk)
+		if err != nil {
+			return err
+		}
+		e := userEntity(a.(*authb.AccountData), u)
+		return c.commit(e, func(w io.Writer) { printEntities(w, []entity{e}) })
+	case "key":
+		var k signingKey
+		if len(args) == 2 {
+			if *role != "" {
+				return fmt.Errorf("operator signing keys can't have a scope")
+			}
+			o, err := c.operator(args[1])
+			if err != nil {
+				return err
+			}
+			if k.Key, err = o.SigningKeys().Add(); err != nil {
+				return err
+			}
+		} else if len(args) == 3 {
+			a, err := c.account(args[1], args[2])
+			if err != nil {
+				return err
+			}
+			if *role != "" {
+				sl, err := a.ScopedSigningKeys().AddScope(*role)
+				if err != nil {
+					return err
+				}
+				k = signingKey{Key: sl.Key(), Scoped: true, Role: *role}
+			} else if k.Key, err = a.ScopedSigningKeys().Add(); err != nil {
+				return err
+			}
+		} else {
+			return fmt.Errorf("usage: add key <operator> [account]")
+		}
+		return c.commit(k, func(w io.Writer) { printKeys(w, []signingKey{k}) })
+	default:
+		return fmt.Errorf("unknown entity %q", args[0])
+	}
+}
+
+func creds(c *cli, args []string) error {
+	fs := flagSet("creds", "<operator> <account> <user>")
+	expiry := fs.Duration("expiry", 0, "time the credentials are valid for, 0 uses the expiry of the user")
+	out := fs.String("out", "", "file to write the credentials to, defaults to stdout")
+	args, err := parse(fs, args, 3, 3)
+	if err != nil {
+		return err
+	}
+	u, err := c.user(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	d, err := u.Creds(*expiry)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		if err := os.WriteFile(*out, d, 0600); err != nil {
+			return err
+		}
+		v := map[string]string{"user": u.Subject(), "file": *out}
+		return c.print(v, func(w io.Writer) {
+			fmt.Fprintf(w, "wrote credentials for %s to %s\n", u.Subject(), *out)
+		})
+	}
+	v := map[string]string{"user": u.Subject(), "creds": string(d)}
+	return c.print(v, func(w io.Writer) {
+		_, _ = w.Write(d)
+	})
+}
+
+func resolver(c *cli, args []string) error {
+	fs := flagSet("resolver", "<operator> -dir dir")
+	typ := fs.String("type", string(authb.FullResolver), "resolver type: full or cache")
+	dir := fs.String("dir", "", "directory where the server stores the account JWTs")
+	allowDelete := fs.Bool("allow-delete", false, "allow deleting accounts on a full resolver")
+	interval := fs.Duration("interval", 0, "synchronization interval of a full resolver")
+	limit := fs.Int64("limit", 0, "maximum number of JWTs stored")
+	ttl := fs.Duration("ttl", 0, "time a cache resolver keeps a JWT")
+	operatorPath := fs.String("operator-path", "", "path of the operator JWT in the server, inlined if not set")
+	args, err := parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	o, err := c.operator(args[0])
+	if err != nil {
+		return err
+	}
+	cfg, err := o.ResolverConfig(authb.ResolverOptions{
+		Type:         authb.ResolverType(*typ),
+		Dir:          *dir,
+		AllowDelete:  *allowDelete,
+		Interval:     *interval,
+		Limit:        *limit,
+		TTL:          *ttl,
+		OperatorPath: *operatorPath,
+	})
+	if err != nil {
+		return err
+	}
+	return c.print(cfg, func(w io.Writer) {
+		_, _ = w.Write(cfg.Text())
+	})
+}
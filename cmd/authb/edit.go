@@ -0,0 +1,275 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"strings"
+	"time"
+)
+
+// change is an edit applied when its flag is set
+type change struct {
+	flag string
+	fn   func() error
+}
+
+// apply runs the changes of the flags that were set, in order
+func apply(set map[string]bool, changes ...change) error {
+	for _, c := range changes {
+		if set[c.flag] {
+			if err := c.fn(); err != nil {
+				return fmt.Errorf("-%s: %w", c.flag, err)
+			}
+		}
+	}
+	return nil
+}
+
+// expiry returns the expiry in Unix time for a duration from now, 0 never
+// expires
+func expiry(d time.Duration) int64 {
+	if d == 0 {
+		return 0
+	}
+	return time.Now().Add(d).Unix()
+}
+
+// userLimitFlags are the flags editing the limits of users and scopes
+type userLimitFlags struct {
+	subs      *int64
+	payload   *int64
+	data      *int64
+	bearer    *bool
+	locale    *string
+	connTypes *string
+	sources   *string
+	pubAllow  *string
+	pubDeny   *string
+	subAllow  *string
+	subDeny   *string
+	respMax   *int
+	respTTL   *time.Duration
+	respUnset *bool
+}
+
+func addUserLimitFlags(fs *flag.FlagSet) *userLimitFlags {
+	return &userLimitFlags{
+		subs:      fs.Int64("subs", 0, "maximum number of subscriptions, -1 is unlimited"),
+		payload:   fs.Int64("payload", 0, "maximum message payload in bytes, -1 is unlimited"),
+		data:      fs.Int64("data", 0, "maximum data in bytes, -1 is unlimited"),
+		bearer:    fs.Bool("bearer", false, "allow bearer tokens"),
+		locale:    fs.String("locale", "", "locale of the connection times"),
+		connTypes: fs.String("conn-types", "", "comma separated connection types allowed"),
+		sources:   fs.String("src", "", "comma separated CIDRs the client can connect from"),
+		pubAllow:  fs.String("pub-allow", "", "comma separated subjects allowed to publish"),
+		pubDeny:   fs.String("pub-deny", "", "comma separated subjects denied to publish"),
+		subAllow:  fs.String("sub-allow", "", "comma separated subjects allowed to subscribe"),
+		subDeny:   fs.String("sub-deny", "", "comma separated subjects denied to subscribe"),
+		respMax:   fs.Int("resp-max", 0, "maximum number of responses to a request"),
+		respTTL:   fs.Duration("resp-ttl", 0, "time allowed to respond to a request"),
+		respUnset: fs.Bool("resp-unset", false, "remove the response permissions"),
+	}
+}
+
+func (f *userLimitFlags) apply(l authb.UserLimits, set map[string]bool) error {
+	return apply(set,
+		change{"subs", func() error { return l.SetMaxSubscriptions(*f.subs) }},
+		change{"payload", func() error { return l.SetMaxPayload(*f.payload) }},
+		change{"data", func() error { return l.SetMaxData(*f.data) }},
+		change{"bearer", func() error { return l.SetBearerToken(*f.bearer) }},
+		change{"locale", func() error { return l.SetLocale(*f.locale) }},
+		change{"conn-types", func() error { return l.ConnectionTypes().Set(splitList(*f.connTypes)...) }},
+		change{"src", func() error { return l.ConnectionSources().Set(strings.Join(splitList(*f.sources), ",")) }},
+		change{"pub-allow", func() error { return l.PubPermissions().SetAllow(splitList(*f.pubAllow)...) }},
+		change{"pub-deny", func() error { return l.PubPermissions().SetDeny(splitList(*f.pubDeny)...) }},
+		change{"sub-allow", func() error { return l.SubPermissions().SetAllow(splitList(*f.subAllow)...) }},
+		change{"sub-deny", func() error { return l.SubPermissions().SetDeny(splitList(*f.subDeny)...) }},
+		change{"resp-unset", func() error {
+			if !*f.respUnset {
+				return nil
+			}
+			return l.ResponsePermissions().Unset()
+		}},
+		change{"resp-max", func() error { return l.ResponsePermissions().SetMaxMessages(*f.respMax) }},
+		change{"resp-ttl", func() error { return l.ResponsePermissions().SetExpires(*f.respTTL) }},
+	)
+}
+
+func edit(c *cli, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: edit operator|account|user|scope <names> [flags]")
+	}
+	switch args[0] {
+	case "operator":
+		return editOperator(c, args[1:])
+	case "account":
+		return editAccount(c, args[1:])
+	case "user":
+		return editUser(c, args[1:])
+	case "scope":
+		return editScope(c, args[1:])
+	default:
+		return fmt.Errorf("unknown entity %q", args[0])
+	}
+}
+
+func editOperator(c *cli, args []string) error {
+	fs := flagSet("edit operator", "<operator> [flags]")
+	accountServer := fs.String("account-server-url", "", "URL of the account server")
+	serviceURLs := fs.String("service-urls", "", "comma separated URLs of the NATS servers")
+	sys := fs.String("system-account", "", "name or public key of the system account")
+	exp := fs.Duration("expiry", 0, "time from now the operator expires, 0 never expires")
+	args, err := parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	o, err := c.operator(args[0])
+	if err != nil {
+		return err
+	}
+	err = apply(visited(fs),
+		change{"account-server-url", func() error { return o.SetAccountServerURL(*accountServer) }},
+		change{"service-urls", func() error { return o.SetOperatorServiceURL(splitList(*serviceURLs)...) }},
+		change{"system-account", func() error {
+			a := o.Accounts().Get(*sys)
+			if a == nil {
+				return fmt.Errorf("account %q: %w", *sys, authb.ErrNotFound)
+			}
+			return o.SetSystemAccount(a)
+		}},
+		change{"expiry", func() error { return o.SetExpiry(expiry(*exp)) }},
+	)
+	if err != nil {
+		return err
+	}
+	return c.commitDescription(operatorDescription(o))
+}
+
+func editAccount(c *cli, args []string) error {
+	fs := flagSet("edit account", "<operator> <account> [flags]")
+	conns := fs.Int64("conns", 0, "maximum number of connections, -1 is unlimited")
+	leafs := fs.Int64("leafs", 0, "maximum number of leaf node connections, -1 is unlimited")
+	subs := fs.Int64("subs", 0, "maximum number of subscriptions, -1 is unlimited")
+	payload := fs.Int64("payload", 0, "maximum message payload in bytes, -1 is unlimited")
+	data := fs.Int64("data", 0, "maximum data in bytes, -1 is unlimited")
+	imports := fs.Int64("imports", 0, "maximum number of imports, -1 is unlimited")
+	exports := fs.Int64("exports", 0, "maximum number of exports, -1 is unlimited")
+	wildcards := fs.Bool("wildcard-exports", true, "allow exports with wildcards")
+	disallowBearer := fs.Bool("disallow-bearer", false, "reject users with bearer tokens")
+	exp := fs.Duration("expiry", 0, "time from now the account expires, 0 never expires")
+	tier := fs.Int("js-tier", 0, "JetStream tier edited by the -js flags, 0 is the default tier")
+	jsMem := fs.Int64("js-mem", 0, "JetStream memory storage in bytes, -1 is unlimited")
+	jsDisk := fs.Int64("js-disk", 0, "JetStream disk storage in bytes, -1 is unlimited")
+	jsMemStream := fs.Int64("js-mem-stream", 0, "maximum size of a memory stream, -1 is unlimited")
+	jsDiskStream := fs.Int64("js-disk-stream", 0, "maximum size of a disk stream, -1 is unlimited")
+	jsStreams := fs.Int64("js-streams", 0, "maximum number of streams, -1 is unlimited")
+	jsConsumers := fs.Int64("js-consumers", 0, "maximum number of consumers, -1 is unlimited")
+	jsAckPending := fs.Int64("js-ack-pending", 0, "maximum number of pending acks, -1 is unlimited")
+	jsUnlimited := fs.Bool("js-unlimited", false, "remove all the JetStream limits of the tier")
+	args, err := parse(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	a, err := c.account(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	set := visited(fs)
+	l := a.Limits()
+	err = apply(set,
+		change{"conns", func() error { return l.SetMaxConnections(*conns) }},
+		change{"leafs", func() error { return l.SetMaxLeafNodeConnections(*leafs) }},
+		change{"subs", func() error { return l.SetMaxSubscriptions(*subs) }},
+		change{"payload", func() error { return l.SetMaxPayload(*payload) }},
+		change{"data", func() error { return l.SetMaxData(*data) }},
+		change{"imports", func() error { return l.SetMaxImports(*imports) }},
+		change{"exports", func() error { return l.SetMaxExports(*exports) }},
+		change{"wildcard-exports", func() error { return l.SetAllowWildcardExports(*wildcards) }},
+		change{"disallow-bearer", func() error { return l.SetDisallowBearerTokens(*disallowBearer) }},
+		change{"expiry", func() error { return a.SetExpiry(expiry(*exp)) }},
+	)
+	if err != nil {
+		return err
+	}
+
+	var js authb.JetStreamLimits
+	for _, f := range []string{"js-mem", "js-disk", "js-mem-stream", "js-disk-stream", "js-streams", "js-consumers", "js-ack-pending", "js-unlimited"} {
+		if !set[f] {
+			continue
+		}
+		if js, err = a.Limits().JetStream().Get(int8(*tier)); err != nil {
+			return err
+		}
+		if js == nil {
+			if js, err = a.Limits().JetStream().Add(int8(*tier)); err != nil {
+				return err
+			}
+		}
+		break
+	}
+	if js != nil {
+		err = apply(set,
+			change{"js-unlimited", func() error {
+				if !*jsUnlimited {
+					return nil
+				}
+				return js.SetUnlimited()
+			}},
+			change{"js-mem", func() error { return js.SetMaxMemoryStorage(*jsMem) }},
+			change{"js-disk", func() error { return js.SetMaxDiskStorage(*jsDisk) }},
+			change{"js-mem-stream", func() error { return js.SetMaxMemoryStreamSize(*jsMemStream) }},
+			change{"js-disk-stream", func() error { return js.SetMaxDiskStreamSize(*jsDiskStream) }},
+			change{"js-streams", func() error { return js.SetMaxStreams(*jsStreams) }},
+			change{"js-consumers", func() error { return js.SetMaxConsumers(*jsConsumers) }},
+			change{"js-ack-pending", func() error { return js.SetMaxAckPending(*jsAckPending) }},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return c.commitDescription(accountDescription(a))
+}
+
+func editUser(c *cli, args []string) error {
+	fs := flagSet("edit user", "<operator> <account> <user> [flags]")
+	limits := addUserLimitFlags(fs)
+	exp := fs.Duration("expiry", 0, "time from now the user expires, 0 never expires")
+	args, err := parse(fs, args, 3, 3)
+	if err != nil {
+		return err
+	}
+	u, err := c.user(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	set := visited(fs)
+	if err := limits.apply(u, set); err != nil {
+		return err
+	}
+	if err := apply(set, change{"expiry", func() error { return u.SetExpiry(expiry(*exp)) }}); err != nil {
+		return err
+	}
+	return c.commitDescription(userDescription(u))
+}
+
+func editScope(c *cli, args []string) error {
+	fs := flagSet("edit scope", "<operator> <account> <role> [flags]")
+	limits := addUserLimitFlags(fs)
+	args, err := parse(fs, args, 3, 3)
+	if err != nil {
+		return err
+	}
+	a, err := c.account(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	sl := a.ScopedSigningKeys().GetScopeByRole(args[2])
+	if sl == nil {
+		return fmt.Errorf("scope %q in account %q: %w", args[2], args[1], authb.ErrNotFound)
+	}
+	if err := limits.apply(sl, visited(fs)); err != nil {
+		return err
+	}
+	return c.commitDescription(accountDescription(a))
+}
@@ -0,0 +1,241 @@
+// Command authb manages operators, accounts, users and signing keys stored
+// by the nsc or the KV provider. Commands that make changes commit them to
+// the provider when they succeed.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/kv"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/nsc"
+	"io"
+	"os"
+	"strings"
+)
+
+const usage = `usage: authb [flags] <command> [args]
+
+Commands:
+  list operators
+  list accounts <operator>
+  list users <operator> <account>
+  list keys <operator> [account]
+  describe operator <operator>
+  describe account <operator> <account>
+  describe user <operator> <account> <user>
+  add operator <name>
+  add account <operator> <name>
+  add user <operator> <account> <name> [-scope role | -key pk]
+  add key <operator> [account] [-role role]
+  edit operator <operator> [flags]
+  edit account <operator> <account> [flags]
+  edit user <operator> <account> <user> [flags]
+  edit scope <operator> <account> <role> [flags]
+  creds <operator> <account> <user> [-expiry duration] [-out file]
+  resolver <operator> -dir dir [flags]
+
+Run "authb <command> [args] -h" for the flags of a command.
+
+Flags:
+`
+
+// cli holds the loaded Auth and the output settings
+type cli struct {
+	auth authb.Auth
+	json bool
+	out  io.Writer
+}
+
+type command func(c *cli, args []string) error
+
+var commands = map[string]command{
+	"list":     list,
+	"describe": describe,
+	"add":      add,
+	"edit":     edit,
+	"creds":    creds,
+	"resolver": resolver,
+}
+
+func main() {
+	provider := flag.String("provider", "nsc", "provider storing the entities: nsc or kv")
+	storesDir := flag.String("stores", "", "nsc stores directory, defaults to the nsc data directory")
+	keysDir := flag.String("keys", "", "nsc keys directory, defaults to the nsc keys directory")
+	natsURL := flag.String("nats", "", "NATS server URL of the KV provider")
+	natsContext := flag.String("context", "", "NATS context of the KV provider")
+	natsCreds := flag.String("creds", "", "NATS credentials file of the KV provider")
+	bucket := flag.String("bucket", "", "KV bucket of the KV provider")
+	encrypt := flag.String("encrypt", "", "curve seed used to encrypt the KV provider values")
+	asJSON := flag.Bool("json", false, "output JSON")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var p authb.AuthProvider
+	switch *provider {
+	case "nsc":
+		p = nsc.NewNscProvider(*storesDir, *keysDir)
+	case "kv":
+		if *bucket == "" {
+			fatal(errors.New("a bucket is required for the kv provider"))
+		}
+		opts := []kv.KvProviderOption{kv.Bucket(*bucket), kv.EncryptKey(*encrypt)}
+		var creds nats.Option
+		if *natsCreds != "" {
+			creds = nats.UserCredentials(*natsCreds)
+		}
+		if *natsContext != "" {
+			opts = append(opts, kv.NatsContext(*natsContext), kv.NatsOptions("", creds))
+		} else {
+			if *natsURL == "" {
+				*natsURL = nats.DefaultURL
+			}
+			opts = append(opts, kv.NatsOptions(*natsURL, creds))
+		}
+		kp, err := kv.NewKvProvider(opts...)
+		if err != nil {
+			fatal(err)
+		}
+		defer kp.Nc.Close()
+		p = kp
+	default:
+		fatal(fmt.Errorf("unsupported provider %q", *provider))
+	}
+
+	auth, err := authb.NewAuth(p)
+	if err != nil {
+		fatal(err)
+	}
+	c := &cli{auth: auth, json: *asJSON, out: os.Stdout}
+	if err := cmd(c, flag.Args()[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "authb: %v\n", err)
+	os.Exit(1)
+}
+
+// parse parses the flags of a command, which may be mixed with the
+// arguments. The number of arguments must be between min and max.
+func parse(fs *flag.FlagSet, args []string, min int, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) < min || len(positional) > max {
+		fs.Usage()
+		return nil, fmt.Errorf("%s: expected %d to %d arguments, got %d", fs.Name(), min, max, len(positional))
+	}
+	return positional, nil
+}
+
+// flagSet creates the flags of a command, errors are returned by parse
+func flagSet(name string, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: authb %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// visited returns the names of the flags that were set
+func visited(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// splitList splits a comma separated list, an empty string is an empty list
+func splitList(v string) []string {
+	var list []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// print writes v as JSON, or calls text to write it as text
+func (c *cli) print(v any, text func(w io.Writer)) error {
+	if c.json {
+		return encode(c.out, v, "")
+	}
+	text(c.out)
+	return nil
+}
+
+// encode writes v as indented JSON without escaping the subject wildcard >
+func encode(w io.Writer, v any, prefix string) error {
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	e.SetIndent(prefix, "  ")
+	return e.Encode(v)
+}
+
+// commit stores the changes and prints the result
+func (c *cli) commit(v any, text func(w io.Writer)) error {
+	if err := c.auth.Commit(); err != nil {
+		return err
+	}
+	return c.print(v, text)
+}
+
+func (c *cli) operator(name string) (authb.Operator, error) {
+	o := c.auth.Operators().Get(name)
+	if o == nil {
+		return nil, fmt.Errorf("operator %q: %w", name, authb.ErrNotFound)
+	}
+	return o, nil
+}
+
+func (c *cli) account(operator string, name string) (authb.Account, error) {
+	o, err := c.operator(operator)
+	if err != nil {
+		return nil, err
+	}
+	a := o.Accounts().Get(name)
+	if a == nil {
+		return nil, fmt.Errorf("account %q in operator %q: %w", name, operator, authb.ErrNotFound)
+	}
+	return a, nil
+}
+
+func (c *cli) user(operator string, account string, name string) (authb.User, error) {
+	a, err := c.account(operator, account)
+	if err != nil {
+		return nil, err
+	}
+	u := a.Users().Get(name)
+	if u == nil {
+		return nil, fmt.Errorf("user %q in account %q: %w", name, account, authb.ErrNotFound)
+	}
+	return u, nil
+}
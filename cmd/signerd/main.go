@@ -0,0 +1,134 @@
+// Command signerd is a reference signing service that keeps operator and
+// account seeds out of the processes using the library. It loads seeds
+// from a directory and signs requests received over NATS request/reply
+// or a Unix socket.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/jwt-auth-builder.go/signer"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+func main() {
+	keysDir := flag.String("keys", "", "directory containing seed files (*.nk), such as an nsc keys directory")
+	natsURL := flag.String("nats", "", "NATS server URL to serve requests on")
+	creds := flag.String("creds", "", "NATS credentials file")
+	subject := flag.String("subject", signer.DefaultSubject, "NATS subject to serve requests on")
+	socket := flag.String("socket", "", "Unix socket path to serve requests on")
+	flag.Parse()
+
+	if *keysDir == "" || (*natsURL == "" && *socket == "") {
+		flag.Usage()
+		os.Exit(1)
+	}
+	s, err := loadServer(*keysDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keys, _ := s.Keys()
+	log.Printf("loaded %d keys", len(keys))
+	if err := serve(s, *natsURL, *creds, *subject, *socket); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve handles requests until the process is signaled or serving on the
+// socket fails. Errors are returned so that the deferred cleanup, such as
+// removing the socket file, runs before exiting.
+func serve(s *signer.Server, natsURL, creds, subject, socket string) error {
+	errs := make(chan error, 1)
+
+	if natsURL != "" {
+		var opts []nats.Option
+		if creds != "" {
+			opts = append(opts, nats.UserCredentials(creds))
+		}
+		nc, err := nats.Connect(natsURL, opts...)
+		if err != nil {
+			return err
+		}
+		defer nc.Close()
+		if _, err := s.ServeNats(nc, subject); err != nil {
+			return err
+		}
+		log.Printf("serving on %s %s", natsURL, subject)
+	}
+	if socket != "" {
+		_ = os.Remove(socket)
+		l, err := net.Listen("unix", socket)
+		if err != nil {
+			return err
+		}
+		// closing a unix listener removes the socket file
+		defer l.Close()
+		if err := os.Chmod(socket, 0600); err != nil {
+			return err
+		}
+		go func() {
+			errs <- s.ServeUnix(l)
+		}()
+		log.Printf("serving on %s", socket)
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-c:
+		return nil
+	case err := <-errs:
+		if err == nil {
+			err = errors.New("stopped serving on the socket")
+		}
+		return err
+	}
+}
+
+func loadServer(dir string) (*signer.Server, error) {
+	// nsc keys directories store seeds in nested directories
+	var files []string
+	err := filepath.WalkDir(dir, func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(fp) == ".nk" {
+			files = append(files, fp)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no seed files found in %s", dir)
+	}
+	s, err := signer.NewServer()
+	if err != nil {
+		return nil, err
+	}
+	for _, fn := range files {
+		d, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		kp, err := nkeys.FromSeed(bytes.TrimSpace(d))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", fn, err)
+		}
+		if err := s.Add(kp); err != nil {
+			return nil, fmt.Errorf("error adding %s: %w", fn, err)
+		}
+	}
+	return s, nil
+}
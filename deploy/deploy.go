@@ -0,0 +1,168 @@
+// Package deploy updates the account JWTs of running NATS servers that use
+// a full or cache account resolver. Requests are made with a user of the
+// operator's system account.
+package deploy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"time"
+)
+
+const (
+	// ClaimsUpdateSubject is the subject servers listen on for account JWT updates
+	ClaimsUpdateSubject = "$SYS.REQ.CLAIMS.UPDATE"
+	// ClaimsDeleteSubject is the subject servers listen on for account deletions
+	ClaimsDeleteSubject = "$SYS.REQ.CLAIMS.DELETE"
+
+	// DefaultTimeout is the time to wait for server responses
+	DefaultTimeout = 2 * time.Second
+)
+
+const (
+	statusHeader = "Status"
+	noResponders = "503"
+)
+
+// ErrNoResponse is returned when no server responded to a request
+var ErrNoResponse = errors.New("no servers responded")
+
+// Options configures how requests wait for the servers to respond
+type Options struct {
+	// Timeout is the maximum time to wait for responses, defaults to
+	// DefaultTimeout
+	Timeout time.Duration
+	// Servers is the number of servers expected to respond. When set,
+	// requests complete as soon as all servers responded, otherwise
+	// responses are collected until the timeout.
+	Servers int
+}
+
+// Connect connects to the servers as the named user of the operator's
+// system account
+func Connect(url string, o authb.Operator, user string, opts ...nats.Option) (*nats.Conn, error) {
+	sys := o.SystemAccount()
+	if sys == nil {
+		return nil, fmt.Errorf("operator %q has no system account", o.Name())
+	}
+	u := sys.Users().Get(user)
+	if u == nil {
+		return nil, fmt.Errorf("user %q not found in the system account", user)
+	}
+	creds, err := u.Creds(0)
+	if err != nil {
+		return nil, err
+	}
+	token, err := jwt.ParseDecoratedJWT(creds)
+	if err != nil {
+		return nil, err
+	}
+	kp, err := jwt.ParseDecoratedUserNKey(creds)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := kp.Seed()
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]nats.Option{nats.UserJWTAndSeed(token, string(seed))}, opts...)
+	return nats.Connect(url, opts...)
+}
+
+// ServerInfo identifies the server that sent a response
+type ServerInfo struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// ResponseData is the result of a successful request
+type ResponseData struct {
+	Account string `json:"account,omitempty"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ResponseError is the result of a failed request
+type ResponseError struct {
+	Account     string `json:"account,omitempty"`
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+}
+
+func (e *ResponseError) Error() string {
+	return e.Description
+}
+
+// ServerResponse is the response of a server to an update or delete request
+type ServerResponse struct {
+	Server ServerInfo     `json:"server"`
+	Data   *ResponseData  `json:"data,omitempty"`
+	Error  *ResponseError `json:"error,omitempty"`
+}
+
+// client makes requests that are answered by every server
+type client struct {
+	nc   *nats.Conn
+	opts Options
+}
+
+func newClient(nc *nats.Conn, opts Options) *client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	return &client{nc: nc, opts: opts}
+}
+
+// requestAll publishes the request and returns the responses received
+// until the timeout or until the expected number of servers responded
+func (c *client) requestAll(subject string, data []byte) ([]*nats.Msg, error) {
+	inbox := c.nc.NewInbox()
+	ch := make(chan *nats.Msg, 32)
+	sub, err := c.nc.ChanSubscribe(inbox, ch)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+	if err := c.nc.PublishRequest(subject, inbox, data); err != nil {
+		return nil, err
+	}
+
+	var msgs []*nats.Msg
+	timer := time.NewTimer(c.opts.Timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case m := <-ch:
+			if m.Header.Get(statusHeader) == noResponders {
+				return msgs, nil
+			}
+			msgs = append(msgs, m)
+			if c.opts.Servers > 0 && len(msgs) >= c.opts.Servers {
+				return msgs, nil
+			}
+		case <-timer.C:
+			return msgs, nil
+		}
+	}
+}
+
+// request sends an update or delete request and parses the responses
+func (c *client) request(subject string, data []byte) ([]ServerResponse, error) {
+	msgs, err := c.requestAll(subject, data)
+	if err != nil {
+		return nil, err
+	}
+	var responses []ServerResponse
+	for _, m := range msgs {
+		var r ServerResponse
+		if err := json.Unmarshal(m.Data, &r); err != nil {
+			return nil, fmt.Errorf("error parsing server response: %w", err)
+		}
+		responses = append(responses, r)
+	}
+	return responses, nil
+}
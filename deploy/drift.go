@@ -0,0 +1,221 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"sort"
+	"strings"
+)
+
+const (
+	// ClaimsLookupSubject is the subject template servers listen on for
+	// account JWT lookups
+	ClaimsLookupSubject = "$SYS.REQ.ACCOUNT.%s.CLAIMS.LOOKUP"
+	// ClaimsListSubject is the subject servers listen on for requests to
+	// list the accounts they store
+	ClaimsListSubject = "$SYS.REQ.CLAIMS.LIST"
+)
+
+// DriftStatus describes how a deployed account JWT compares to the store
+type DriftStatus string
+
+const (
+	// InSync means the servers have the same JWT as the store
+	InSync DriftStatus = "in-sync"
+	// Missing means a server doesn't have the account
+	Missing DriftStatus = "missing"
+	// Older means a server has a JWT issued before the one in the store
+	Older DriftStatus = "older"
+	// Newer means a server has a JWT issued after the one in the store
+	Newer DriftStatus = "newer"
+	// Differs means a server has a different JWT issued at the same time
+	Differs DriftStatus = "differs"
+	// Unknown means a server has an account that is not in the store
+	Unknown DriftStatus = "unknown"
+)
+
+// severity orders the statuses so an account reports the worst one
+var severity = map[DriftStatus]int{
+	InSync:  0,
+	Newer:   1,
+	Differs: 2,
+	Older:   3,
+	Missing: 4,
+	Unknown: 5,
+}
+
+// Drift is the status of an account across the servers that responded
+type Drift struct {
+	Account string
+	// Name is the name of the account in the store, empty for Unknown accounts
+	Name   string
+	Status DriftStatus
+	// Responses is the number of servers that responded to the lookup
+	Responses int
+	// IssuedAt is the issue time of the JWT in the store
+	IssuedAt int64
+	// DeployedIssuedAt is the issue time of the JWT that determined the status
+	DeployedIssuedAt int64
+}
+
+// DriftReport lists the status of all the accounts
+type DriftReport struct {
+	Accounts []Drift
+}
+
+// Drifted returns the accounts that are not in sync
+func (r *DriftReport) Drifted() []Drift {
+	var drifted []Drift
+	for _, d := range r.Accounts {
+		if d.Status != InSync {
+			drifted = append(drifted, d)
+		}
+	}
+	return drifted
+}
+
+// Outdated returns the accounts of the operator that are missing or older
+// on a server
+func (r *DriftReport) Outdated(o authb.Operator) []authb.Account {
+	var accounts []authb.Account
+	for _, d := range r.Accounts {
+		if d.Status == Missing || d.Status == Older {
+			if a := o.Accounts().Get(d.Account); a != nil {
+				accounts = append(accounts, a)
+			}
+		}
+	}
+	return accounts
+}
+
+func (r *DriftReport) String() string {
+	var b strings.Builder
+	for _, d := range r.Accounts {
+		fmt.Fprintf(&b, "%s %s (%s)\n", d.Status, d.Name, d.Account)
+	}
+	return b.String()
+}
+
+// Checker compares the account JWTs deployed on the servers with the store
+type Checker struct {
+	c *client
+}
+
+// NewChecker creates a Checker that sends requests using a connection of
+// a system account user
+func NewChecker(nc *nats.Conn, opts Options) *Checker {
+	return &Checker{c: newClient(nc, opts)}
+}
+
+// compare returns the status of a deployed JWT, an empty JWT is missing
+func compare(ad *authb.AccountData, deployed string) (DriftStatus, int64, error) {
+	if deployed == "" {
+		return Missing, 0, nil
+	}
+	if deployed == ad.Token {
+		return InSync, ad.Claim.IssuedAt, nil
+	}
+	ac, err := jwt.DecodeAccountClaims(deployed)
+	if err != nil {
+		return "", 0, err
+	}
+	switch {
+	case ac.IssuedAt < ad.Claim.IssuedAt:
+		return Older, ac.IssuedAt, nil
+	case ac.IssuedAt > ad.Claim.IssuedAt:
+		return Newer, ac.IssuedAt, nil
+	default:
+		return Differs, ac.IssuedAt, nil
+	}
+}
+
+func (c *Checker) lookup(ad *authb.AccountData) (Drift, error) {
+	d := Drift{Account: ad.Subject(), Name: ad.Name(), Status: InSync, IssuedAt: ad.Claim.IssuedAt}
+	msgs, err := c.c.requestAll(fmt.Sprintf(ClaimsLookupSubject, ad.Subject()), nil)
+	if err != nil {
+		return d, err
+	}
+	if len(msgs) == 0 {
+		return d, fmt.Errorf("lookup of account %q: %w", ad.Name(), ErrNoResponse)
+	}
+	d.Responses = len(msgs)
+	for _, m := range msgs {
+		status, iat, err := compare(ad, string(m.Data))
+		if err != nil {
+			return d, fmt.Errorf("error decoding deployed JWT for account %q: %w", ad.Name(), err)
+		}
+		if severity[status] > severity[d.Status] {
+			d.Status = status
+			d.DeployedIssuedAt = iat
+		} else if d.DeployedIssuedAt == 0 {
+			d.DeployedIssuedAt = iat
+		}
+	}
+	return d, nil
+}
+
+// list returns the public keys of the accounts stored by the servers
+func (c *Checker) list() ([]string, error) {
+	msgs, err := c.c.requestAll(ClaimsListSubject, nil)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	for _, m := range msgs {
+		var r struct {
+			Data []string `json:"data"`
+		}
+		if err := json.Unmarshal(m.Data, &r); err != nil {
+			return nil, fmt.Errorf("error parsing server response: %w", err)
+		}
+		for _, id := range r.Data {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Check looks up the JWT of every account of the operator on the servers,
+// and lists the accounts the servers have that are not in the store
+func (c *Checker) Check(o authb.Operator) (*DriftReport, error) {
+	r := &DriftReport{}
+	for _, a := range o.Accounts().List() {
+		d, err := c.lookup(a.(*authb.AccountData))
+		if err != nil {
+			return nil, err
+		}
+		r.Accounts = append(r.Accounts, d)
+	}
+	ids, err := c.list()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if o.Accounts().Get(id) == nil {
+			r.Accounts = append(r.Accounts, Drift{Account: id, Status: Unknown})
+		}
+	}
+	return r, nil
+}
+
+// Sync checks the accounts of the operator and pushes the ones that are
+// missing or older on a server. Like Push, pending deletions are also sent.
+func (c *Checker) Sync(o authb.Operator) (*DriftReport, *Report, error) {
+	dr, err := c.Check(o)
+	if err != nil {
+		return nil, nil, err
+	}
+	pr, err := (&Publisher{c: c.c}).Push(o, dr.Outdated(o)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dr, pr, nil
+}
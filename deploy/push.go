@@ -0,0 +1,212 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"strings"
+)
+
+const (
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Result is the outcome of pushing an account to the servers
+type Result struct {
+	// Op is OpUpdate or OpDelete
+	Op string
+	// Account is the public key of the account
+	Account string
+	// Name is the name of the account in the store
+	Name string
+	// Responses are the responses of the servers
+	Responses []ServerResponse
+	// Err is set if no server responded or a server failed
+	Err error
+}
+
+// Report lists the results of a push
+type Report struct {
+	Results []Result
+}
+
+// Failed returns the results that have an error
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, v := range r.Results {
+		if v.Err != nil {
+			failed = append(failed, v)
+		}
+	}
+	return failed
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, v := range r.Results {
+		status := "ok"
+		if v.Err != nil {
+			status = v.Err.Error()
+		}
+		fmt.Fprintf(&b, "%s %s (%s): %d responses: %s\n", v.Op, v.Name, v.Account, len(v.Responses), status)
+	}
+	return b.String()
+}
+
+// Publisher pushes account JWTs to the servers
+type Publisher struct {
+	c *client
+}
+
+// NewPublisher creates a Publisher that sends requests using a connection
+// of a system account user
+func NewPublisher(nc *nats.Conn, opts Options) *Publisher {
+	return &Publisher{c: newClient(nc, opts)}
+}
+
+// Changed returns the accounts of the operator that were modified and not
+// yet committed. Call it before Commit() and push the accounts it returns
+// after Commit() succeeds.
+func Changed(o authb.Operator) []authb.Account {
+	var changed []authb.Account
+	for _, a := range o.Accounts().List() {
+		ad := a.(*authb.AccountData)
+		if ad.Modified() {
+			changed = append(changed, a)
+		}
+	}
+	return changed
+}
+
+// checkResponses returns an error if no server responded or a server
+// returned an error
+func checkResponses(responses []ServerResponse) error {
+	if len(responses) == 0 {
+		return ErrNoResponse
+	}
+	var errs []error
+	for _, r := range responses {
+		if r.Error != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Server.Name, r.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Push sends the JWTs of the specified accounts to the servers, and
+// requests the deletion of the accounts returned by PendingDeletes(). Push
+// is meant to be called after Commit(), deleted accounts are kept in
+// RemovedAccounts until the servers delete them. Errors sending a request
+// are returned, while failures reported by the servers are set in the
+// results of the report.
+func (p *Publisher) Push(o authb.Operator, accounts ...authb.Account) (*Report, error) {
+	r := &Report{}
+	for _, a := range accounts {
+		ad, ok := a.(*authb.AccountData)
+		if !ok || ad.Operator == nil || ad.Operator.Subject() != o.Subject() {
+			return nil, fmt.Errorf("account %q is not managed by operator %q", a.Name(), o.Name())
+		}
+		responses, err := p.c.request(ClaimsUpdateSubject, []byte(ad.Token))
+		if err != nil {
+			return nil, err
+		}
+		r.Results = append(r.Results, Result{
+			Op:        OpUpdate,
+			Account:   ad.Subject(),
+			Name:      ad.Name(),
+			Responses: responses,
+			Err:       checkResponses(responses),
+		})
+	}
+
+	od := o.(*authb.OperatorData)
+	if deleted := od.PendingDeletes(); len(deleted) > 0 {
+		var ids []string
+		names := make(map[string]string)
+		for _, a := range deleted {
+			ids = append(ids, a.Subject())
+			names[a.Subject()] = a.Name()
+		}
+		dr, err := p.Delete(o, ids...)
+		if err != nil {
+			return nil, err
+		}
+		done := make(map[string]bool)
+		for _, v := range dr.Results {
+			v.Name = names[v.Account]
+			r.Results = append(r.Results, v)
+			done[v.Account] = v.Err == nil
+		}
+		// failed deletions are retried by the next push
+		var removed []*authb.AccountData
+		for _, a := range od.RemovedAccounts {
+			if !done[a.Subject()] {
+				removed = append(removed, a)
+			}
+		}
+		od.RemovedAccounts = removed
+	}
+	return r, nil
+}
+
+// PushAll sends the JWTs of all the accounts of the operator to the servers
+// and requests the deletion of the accounts returned by PendingDeletes()
+func (p *Publisher) PushAll(o authb.Operator) (*Report, error) {
+	return p.Push(o, o.Accounts().List()...)
+}
+
+// signDelete returns a delete request for the accounts. Servers only accept
+// requests self-signed by the operator or one of its signing keys.
+func signDelete(od *authb.OperatorData, accounts []string) (string, error) {
+	keys := append([]*authb.Key{od.Key}, od.OperatorSigningKeys...)
+	err := errors.New("no keys")
+	for _, k := range keys {
+		if k == nil || k.Pair == nil {
+			continue
+		}
+		gc := jwt.NewGenericClaims(k.Public)
+		gc.Data["accounts"] = accounts
+		var token string
+		// public keys fail to sign, keys can also be backed by a remote signer
+		if token, err = gc.Encode(k.Pair); err == nil {
+			return token, nil
+		}
+	}
+	return "", fmt.Errorf("unable to sign delete request for operator %q: %w", od.Name(), err)
+}
+
+// Delete requests the servers to delete the accounts with the specified
+// public keys. The servers must be configured with allow_delete.
+func (p *Publisher) Delete(o authb.Operator, accounts ...string) (*Report, error) {
+	r := &Report{}
+	if len(accounts) == 0 {
+		return r, nil
+	}
+	token, err := signDelete(o.(*authb.OperatorData), accounts)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := p.c.request(ClaimsDeleteSubject, []byte(token))
+	if err != nil {
+		return nil, err
+	}
+	// a single response covers all the accounts in the request
+	err = checkResponses(responses)
+	for _, id := range accounts {
+		name := ""
+		if a := o.Accounts().Get(id); a != nil {
+			name = a.Name()
+		}
+		r.Results = append(r.Results, Result{
+			Op:        OpDelete,
+			Account:   id,
+			Name:      name,
+			Responses: responses,
+			Err:       err,
+		})
+	}
+	return r, nil
+}
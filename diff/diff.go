@@ -0,0 +1,406 @@
+// Package diff compares two states of a store, such as the committed and
+// the current state, or the contents of two providers, and reports the
+// semantic differences between the entities instead of the opaque JWTs.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Op describes a Difference
+type Op string
+
+const (
+	// Added means the entity or value is only in the new state
+	Added Op = "added"
+	// Removed means the entity or value is only in the old state
+	Removed Op = "removed"
+	// Changed means the value differs between the states
+	Changed Op = "changed"
+)
+
+var opSymbols = map[Op]string{Added: "+", Removed: "-", Changed: "~"}
+
+// unset is the value reported for fields that are not set
+const unset = "<unset>"
+
+// Difference is a difference of an entity between two states
+type Difference struct {
+	Op Op
+	// Kind is one of "operator", "account" or "user"
+	Kind string
+	// Path is the name of the entity qualified by its parents' names
+	Path string
+	// Subject is the public key of the entity
+	Subject string
+	// Field is the changed field, for example "expiry", "limits.conn" or
+	// "signing_keys". Empty when the entity was added or removed.
+	Field string
+	// From is the old value, empty when added
+	From string
+	// To is the new value, empty when removed
+	To string
+}
+
+func (d Difference) String() string {
+	s := fmt.Sprintf("%s %s %s (%s)", opSymbols[d.Op], d.Kind, d.Path, d.Subject)
+	if d.Field == "" {
+		return s
+	}
+	switch d.Op {
+	case Added:
+		return fmt.Sprintf("%s %s: + %s", s, d.Field, d.To)
+	case Removed:
+		return fmt.Sprintf("%s %s: - %s", s, d.Field, d.From)
+	default:
+		return fmt.Sprintf("%s %s: %s -> %s", s, d.Field, d.From, d.To)
+	}
+}
+
+// Diff lists the differences between two states
+type Diff struct {
+	Differences []Difference
+}
+
+// Empty returns true if the states are the same
+func (d *Diff) Empty() bool {
+	return len(d.Differences) == 0
+}
+
+func (d *Diff) String() string {
+	var b strings.Builder
+	for _, v := range d.Differences {
+		b.WriteString(v.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Operators compares the operators, matched by their public keys
+func Operators(from []*authb.OperatorData, to []*authb.OperatorData) *Diff {
+	d := &differ{diff: &Diff{}}
+	old := make(map[string]*authb.OperatorData)
+	for _, o := range from {
+		old[o.Subject()] = o
+	}
+	for _, o := range to {
+		if f, ok := old[o.Subject()]; ok {
+			d.operator(f, o)
+			delete(old, o.Subject())
+		} else {
+			d.entity(Added, "operator", o.Name(), o.Subject())
+		}
+	}
+	for _, o := range from {
+		if _, ok := old[o.Subject()]; ok {
+			d.entity(Removed, "operator", o.Name(), o.Subject())
+		}
+	}
+	return d.diff
+}
+
+// Auth compares the operators of two Auth
+func Auth(from authb.Auth, to authb.Auth) *Diff {
+	return Operators(operators(from), operators(to))
+}
+
+func operators(auth authb.Auth) []*authb.OperatorData {
+	var v []*authb.OperatorData
+	for _, o := range auth.Operators().List() {
+		v = append(v, o.(*authb.OperatorData))
+	}
+	return v
+}
+
+type differ struct {
+	diff *Diff
+}
+
+func (d *differ) entity(op Op, kind string, path string, subject string) {
+	d.diff.Differences = append(d.diff.Differences, Difference{Op: op, Kind: kind, Path: path, Subject: subject})
+}
+
+// entityDiff adds the differences of the fields of an entity
+type entityDiff struct {
+	d       *differ
+	kind    string
+	path    string
+	subject string
+}
+
+func (e *entityDiff) add(op Op, field string, from string, to string) {
+	e.d.diff.Differences = append(e.d.diff.Differences, Difference{
+		Op:      op,
+		Kind:    e.kind,
+		Path:    e.path,
+		Subject: e.subject,
+		Field:   field,
+		From:    from,
+		To:      to,
+	})
+}
+
+// value reports a change of a field
+func (e *entityDiff) value(field string, from string, to string) {
+	if from == to {
+		return
+	}
+	if from == "" {
+		from = unset
+	}
+	if to == "" {
+		to = unset
+	}
+	e.add(Changed, field, from, to)
+}
+
+// keys reports the values added to or removed from a set
+func (e *entityDiff) keys(field string, from []string, to []string) {
+	old := make(map[string]bool)
+	for _, k := range from {
+		old[k] = true
+	}
+	for _, k := range to {
+		if old[k] {
+			delete(old, k)
+		} else {
+			e.add(Added, field, "", k)
+		}
+	}
+	for _, k := range from {
+		if old[k] {
+			e.add(Removed, field, k, "")
+		}
+	}
+}
+
+// fields reports the changes of the flattened JSON of the values
+func (e *entityDiff) fields(prefix string, from any, to any) {
+	f := flatten(prefix, from)
+	t := flatten(prefix, to)
+	names := make(map[string]bool)
+	for k := range f {
+		names[k] = true
+	}
+	for k := range t {
+		names[k] = true
+	}
+	var sorted []string
+	for k := range names {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		e.value(k, f[k], t[k])
+	}
+}
+
+// flatten returns the leaf values of the JSON of v keyed by their path.
+// Arrays are leaves.
+func flatten(prefix string, v any) map[string]string {
+	m := make(map[string]string)
+	d, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	var tree any
+	if err := json.Unmarshal(d, &tree); err != nil {
+		return m
+	}
+	var walk func(path string, v any)
+	walk = func(path string, v any) {
+		switch vv := v.(type) {
+		case map[string]any:
+			for k, c := range vv {
+				walk(path+"."+k, c)
+			}
+		case nil:
+		default:
+			d, _ := json.Marshal(vv)
+			m[path] = string(d)
+		}
+	}
+	walk(prefix, tree)
+	return m
+}
+
+func formatTime(t int64) string {
+	if t == 0 {
+		return ""
+	}
+	return time.Unix(t, 0).UTC().Format(time.RFC3339)
+}
+
+func compact(v any) string {
+	d, _ := json.Marshal(v)
+	return string(d)
+}
+
+// claims reports the differences of the fields shared by all entities
+func (e *entityDiff) claims(from *jwt.ClaimsData, to *jwt.ClaimsData, fromName string, toName string) {
+	e.value("name", fromName, toName)
+	e.value("issuer", from.Issuer, to.Issuer)
+	e.value("expiry", formatTime(from.Expires), formatTime(to.Expires))
+	e.value("not_before", formatTime(from.NotBefore), formatTime(to.NotBefore))
+}
+
+func (d *differ) operator(from *authb.OperatorData, to *authb.OperatorData) {
+	e := &entityDiff{d: d, kind: "operator", path: to.Name(), subject: to.Subject()}
+	if from.Token != to.Token {
+		f, t := from.Claim, to.Claim
+		e.claims(&f.ClaimsData, &t.ClaimsData, f.Name, t.Name)
+		e.keys("signing_keys", f.SigningKeys, t.SigningKeys)
+		e.value("system_account", f.SystemAccount, t.SystemAccount)
+		e.value("account_server_url", f.AccountServerURL, t.AccountServerURL)
+		e.keys("operator_service_urls", f.OperatorServiceURLs, t.OperatorServiceURLs)
+		e.value("strict_signing_key_usage", fmt.Sprint(f.StrictSigningKeyUsage), fmt.Sprint(t.StrictSigningKeyUsage))
+		e.value("tags", strings.Join(f.Tags, ","), strings.Join(t.Tags, ","))
+	}
+
+	old := make(map[string]*authb.AccountData)
+	for _, a := range from.AccountDatas {
+		old[a.Subject()] = a
+	}
+	for _, a := range to.AccountDatas {
+		path := to.Name() + "/" + a.Name()
+		if f, ok := old[a.Subject()]; ok {
+			d.account(path, f, a)
+			delete(old, a.Subject())
+		} else {
+			d.entity(Added, "account", path, a.Subject())
+		}
+	}
+	for _, a := range from.AccountDatas {
+		if _, ok := old[a.Subject()]; ok {
+			d.entity(Removed, "account", from.Name()+"/"+a.Name(), a.Subject())
+		}
+	}
+}
+
+// exportKey identifies an export
+func exportKey(x *jwt.Export) string {
+	return fmt.Sprintf("%s %s", x.Type, x.Subject)
+}
+
+// importKey identifies an import
+func importKey(i *jwt.Import) string {
+	return fmt.Sprintf("%s %s from %s", i.Type, i.Subject, i.Account)
+}
+
+// list reports the entries added, removed or changed between two lists
+// keyed by their identity
+func (e *entityDiff) list(field string, from map[string]any, to map[string]any) {
+	var keys []string
+	for k := range to {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f, ok := from[k]
+		if !ok {
+			e.add(Added, field, "", k)
+			continue
+		}
+		if fj, tj := compact(f), compact(to[k]); fj != tj {
+			e.add(Changed, fmt.Sprintf("%s[%s]", field, k), fj, tj)
+		}
+	}
+	keys = nil
+	for k := range from {
+		if _, ok := to[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.add(Removed, field, k, "")
+	}
+}
+
+func exports(v jwt.Exports) map[string]any {
+	m := make(map[string]any)
+	for _, x := range v {
+		m[exportKey(x)] = x
+	}
+	return m
+}
+
+func imports(v jwt.Imports) map[string]any {
+	m := make(map[string]any)
+	for _, i := range v {
+		m[importKey(i)] = i
+	}
+	return m
+}
+
+func scopes(v jwt.SigningKeys) map[string]any {
+	m := make(map[string]any)
+	for k, s := range v {
+		m[k] = s
+	}
+	return m
+}
+
+func (d *differ) account(path string, from *authb.AccountData, to *authb.AccountData) {
+	e := &entityDiff{d: d, kind: "account", path: path, subject: to.Subject()}
+	if from.Token != to.Token {
+		f, t := from.Claim, to.Claim
+		e.claims(&f.ClaimsData, &t.ClaimsData, f.Name, t.Name)
+		e.list("signing_keys", scopes(f.SigningKeys), scopes(t.SigningKeys))
+		e.fields("limits", f.Limits, t.Limits)
+		e.fields("default_permissions", f.DefaultPermissions, t.DefaultPermissions)
+		e.list("exports", exports(f.Exports), exports(t.Exports))
+		e.list("imports", imports(f.Imports), imports(t.Imports))
+		e.fields("authorization", f.Authorization, t.Authorization)
+		e.keys("revocations", revocations(f.Revocations), revocations(t.Revocations))
+		e.value("tags", strings.Join(f.Tags, ","), strings.Join(t.Tags, ","))
+	}
+
+	old := make(map[string]*authb.UserData)
+	for _, u := range from.UserDatas {
+		old[u.Subject()] = u
+	}
+	for _, u := range to.UserDatas {
+		upath := path + "/" + u.EntityName
+		if f, ok := old[u.Subject()]; ok {
+			d.user(upath, f, u)
+			delete(old, u.Subject())
+		} else {
+			d.entity(Added, "user", upath, u.Subject())
+		}
+	}
+	for _, u := range from.UserDatas {
+		if _, ok := old[u.Subject()]; ok {
+			d.entity(Removed, "user", path+"/"+u.EntityName, u.Subject())
+		}
+	}
+}
+
+func revocations(r jwt.RevocationList) []string {
+	var v []string
+	for k := range r {
+		v = append(v, k)
+	}
+	sort.Strings(v)
+	return v
+}
+
+func (d *differ) user(path string, from *authb.UserData, to *authb.UserData) {
+	if from.Token == to.Token {
+		return
+	}
+	e := &entityDiff{d: d, kind: "user", path: path, subject: to.Subject()}
+	f, t := from.Claim, to.Claim
+	e.claims(&f.ClaimsData, &t.ClaimsData, f.Name, t.Name)
+	e.fields("permissions", f.Permissions, t.Permissions)
+	e.fields("limits", f.Limits, t.Limits)
+	e.value("bearer_token", fmt.Sprint(f.BearerToken), fmt.Sprint(t.BearerToken))
+	e.keys("allowed_connection_types", f.AllowedConnectionTypes, t.AllowedConnectionTypes)
+	e.value("tags", strings.Join(f.Tags, ","), strings.Join(t.Tags, ","))
+}
@@ -0,0 +1,65 @@
+package authb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+)
+
+// Errors returned by the library and the providers are wrapped with these,
+// so they can be tested with errors.Is
+var (
+	// ErrNotFound is returned when an operator, account, user, scope or
+	// JetStream tier doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned when adding an entity with the name of
+	// another entity of the same parent
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrKeyNotFound is returned when a key is not a key of the entity, or
+	// its seed is not available
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrUserIsScoped is returned when editing the limits or permissions of
+	// a user issued by a scoped signing key
+	ErrUserIsScoped = errors.New("user is scoped")
+	// ErrConflict is returned when a change conflicts with the state of the
+	// entities, such as deleting the system account, or with changes stored
+	// by another process since the entities were loaded
+	ErrConflict = errors.New("conflict")
+)
+
+func notFound(kind string, name string) error {
+	return fmt.Errorf("%s %q: %w", kind, name, ErrNotFound)
+}
+
+func alreadyExists(kind string, name string) error {
+	return fmt.Errorf("%s %q: %w", kind, name, ErrAlreadyExists)
+}
+
+func keyNotFound(pk string) error {
+	return fmt.Errorf("%s: %w", pk, ErrKeyNotFound)
+}
+
+// CheckStored is used by providers before storing an entity. It returns
+// ErrAlreadyExists when a new entity would replace a stored one with the
+// same name, or ErrConflict when the stored entity was issued after the
+// entity was loaded. The stored JWT is only read if needed.
+func CheckStored(kind string, name string, loaded int64, stored bool, read func() ([]byte, error)) error {
+	if !stored {
+		return nil
+	}
+	if loaded == 0 {
+		return alreadyExists(kind, name)
+	}
+	token, err := read()
+	if err != nil {
+		return err
+	}
+	c, err := jwt.Decode(string(token))
+	if err != nil {
+		return err
+	}
+	if c.Claims().IssuedAt > loaded {
+		return fmt.Errorf("%s %q was modified in the store: %w", kind, name, ErrConflict)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package authb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"strings"
+	"time"
+)
+
+// ErrNotBeforeAfterExpiry is returned when setting a not before that is
+// later than the expiry
+var ErrNotBeforeAfterExpiry = errors.New("not before is later than expiry")
+
+// checkValidity checks that the not before is not later than the expiry
+func checkValidity(nbf int64, exp int64) error {
+	if nbf != 0 && exp != 0 && nbf > exp {
+		return ErrNotBeforeAfterExpiry
+	}
+	return nil
+}
+
+// notYetValid is the description of the time check that fails for claims with
+// a not before in the future
+const notYetValid = "claim is not yet valid"
+
+// dropNotYetValid removes the time check of a not before in the future from
+// the results, so that the validity of an entity can be scheduled. Other
+// time checks, such as the expiry, still block edits.
+func dropNotYetValid(vr *jwt.ValidationResults) {
+	issues := vr.Issues[:0]
+	for _, i := range vr.Issues {
+		if i.TimeCheck && i.Description == notYetValid {
+			continue
+		}
+		issues = append(issues, i)
+	}
+	vr.Issues = issues
+}
+
+// ExpiryEntry describes an entity with an expiry
+type ExpiryEntry struct {
+	// Kind is one of "operator", "account" or "user"
+	Kind string
+	// Path is the name of the entity qualified by its parents' names
+	Path string
+	// Subject is the public key of the entity
+	Subject string
+	// Expires is the expiry of the entity in Unix Time Seconds
+	Expires int64
+	// NotBefore is the time the entity becomes valid in Unix Time Seconds
+	NotBefore int64
+}
+
+// RenewalPolicy describes the new expiry of renewed entities. Only one of
+// Extend or Until can be set.
+type RenewalPolicy struct {
+	// Extend adds the duration to the current expiry, or to the current
+	// time if the entity already expired
+	Extend time.Duration
+	// Until sets the expiry to a fixed time. Entities that expire after
+	// it are skipped.
+	Until time.Time
+}
+
+func (p RenewalPolicy) validate() error {
+	if (p.Extend > 0) == !p.Until.IsZero() {
+		return errors.New("renewal policy requires one of Extend or Until")
+	}
+	return nil
+}
+
+// expiry returns the renewed expiry for the current expiry
+func (p RenewalPolicy) expiry(exp int64, now time.Time) int64 {
+	if !p.Until.IsZero() {
+		return p.Until.Unix()
+	}
+	from := time.Unix(exp, 0)
+	if from.Before(now) {
+		from = now
+	}
+	return from.Add(p.Extend).Unix()
+}
+
+// Renewal describes the renewal of an entity
+type Renewal struct {
+	ExpiryEntry
+	// Renewed is the new expiry, 0 if the entity was skipped
+	Renewed int64
+	// Reason is the reason the entity was skipped
+	Reason string
+}
+
+// RenewalReport lists the entities that were renewed or skipped
+type RenewalReport struct {
+	Renewed []Renewal
+	Skipped []Renewal
+}
+
+func (r *RenewalReport) String() string {
+	var b strings.Builder
+	for _, v := range r.Renewed {
+		fmt.Fprintf(&b, "renewed %s %s (%s) until %s\n", v.Kind, v.Path, v.Subject, time.Unix(v.Renewed, 0).UTC().Format(time.RFC3339))
+	}
+	for _, v := range r.Skipped {
+		fmt.Fprintf(&b, "skipped %s %s (%s): %s\n", v.Kind, v.Path, v.Subject, v.Reason)
+	}
+	return b.String()
+}
+
+func (o *OperatorData) Expiring(within time.Duration) []ExpiryEntry {
+	deadline := time.Now().Add(within).Unix()
+	var entries []ExpiryEntry
+	add := func(kind string, path string, c *jwt.ClaimsData) {
+		if c.Expires != 0 && c.Expires <= deadline {
+			entries = append(entries, ExpiryEntry{Kind: kind, Path: path, Subject: c.Subject, Expires: c.Expires, NotBefore: c.NotBefore})
+		}
+	}
+	add("operator", o.EntityName, &o.Claim.ClaimsData)
+	for _, a := range o.AccountDatas {
+		path := o.EntityName + "/" + a.EntityName
+		add("account", path, &a.Claim.ClaimsData)
+		for _, u := range a.UserDatas {
+			add("user", path+"/"+u.EntityName, &u.Claim.ClaimsData)
+		}
+	}
+	return entries
+}
+
+// accountIssuer returns the key that issued the account, if the operator
+// trusts it and it can sign
+func (o *OperatorData) accountIssuer(a *AccountData) (*Key, error) {
+	issuer := a.Claim.Issuer
+	if issuer == o.Subject() {
+		if o.Key.CanSign() {
+			return o.Key, nil
+		}
+	} else if o.Claim.SigningKeys.Contains(issuer) {
+		for _, k := range o.OperatorSigningKeys {
+			if k.Public == issuer && k.CanSign() {
+				return k, nil
+			}
+		}
+	} else {
+		return nil, fmt.Errorf("issuer %s is not a key of the operator: %w", issuer, ErrKeyNotFound)
+	}
+	return nil, fmt.Errorf("seed for issuer %s is not held: %w", issuer, ErrKeyNotFound)
+}
+
+func (o *OperatorData) Renew(within time.Duration, policy RenewalPolicy) (*RenewalReport, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	r := &RenewalReport{}
+	for _, e := range o.Expiring(within) {
+		v := Renewal{ExpiryEntry: e}
+		exp := policy.expiry(e.Expires, now)
+		if exp <= e.Expires {
+			v.Reason = "already expires after the renewal"
+			r.Skipped = append(r.Skipped, v)
+			continue
+		}
+		if checkValidity(e.NotBefore, exp) != nil {
+			v.Reason = "the renewal is earlier than the not before"
+			r.Skipped = append(r.Skipped, v)
+			continue
+		}
+		reason, err := o.renew(e, exp)
+		if err != nil {
+			return r, err
+		}
+		if reason != "" {
+			v.Reason = reason
+			r.Skipped = append(r.Skipped, v)
+			continue
+		}
+		v.Renewed = exp
+		r.Renewed = append(r.Renewed, v)
+	}
+	return r, nil
+}
+
+// renew sets the expiry of the entity and re-signs it with its issuer. The
+// returned reason is set if the entity can't be renewed.
+func (o *OperatorData) renew(e ExpiryEntry, exp int64) (string, error) {
+	switch e.Kind {
+	case "operator":
+		if !o.Key.CanSign() {
+			return "seed for the operator key is not held", nil
+		}
+		return "", o.SetExpiry(exp)
+	case "account":
+		a := o.Get(e.Subject).(*AccountData)
+		key, err := o.accountIssuer(a)
+		if err != nil {
+			return err.Error(), nil
+		}
+		a.Claim.Expires = exp
+		return "", a.issue(key)
+	default:
+		for _, a := range o.AccountDatas {
+			u := a.Users().Get(e.Subject)
+			if u == nil {
+				continue
+			}
+			ud := u.(*UserData)
+			issuer := ud.Claim.Issuer
+			if issuer != a.Subject() && !a.Claim.SigningKeys.Contains(issuer) {
+				return fmt.Sprintf("issuer %s is not a key of the account", issuer), nil
+			}
+			key, _, err := a.getKey(issuer)
+			if err != nil || !key.CanSign() {
+				return fmt.Sprintf("seed for issuer %s is not held", issuer), nil
+			}
+			return "", ud.SetExpiry(exp)
+		}
+		return "", notFound("user", e.Subject)
+	}
+}
@@ -0,0 +1,188 @@
+package authb
+
+import "sync"
+
+// indexed is an entity that can be found by name or subject
+type indexed interface {
+	comparable
+	// lookupKeys returns the name and the subject the entity is found by,
+	// either can be empty
+	lookupKeys() (string, string)
+}
+
+func (a *AccountData) lookupKeys() (string, string) {
+	return a.EntityName, a.Claim.Subject
+}
+
+func (u *UserData) lookupKeys() (string, string) {
+	return u.EntityName, u.Claim.Subject
+}
+
+func (k *Key) lookupKeys() (string, string) {
+	return k.Public, ""
+}
+
+// Reindex discards the lookup indexes of the operator and its accounts.
+// The indexes are rebuilt when AccountDatas, UserDatas or AccountSigningKeys
+// are replaced or change length, Reindex is only needed after replacing an
+// entity in place.
+func (o *OperatorData) Reindex() {
+	o.accounts.invalidate()
+	for _, a := range o.AccountDatas {
+		a.Reindex()
+	}
+}
+
+// Reindex discards the lookup indexes of the account
+func (a *AccountData) Reindex() {
+	a.users.invalidate()
+	a.signingKeys.invalidate()
+}
+
+// index maps the names and subjects of the entities in a slice to their
+// position. It is built on first use, and kept up to date by append and
+// remove. It is rebuilt when the slice it is used with is not the one it
+// was built for, so assigning a new slice doesn't need to invalidate it.
+type index[T indexed] struct {
+	mu sync.Mutex
+	// pos is nil when the index must be rebuilt
+	pos map[string]int
+	// dups is set when entities share a name, which stores written before
+	// names were unique can contain. Removing one of them rebuilds the index.
+	dups bool
+	// n and first identify the slice the index was built for
+	n     int
+	first *T
+}
+
+// invalidate discards the index, it is rebuilt on the next use
+func (x *index[T]) invalidate() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.pos = nil
+}
+
+func (x *index[T]) build(s []T) {
+	x.pos = make(map[string]int, len(s)*2)
+	x.dups = false
+	for i, e := range s {
+		x.put(e, i)
+	}
+	x.track(s)
+}
+
+// track records the slice the index is up to date with
+func (x *index[T]) track(s []T) {
+	x.n = len(s)
+	x.first = nil
+	if len(s) > 0 {
+		x.first = &s[0]
+	}
+}
+
+// current returns true if the index is up to date with the slice
+func (x *index[T]) current(s []T) bool {
+	if x.pos == nil || len(s) != x.n {
+		return false
+	}
+	return len(s) == 0 || &s[0] == x.first
+}
+
+// at returns the position of the key if the entity there still has it
+func (x *index[T]) at(s []T, key string) (int, bool) {
+	i, ok := x.pos[key]
+	if !ok {
+		return -1, false
+	}
+	name, subject := s[i].lookupKeys()
+	return i, key == name || key == subject
+}
+
+// put adds the keys of the entity, the first entity with a key wins
+func (x *index[T]) put(e T, i int) {
+	name, subject := e.lookupKeys()
+	for _, k := range [2]string{name, subject} {
+		if k == "" {
+			continue
+		}
+		if _, ok := x.pos[k]; ok {
+			x.dups = true
+			continue
+		}
+		x.pos[k] = i
+	}
+}
+
+// find returns the position of the entity matching the name or subject,
+// or -1 if there is none
+func (x *index[T]) find(s []T, key string) int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.current(s) {
+		x.build(s)
+	}
+	i, ok := x.at(s, key)
+	if i != -1 && !ok {
+		// an entity was replaced in place
+		x.build(s)
+		i, ok = x.at(s, key)
+	}
+	if !ok {
+		return -1
+	}
+	return i
+}
+
+// append returns the slice with the entity added at the end
+func (x *index[T]) append(s []T, e T) []T {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.current(s) {
+		x.pos = nil
+		return append(s, e)
+	}
+	s = append(s, e)
+	x.put(e, len(s)-1)
+	x.track(s)
+	return s
+}
+
+// remove returns the slice without the entity at i, preserving the order
+// of the other entities
+func (x *index[T]) remove(s []T, i int) []T {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	stale := !x.current(s)
+	e := s[i]
+	s = append(s[:i], s[i+1:]...)
+	var zero T
+	s[:len(s)+1][len(s)] = zero
+	if stale || x.dups {
+		x.pos = nil
+		return s
+	}
+	name, subject := e.lookupKeys()
+	delete(x.pos, name)
+	delete(x.pos, subject)
+	// the entities after the removed one moved down
+	for j := i; j < len(s); j++ {
+		name, subject = s[j].lookupKeys()
+		for _, k := range [2]string{name, subject} {
+			if k != "" {
+				x.pos[k] = j
+			}
+		}
+	}
+	x.track(s)
+	return s
+}
+
+// delete returns the slice without the entity, and whether it was found
+func (x *index[T]) delete(s []T, e T) ([]T, bool) {
+	for i, v := range s {
+		if v == e {
+			return x.remove(s, i), true
+		}
+	}
+	return s, false
+}
@@ -0,0 +1,80 @@
+// Package fileutil contains helpers for safely updating files that may be
+// read or written by other processes.
+package fileutil
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile atomically replaces the file with the specified data by writing
+// to a temporary file in the same directory and renaming it. Readers will
+// see either the old or the new contents. If the file already has the
+// same contents, it is left untouched.
+func WriteFile(fp string, data []byte, perm os.FileMode) error {
+	d, err := os.ReadFile(fp)
+	if err == nil && bytes.Equal(d, data) {
+		return nil
+	}
+	dir := filepath.Dir(fp)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(fp)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fp)
+}
+
+// Remove removes the file, it is not an error if the file doesn't exist
+func Remove(fp string) error {
+	err := os.Remove(fp)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Lock acquires an advisory lock on the specified file, creating it if
+// necessary. Exclusive locks are used by writers, and shared locks by
+// readers. The returned function releases the lock.
+func Lock(fp string, exclusive bool) (func() error, error) {
+	if err := os.MkdirAll(filepath.Dir(fp), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(fp, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lock(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		err := unlock(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
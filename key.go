@@ -73,3 +73,51 @@ func KeyFor(p nkeys.PrefixByte) (*Key, error) {
 	}
 	return k, nil
 }
+
+// Signer is the interface for signing with a key whose seed is held outside
+// the process, for example by a separate signing service. The Signer only
+// ever returns signatures.
+type Signer interface {
+	// PublicKey returns the public key of the signing key
+	PublicKey() string
+	// Sign returns the signature for the data
+	Sign(data []byte) ([]byte, error)
+}
+
+// signerKeyPair is a public key nkeys.KeyPair that signs using a Signer
+type signerKeyPair struct {
+	nkeys.KeyPair
+	signer Signer
+}
+
+func (kp *signerKeyPair) Sign(input []byte) ([]byte, error) {
+	return kp.signer.Sign(input)
+}
+
+// KeyFromSigner returns a Key that doesn't have a seed, and signs using
+// the specified Signer. Entities signed by the Key are verified when decoded,
+// so an invalid signature from the Signer fails the edit.
+func KeyFromSigner(s Signer, check ...nkeys.PrefixByte) (*Key, error) {
+	pub, err := nkeys.FromPublicKey(s.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	if len(check) > 0 {
+		if err = nkeys.CompatibleKeyPair(pub, check...); err != nil {
+			return nil, err
+		}
+	}
+	return &Key{Pair: &signerKeyPair{KeyPair: pub, signer: s}, Public: s.PublicKey()}, nil
+}
+
+// CanSign returns true if the Key has a seed or signs using a Signer
+func (k *Key) CanSign() bool {
+	if k == nil {
+		return false
+	}
+	if k.Seed != nil {
+		return true
+	}
+	_, ok := k.Pair.(*signerKeyPair)
+	return ok
+}
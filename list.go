@@ -0,0 +1,84 @@
+package authb
+
+// ListOption selects the accounts or users returned by List
+type ListOption func(o *listOptions)
+
+type listOptions struct {
+	offset   int
+	limit    int
+	accounts func(Account) bool
+	users    func(User) bool
+}
+
+// WithOffset skips the first n accounts or users that match the filter
+func WithOffset(n int) ListOption {
+	return func(o *listOptions) {
+		o.offset = max(n, 0)
+	}
+}
+
+// WithLimit returns at most n accounts or users, 0 is no limit
+func WithLimit(n int) ListOption {
+	return func(o *listOptions) {
+		o.limit = max(n, 0)
+	}
+}
+
+// WithAccountFilter returns only the accounts for which fn returns true.
+// It is ignored when listing users.
+func WithAccountFilter(fn func(Account) bool) ListOption {
+	return func(o *listOptions) {
+		o.accounts = fn
+	}
+}
+
+// WithUserFilter returns only the users for which fn returns true. It is
+// ignored when listing accounts.
+func WithUserFilter(fn func(User) bool) ListOption {
+	return func(o *listOptions) {
+		o.users = fn
+	}
+}
+
+func newListOptions(opts []ListOption) *listOptions {
+	o := &listOptions{}
+	for _, fn := range opts {
+		fn(o)
+	}
+	return o
+}
+
+// page returns the entities at positions 0 to n-1 that match the filter,
+// starting at the offset and up to the limit. Without a filter only the
+// entities of the page are visited.
+func page[E any](n int, at func(int) E, filter func(E) bool, o *listOptions) []E {
+	if filter == nil {
+		start := min(o.offset, n)
+		end := n
+		if o.limit > 0 {
+			end = min(start+o.limit, n)
+		}
+		v := make([]E, 0, end-start)
+		for i := start; i < end; i++ {
+			v = append(v, at(i))
+		}
+		return v
+	}
+	v := make([]E, 0)
+	skip := o.offset
+	for i := 0; i < n; i++ {
+		e := at(i)
+		if !filter(e) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		v = append(v, e)
+		if o.limit > 0 && len(v) == o.limit {
+			break
+		}
+	}
+	return v
+}
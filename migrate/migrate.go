@@ -0,0 +1,255 @@
+// Package migrate copies all the entities and keys from one AuthProvider
+// to another without re-creating keys or re-signing JWTs.
+package migrate
+
+import (
+	"fmt"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"sort"
+	"strings"
+)
+
+// Options configures a migration
+type Options struct {
+	// DryRun reports what would be copied without modifying the target
+	DryRun bool
+	// FromKeys is the KeyStore of the source, if not set the source provider
+	// must be a KeyStore
+	FromKeys authb.KeyStore
+	// ToKeys is the KeyStore of the target, if not set the target provider
+	// must be a KeyStore
+	ToKeys authb.KeyStore
+}
+
+// Entry describes an entity that was copied
+type Entry struct {
+	// Kind is one of "operator", "account" or "user"
+	Kind string
+	// Path is the name of the entity qualified by its parents' names
+	Path string
+	// Subject is the public key of the entity
+	Subject string
+}
+
+// Report lists the entities and keys copied by a migration
+type Report struct {
+	DryRun  bool
+	Entries []Entry
+	// Keys is the list of public keys whose seeds were copied
+	Keys []string
+	// MissingKeys is the list of public keys referenced by the entities
+	// that the source KeyStore doesn't have
+	MissingKeys []string
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	verb := "copied"
+	if r.DryRun {
+		verb = "would copy"
+	}
+	for _, e := range r.Entries {
+		fmt.Fprintf(&b, "%s %s %s (%s)\n", verb, e.Kind, e.Path, e.Subject)
+	}
+	fmt.Fprintf(&b, "%s %d seeds\n", verb, len(r.Keys))
+	for _, k := range r.MissingKeys {
+		fmt.Fprintf(&b, "no seed for %s\n", k)
+	}
+	return b.String()
+}
+
+// resolve returns the Key from the KeyStore, or a public key if the
+// KeyStore doesn't have it
+func resolve(ks authb.KeyStore, pk string) (*authb.Key, bool, error) {
+	k, err := ks.GetKey(pk)
+	if err != nil {
+		return nil, false, err
+	}
+	if k != nil {
+		return k, true, nil
+	}
+	k, err = authb.KeyFrom(pk)
+	return k, false, err
+}
+
+// Migrate loads all the operators from the source provider and stores them
+// in the target provider. The JWTs are copied as is, and all the seeds the
+// source KeyStore has for the entities and their signing keys are copied
+// to the target KeyStore. The target must not contain the operators.
+// After copying, the target is verified to contain the same JWTs and seeds.
+func Migrate(from authb.AuthProvider, to authb.AuthProvider, opts Options) (*Report, error) {
+	fks, err := authb.ProviderKeyStore(opts.FromKeys, from)
+	if err != nil {
+		return nil, err
+	}
+	tks, err := authb.ProviderKeyStore(opts.ToKeys, to)
+	if err != nil {
+		return nil, err
+	}
+	operators, err := from.Load()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := to.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range operators {
+		for _, e := range existing {
+			if e.Claim.Subject == o.Claim.Subject || e.EntityName == o.EntityName {
+				return nil, fmt.Errorf("operator %q already exists in the target", o.EntityName)
+			}
+		}
+	}
+
+	r := &Report{DryRun: opts.DryRun}
+	var keys []*authb.Key
+	for _, o := range operators {
+		r.Entries = append(r.Entries, Entry{Kind: "operator", Path: o.EntityName, Subject: o.Claim.Subject})
+		for _, a := range o.AccountDatas {
+			ap := fmt.Sprintf("%s/%s", o.EntityName, a.EntityName)
+			r.Entries = append(r.Entries, Entry{Kind: "account", Path: ap, Subject: a.Claim.Subject})
+			for _, u := range a.UserDatas {
+				r.Entries = append(r.Entries, Entry{Kind: "user", Path: fmt.Sprintf("%s/%s", ap, u.EntityName), Subject: u.Claim.Subject})
+			}
+		}
+		for _, pk := range o.ReferencedKeys() {
+			k, ok, err := resolve(fks, pk)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				r.MissingKeys = append(r.MissingKeys, pk)
+				continue
+			}
+			r.Keys = append(r.Keys, pk)
+			keys = append(keys, k)
+		}
+	}
+	if opts.DryRun {
+		return r, nil
+	}
+
+	for _, k := range keys {
+		if err := tks.PutKey(k); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range operators {
+		if err := prepare(fks, o); err != nil {
+			return nil, err
+		}
+	}
+	if err := to.Store(operators); err != nil {
+		return nil, err
+	}
+	if err := Verify(from, to, Options{FromKeys: fks, ToKeys: tks}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// prepare marks the entities as new so that the target stores them, and
+// sets the keys providers may need to create the entities
+func prepare(ks authb.KeyStore, o *authb.OperatorData) error {
+	var err error
+	o.Loaded = 0
+	if o.Key, _, err = resolve(ks, o.Claim.Subject); err != nil {
+		return err
+	}
+	for _, a := range o.AccountDatas {
+		a.Loaded = 0
+		if a.Key, _, err = resolve(ks, a.Claim.Subject); err != nil {
+			return err
+		}
+		for _, u := range a.UserDatas {
+			u.Loaded = 0
+			if u.Key, _, err = resolve(ks, u.Claim.Subject); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// VerifyError lists the differences found between two stores
+type VerifyError struct {
+	Differences []string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("stores differ: %s", strings.Join(e.Differences, ", "))
+}
+
+func tokens(operators []*authb.OperatorData) map[string]string {
+	m := make(map[string]string)
+	for _, o := range operators {
+		m[o.Claim.Subject] = o.Token
+		for _, a := range o.AccountDatas {
+			m[a.Claim.Subject] = a.Token
+			for _, u := range a.UserDatas {
+				m[u.Claim.Subject] = u.Token
+			}
+		}
+	}
+	return m
+}
+
+// Verify checks that the operators in the source provider exist in the
+// target provider with identical JWTs, and that both KeyStores have the same
+// seeds for all the keys referenced by the operators. The target may
+// contain additional operators.
+func Verify(from authb.AuthProvider, to authb.AuthProvider, opts Options) error {
+	fks, err := authb.ProviderKeyStore(opts.FromKeys, from)
+	if err != nil {
+		return err
+	}
+	tks, err := authb.ProviderKeyStore(opts.ToKeys, to)
+	if err != nil {
+		return err
+	}
+	source, err := from.Load()
+	if err != nil {
+		return err
+	}
+	target, err := to.Load()
+	if err != nil {
+		return err
+	}
+
+	var diffs []string
+	st := tokens(source)
+	tt := tokens(target)
+	for pk, token := range st {
+		t, ok := tt[pk]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s is missing", pk))
+		} else if t != token {
+			diffs = append(diffs, fmt.Sprintf("%s has a different JWT", pk))
+		}
+	}
+	for _, o := range source {
+		for _, pk := range o.ReferencedKeys() {
+			sk, err := fks.GetKey(pk)
+			if err != nil {
+				return err
+			}
+			tk, err := tks.GetKey(pk)
+			if err != nil {
+				return err
+			}
+			switch {
+			case sk == nil && tk == nil:
+			case sk == nil || tk == nil:
+				diffs = append(diffs, fmt.Sprintf("seed for %s is missing", pk))
+			case string(sk.Seed) != string(tk.Seed):
+				diffs = append(diffs, fmt.Sprintf("seed for %s is different", pk))
+			}
+		}
+	}
+	if len(diffs) > 0 {
+		sort.Strings(diffs)
+		return &VerifyError{Differences: diffs}
+	}
+	return nil
+}
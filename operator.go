@@ -3,6 +3,7 @@ package authb
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nkeys"
 	"github.com/nats-io/nsc/v2/cmd"
@@ -44,6 +45,9 @@ func (o *OperatorData) SetOperatorServiceURL(url ...string) error {
 }
 
 func (o *OperatorData) SetExpiry(exp int64) error {
+	if err := checkValidity(o.Claim.NotBefore, exp); err != nil {
+		return err
+	}
 	o.Claim.Expires = exp
 	return o.update()
 }
@@ -52,6 +56,18 @@ func (o *OperatorData) Expiry() int64 {
 	return o.Claim.Expires
 }
 
+func (o *OperatorData) SetNotBefore(nbf int64) error {
+	if err := checkValidity(nbf, o.Claim.Expires); err != nil {
+		return err
+	}
+	o.Claim.NotBefore = nbf
+	return o.update()
+}
+
+func (o *OperatorData) NotBefore() int64 {
+	return o.Claim.NotBefore
+}
+
 func (o *OperatorData) OperatorServiceURLs() []string {
 	return o.Claim.OperatorServiceURLs
 }
@@ -74,6 +90,9 @@ func (o *OperatorData) SetSystemAccount(account Account) error {
 }
 
 func (o *OperatorData) Add(name string) (Account, error) {
+	if o.Get(name) != nil {
+		return nil, alreadyExists("account", name)
+	}
 	sk, err := KeyFor(nkeys.PrefixByteAccount)
 	if err != nil {
 		return nil, err
@@ -90,46 +109,48 @@ func (o *OperatorData) Add(name string) (Account, error) {
 	if err := ad.update(); err != nil {
 		return nil, err
 	}
-	o.AccountDatas = append(o.AccountDatas, ad)
+	o.AccountDatas = o.accounts.append(o.AccountDatas, ad)
 	return ad, nil
 }
 
 func (o *OperatorData) Delete(name string) error {
-	for idx, a := range o.AccountDatas {
-		if a.EntityName == name || a.Subject() == name {
-			if a.Subject() == o.Claim.SystemAccount {
-				return errors.New("cannot delete system account")
-			}
-			o.DeletedAccounts = append(o.DeletedAccounts, a)
-			o.AccountDatas = append(o.AccountDatas[:idx], o.AccountDatas[idx+1:]...)
-		}
+	idx := o.accounts.find(o.AccountDatas, name)
+	if idx == -1 {
+		return notFound("account", name)
+	}
+	a := o.AccountDatas[idx]
+	if a.Subject() == o.Claim.SystemAccount {
+		return fmt.Errorf("cannot delete system account: %w", ErrConflict)
 	}
+	o.DeletedAccounts = append(o.DeletedAccounts, a)
+	o.AccountDatas = o.accounts.remove(o.AccountDatas, idx)
 	return nil
 }
 
 func (o *OperatorData) Get(name string) Account {
-	for _, a := range o.AccountDatas {
-		if a.EntityName == name || a.Subject() == name {
-			return a
-		}
+	if idx := o.accounts.find(o.AccountDatas, name); idx != -1 {
+		return o.AccountDatas[idx]
 	}
 	return nil
 }
 
-func (o *OperatorData) List() []Account {
-	v := make([]Account, len(o.AccountDatas))
-	for i, a := range o.AccountDatas {
-		v[i] = a
-	}
-	return v
+func (o *OperatorData) List(opts ...ListOption) []Account {
+	lo := newListOptions(opts)
+	return page(len(o.AccountDatas), func(i int) Account { return o.AccountDatas[i] }, lo.accounts, lo)
 }
 
 func (o *OperatorData) update() error {
 	var err error
 	var vr jwt.ValidationResults
 	o.Claim.Validate(&vr)
+	dropNotYetValid(&vr)
 	if vr.IsBlocking(true) {
-		return vr.Errors()[0]
+		// Errors doesn't include the time checks
+		for _, i := range vr.Issues {
+			if i.Blocking || i.TimeCheck {
+				return errors.New(i.Description)
+			}
+		}
 	}
 
 	token, err := o.Claim.Encode(o.Key.Pair)
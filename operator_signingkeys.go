@@ -19,13 +19,13 @@ func (os *operatorSigningKeys) add() (*Key, error) {
 	if err != nil {
 		return nil, err
 	}
+	os.data.Claim.SigningKeys = append(os.data.Claim.SigningKeys, key.Public)
 	err = os.data.update()
 	if err != nil {
 		return nil, err
 	}
 	os.data.AddedKeys = append(os.data.AddedKeys, key)
 	os.data.OperatorSigningKeys = append(os.data.OperatorSigningKeys, key)
-	os.data.Claim.SigningKeys = append(os.data.Claim.SigningKeys, key.Public)
 	return key, nil
 }
 
@@ -34,13 +34,23 @@ func (os *operatorSigningKeys) Delete(key string) (bool, error) {
 		if k == key {
 			os.data.DeletedKeys = append(os.data.DeletedKeys, key)
 			os.data.Claim.SigningKeys = append(os.data.Claim.SigningKeys[:idx], os.data.Claim.SigningKeys[idx+1:]...)
+			// stop signing with the deleted key
+			for i, sk := range os.data.OperatorSigningKeys {
+				if sk.Public == key {
+					os.data.OperatorSigningKeys = append(os.data.OperatorSigningKeys[:i], os.data.OperatorSigningKeys[i+1:]...)
+					break
+				}
+			}
 			return true, os.data.update()
 		}
 	}
-	return false, nil
+	return false, keyNotFound(key)
 }
 
 func (os *operatorSigningKeys) Rotate(key string) (string, error) {
+	if !os.data.Claim.SigningKeys.Contains(key) {
+		return "", keyNotFound(key)
+	}
 	k, err := os.add()
 	if err != nil {
 		return "", err
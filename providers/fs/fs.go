@@ -0,0 +1,300 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/internal/fileutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	JwtExtension  = ".jwt"
+	NKeyExtension = ".nk"
+	lockFile      = ".lock"
+)
+
+// FsProvider is an AuthProvider that stores data in a plain directory
+// structure that is easy to inspect and keep in version control:
+// Operators "<dir>/<operator>.jwt"
+// Accounts "<dir>/<operator>/<account>.jwt"
+// Users "<dir>/<operator>/<account>/<user>.jwt"
+// The FsProvider is also a KeyStore that stores seeds separately from the JWTs
+// Keys "<keysDir>/<publicKey>.nk"
+// Files are written atomically, and access to the directories is serialized
+// across processes using file locks.
+type FsProvider struct {
+	dir     string
+	keysDir string
+}
+
+func NewFsProvider(dir string, keysDir string) *FsProvider {
+	return &FsProvider{dir: dir, keysDir: keysDir}
+}
+
+func (p *FsProvider) lock(dir string, exclusive bool) (func() error, error) {
+	return fileutil.Lock(filepath.Join(dir, lockFile), exclusive)
+}
+
+// validName checks that the name of an entity can be used as a file name
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." ||
+		strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid entity name %q", name)
+	}
+	return nil
+}
+
+// listJwts returns the names of the entities stored in the directory
+func listJwts(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		n := e.Name()
+		if !e.IsDir() && strings.HasSuffix(n, JwtExtension) && !strings.HasPrefix(n, ".") {
+			names = append(names, strings.TrimSuffix(n, JwtExtension))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func readJwt(dir string, name string) (string, error) {
+	d, err := os.ReadFile(filepath.Join(dir, name+JwtExtension))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(d)), nil
+}
+
+func writeJwt(dir string, name string, token string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	return fileutil.WriteFile(filepath.Join(dir, name+JwtExtension), []byte(token), 0600)
+}
+
+// storeJwt writes the JWT of an entity that was modified, after checking that
+// it doesn't replace one stored by another process since it was loaded.
+// Loaded is updated so that later modifications are detected.
+func storeJwt(dir string, kind string, e *authb.BaseData, issuedAt int64) error {
+	if issuedAt <= e.Loaded && !e.Modified() {
+		return nil
+	}
+	if err := validName(e.EntityName); err != nil {
+		return err
+	}
+	_, err := os.Stat(filepath.Join(dir, e.EntityName+JwtExtension))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err = authb.CheckStored(kind, e.EntityName, e.Loaded, err == nil, func() ([]byte, error) {
+		token, err := readJwt(dir, e.EntityName)
+		return []byte(token), err
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeJwt(dir, e.EntityName, e.Token); err != nil {
+		return err
+	}
+	e.Loaded = issuedAt
+	return nil
+}
+
+func (p *FsProvider) Load() ([]*authb.OperatorData, error) {
+	unlock, err := p.lock(p.dir, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	names, err := listJwts(p.dir)
+	if err != nil {
+		return nil, err
+	}
+	operators := make([]*authb.OperatorData, 0, len(names))
+	for _, n := range names {
+		od, err := p.loadOperator(n)
+		if err != nil {
+			return nil, err
+		}
+		operators = append(operators, od)
+	}
+	return operators, nil
+}
+
+func (p *FsProvider) loadOperator(name string) (*authb.OperatorData, error) {
+	token, err := readJwt(p.dir, name)
+	if err != nil {
+		return nil, err
+	}
+	oc, err := jwt.DecodeOperatorClaims(token)
+	if err != nil {
+		return nil, fmt.Errorf("error loading operator %q: %w", name, err)
+	}
+	od := &authb.OperatorData{
+		BaseData: authb.BaseData{EntityName: name, Loaded: oc.IssuedAt, Token: token},
+		Claim:    oc,
+	}
+	dir := filepath.Join(p.dir, name)
+	names, err := listJwts(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		ad, err := p.loadAccount(od, dir, n)
+		if err != nil {
+			return nil, err
+		}
+		od.AccountDatas = append(od.AccountDatas, ad)
+	}
+	return od, nil
+}
+
+func (p *FsProvider) loadAccount(od *authb.OperatorData, dir string, name string) (*authb.AccountData, error) {
+	token, err := readJwt(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	ac, err := jwt.DecodeAccountClaims(token)
+	if err != nil {
+		return nil, fmt.Errorf("error loading account %q: %w", name, err)
+	}
+	ad := &authb.AccountData{
+		BaseData: authb.BaseData{EntityName: name, Loaded: ac.IssuedAt, Token: token},
+		Operator: od,
+		Claim:    ac,
+	}
+	dir = filepath.Join(dir, name)
+	names, err := listJwts(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		token, err := readJwt(dir, n)
+		if err != nil {
+			return nil, err
+		}
+		uc, err := jwt.DecodeUserClaims(token)
+		if err != nil {
+			return nil, fmt.Errorf("error loading user %q: %w", n, err)
+		}
+		ud := &authb.UserData{
+			BaseData:    authb.BaseData{EntityName: n, Loaded: uc.IssuedAt, Token: token},
+			AccountData: ad,
+			Claim:       uc,
+		}
+		ud.RejectEdits = ud.IsScoped()
+		ad.UserDatas = append(ad.UserDatas, ud)
+	}
+	return ad, nil
+}
+
+func (p *FsProvider) Store(operators []*authb.OperatorData) error {
+	unlock, err := p.lock(p.dir, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, o := range operators {
+		if err := storeJwt(p.dir, "operator", &o.BaseData, o.Claim.IssuedAt); err != nil {
+			return err
+		}
+
+		odir := filepath.Join(p.dir, o.EntityName)
+		for _, a := range o.DeletedAccounts {
+			if err := fileutil.Remove(filepath.Join(odir, a.EntityName+JwtExtension)); err != nil {
+				return err
+			}
+			if err := os.RemoveAll(filepath.Join(odir, a.EntityName)); err != nil {
+				return err
+			}
+		}
+		o.DeletedAccounts = nil
+		for _, a := range o.AccountDatas {
+			if err := storeJwt(odir, "account", &a.BaseData, a.Claim.IssuedAt); err != nil {
+				return err
+			}
+
+			adir := filepath.Join(odir, a.EntityName)
+			// deletes go first so that a user can be replaced by a new one with
+			// the same name
+			for _, u := range a.DeletedUsers {
+				if err := fileutil.Remove(filepath.Join(adir, u.EntityName+JwtExtension)); err != nil {
+					return err
+				}
+			}
+			a.DeletedUsers = nil
+			for _, u := range a.UserDatas {
+				if err := storeJwt(adir, "user", &u.BaseData, u.Claim.IssuedAt); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *FsProvider) keyPath(pk string) (string, error) {
+	if err := validName(pk); err != nil {
+		return "", err
+	}
+	return filepath.Join(p.keysDir, pk+NKeyExtension), nil
+}
+
+// GetKey returns the key stored in the keys directory or nil if not found
+func (p *FsProvider) GetKey(pk string) (*authb.Key, error) {
+	fp, err := p.keyPath(pk)
+	if err != nil {
+		return nil, err
+	}
+	d, err := os.ReadFile(fp)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return authb.KeyFrom(strings.TrimSpace(string(d)))
+}
+
+func (p *FsProvider) PutKey(key *authb.Key) error {
+	fp, err := p.keyPath(key.Public)
+	if err != nil {
+		return err
+	}
+	if key.Seed == nil {
+		return fmt.Errorf("key %s has no seed", key.Public)
+	}
+	unlock, err := p.lock(p.keysDir, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fileutil.WriteFile(fp, key.Seed, 0600)
+}
+
+func (p *FsProvider) DeleteKey(pk string) error {
+	fp, err := p.keyPath(pk)
+	if err != nil {
+		return err
+	}
+	unlock, err := p.lock(p.keysDir, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fileutil.Remove(fp)
+}
@@ -0,0 +1,311 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+	"strings"
+)
+
+const (
+	// EncryptionMarker is the bucket entry recording how seeds are stored.
+	// The value is "none" for plaintext seeds, or the public curve key used
+	// to seal them. While a rotation is in progress the value is
+	// "rotating <from> <to>".
+	EncryptionMarker = "config.encryption"
+	// KeysPrefix is the prefix under which seeds are stored
+	KeysPrefix = "keys"
+
+	plaintextMode  = "none"
+	rotatingPrefix = "rotating "
+)
+
+var (
+	// ErrEncryptionMismatch is returned when the provider's encryption key
+	// doesn't match the mode used to store the seeds in the bucket
+	ErrEncryptionMismatch = errors.New("encryption key doesn't match the bucket")
+	// ErrRotationInProgress is returned when the bucket has a rotation of
+	// the encryption key that didn't complete. Resume it by calling
+	// RotateEncryptKey with the same keys.
+	ErrRotationInProgress = errors.New("encryption key rotation in progress")
+)
+
+// encryptionMode returns the marker value for the specified curve key
+func encryptionMode(kp nkeys.KeyPair) (string, error) {
+	if kp == nil {
+		return plaintextMode, nil
+	}
+	return kp.PublicKey()
+}
+
+// curveKey parses an optional curve seed, an empty seed is plaintext
+func curveKey(seed string) (nkeys.KeyPair, error) {
+	if seed == "" {
+		return nil, nil
+	}
+	return nkeys.FromCurveSeed([]byte(seed))
+}
+
+// seal encrypts the seed with the specified key, if the key is nil
+// the seed is returned as is
+func seal(kp nkeys.KeyPair, seed []byte) ([]byte, error) {
+	if kp == nil {
+		return seed, nil
+	}
+	pk, err := kp.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return kp.Seal(seed, pk)
+}
+
+// open decrypts the value with the specified key, if the key is nil
+// the value must be a plaintext seed
+func open(kp nkeys.KeyPair, value []byte) ([]byte, error) {
+	if kp == nil {
+		if !isSeed(value) {
+			return nil, errors.New("value is not a plaintext seed")
+		}
+		return value, nil
+	}
+	pk, err := kp.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return kp.Open(value, pk)
+}
+
+func isSeed(value []byte) bool {
+	_, err := nkeys.FromSeed(value)
+	return err == nil
+}
+
+func readMarker(kv jetstream.KeyValue) (string, uint64, error) {
+	e, err := kv.Get(context.Background(), EncryptionMarker)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return "", 0, nil
+		}
+		return "", 0, err
+	}
+	return string(e.Value()), e.Revision(), nil
+}
+
+// keyEntries returns all the seed entries in the bucket
+func keyEntries(kv jetstream.KeyValue) ([]jetstream.KeyValueEntry, error) {
+	w, err := kv.Watch(context.Background(), fmt.Sprintf("%s.*", KeysPrefix), jetstream.IgnoreDeletes())
+	if err != nil {
+		return nil, err
+	}
+	defer w.Stop()
+	var entries []jetstream.KeyValueEntry
+	for e := range w.Updates() {
+		if e == nil {
+			break
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// checkMarker verifies that the marker is the mode of the provider, an
+// empty marker is a bucket that predates the marker
+func checkMarker(marker string, mode string) error {
+	if strings.HasPrefix(marker, rotatingPrefix) {
+		return ErrRotationInProgress
+	}
+	if marker != "" && marker != mode {
+		return fmt.Errorf("%w: bucket mode is %q", ErrEncryptionMismatch, marker)
+	}
+	return nil
+}
+
+// checkWrite verifies that the seed written under the key at the revision
+// was sealed with the bucket's key. The marker is read after the write, so
+// a rotation that started before the write, and could have missed it, is
+// detected. The seed is then removed, unless the rotation resealed it.
+func (p *KvProvider) checkWrite(key string, rev uint64) error {
+	mode, err := encryptionMode(p.EncryptKey)
+	if err != nil {
+		return err
+	}
+	marker, _, err := readMarker(p.Kv)
+	if err != nil {
+		return err
+	}
+	merr := checkMarker(marker, mode)
+	if merr == nil {
+		return nil
+	}
+	err = p.Kv.Delete(context.Background(), key, jetstream.LastRevision(rev))
+	var apiErr *jetstream.APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.ErrorCode == jetstream.JSErrCodeStreamWrongLastSequence) {
+		return err
+	}
+	return merr
+}
+
+// checkEncryption verifies that the provider's encryption key matches the
+// bucket. Buckets that predate the marker are inspected and then marked.
+func (p *KvProvider) checkEncryption() error {
+	mode, err := encryptionMode(p.EncryptKey)
+	if err != nil {
+		return err
+	}
+	marker, _, err := readMarker(p.Kv)
+	if err != nil {
+		return err
+	}
+	if err := checkMarker(marker, mode); err != nil || marker != "" {
+		return err
+	}
+
+	entries, err := keyEntries(p.Kv)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		if _, err := open(p.EncryptKey, entries[0].Value()); err != nil {
+			return fmt.Errorf("%w: %s", ErrEncryptionMismatch, err)
+		}
+	}
+	_, err = p.Kv.Create(context.Background(), EncryptionMarker, []byte(mode))
+	if err != nil && !errors.Is(err, jetstream.ErrKeyExists) {
+		return err
+	}
+	return nil
+}
+
+// RotateEncryptKey re-encrypts all the seeds in the bucket with the specified
+// curve seed. An empty seed stores the seeds in plaintext, so an existing
+// plaintext bucket can be encrypted by rotating from "" to a curve seed.
+// If the rotation is interrupted, calling RotateEncryptKey again with the
+// same keys will resume it. On success, the provider uses the new key.
+func (p *KvProvider) RotateEncryptKey(to string) error {
+	var from string
+	if p.EncryptKey != nil {
+		seed, err := p.EncryptKey.Seed()
+		if err != nil {
+			return err
+		}
+		from = string(seed)
+	}
+	if err := RotateEncryptKey(p.Kv, from, to); err != nil {
+		return err
+	}
+	kp, err := curveKey(to)
+	if err != nil {
+		return err
+	}
+	p.EncryptKey = kp
+	return nil
+}
+
+// RotateEncryptKey re-encrypts all the seeds in the bucket from one curve
+// seed to another. An empty seed denotes plaintext seeds. Entries already
+// stored with the new key are skipped, so a rotation that was interrupted
+// can be resumed by calling the function again with the same arguments.
+// Writing seeds fails while the rotation is in progress, or if the rotation
+// started during the write, and the marker is only updated if no other
+// rotation changed it since this one started.
+func RotateEncryptKey(kv jetstream.KeyValue, from string, to string) error {
+	fk, err := curveKey(from)
+	if err != nil {
+		return err
+	}
+	tk, err := curveKey(to)
+	if err != nil {
+		return err
+	}
+	fromMode, err := encryptionMode(fk)
+	if err != nil {
+		return err
+	}
+	toMode, err := encryptionMode(tk)
+	if err != nil {
+		return err
+	}
+	if fromMode == toMode {
+		return nil
+	}
+
+	rotating := fmt.Sprintf("%s%s %s", rotatingPrefix, fromMode, toMode)
+	marker, rev, err := readMarker(kv)
+	if err != nil {
+		return err
+	}
+	switch {
+	case marker == rotating:
+		// resuming a rotation
+	case marker == fromMode || marker == "":
+		if marker == "" {
+			rev, err = kv.Create(context.Background(), EncryptionMarker, []byte(rotating))
+		} else {
+			rev, err = kv.Update(context.Background(), EncryptionMarker, []byte(rotating), rev)
+		}
+		if err != nil {
+			return err
+		}
+	case strings.HasPrefix(marker, rotatingPrefix):
+		return fmt.Errorf("%w: %s", ErrRotationInProgress, marker[len(rotatingPrefix):])
+	default:
+		return fmt.Errorf("%w: bucket mode is %q", ErrEncryptionMismatch, marker)
+	}
+
+	// seeds written while the rotation started are picked up by another
+	// pass, or removed by the provider that wrote them
+	for {
+		n, err := reseal(kv, fk, tk)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	_, err = kv.Update(context.Background(), EncryptionMarker, []byte(toMode), rev)
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		// another process may have resumed and completed the same rotation
+		marker, _, rerr := readMarker(kv)
+		if rerr != nil {
+			return rerr
+		}
+		if marker == toMode {
+			return nil
+		}
+		return fmt.Errorf("%w: the marker was changed to %q by another rotation", ErrRotationInProgress, marker)
+	}
+	return err
+}
+
+// reseal seals the seeds that are not sealed with the new key, and returns
+// the number of seeds it sealed
+func reseal(kv jetstream.KeyValue, fk nkeys.KeyPair, tk nkeys.KeyPair) (int, error) {
+	entries, err := keyEntries(kv)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		// already rotated
+		if _, err := open(tk, e.Value()); err == nil {
+			continue
+		}
+		seed, err := open(fk, e.Value())
+		if err != nil {
+			return n, fmt.Errorf("error opening %s: %w", e.Key(), err)
+		}
+		v, err := seal(tk, seed)
+		if err != nil {
+			return n, err
+		}
+		if _, err := kv.Update(context.Background(), e.Key(), v, e.Revision()); err != nil {
+			return n, fmt.Errorf("error updating %s: %w", e.Key(), err)
+		}
+		n++
+	}
+	return n, nil
+}
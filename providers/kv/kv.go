@@ -19,6 +19,8 @@ import (
 // Accounts "<operatorPublicKey>.<accountPublicKey>" -> account JWT
 // Users "<accountPublicKey>.<userPublicKey>" -> user JWT
 // Keys "keys.<publicKey>" -> seeds
+// The KvProvider is also a KeyStore, seeds are only stored in the bucket
+// when the provider is used as the KeyStore.
 // The required arguments are a natsURL, bucket name, and an optional encryption key.
 // if an optional encryption key (an nkey CurveKeys) is used, the keys will be encrypted
 // and require the same key to be decrypted.
@@ -119,13 +121,11 @@ func NewKvProvider(opts ...KvProviderOption) (*KvProvider, error) {
 func NewKvProviderWithConnection(nc *nats.Conn, bucket string, encrypt string) (*KvProvider, error) {
 	p := &KvProvider{Bucket: bucket}
 	p.Nc = nc
-	if encrypt != "" {
-		kp, err := nkeys.FromCurveSeed([]byte(encrypt))
-		if err != nil {
-			return nil, err
-		}
-		p.EncryptKey = kp
+	kp, err := curveKey(encrypt)
+	if err != nil {
+		return nil, err
 	}
+	p.EncryptKey = kp
 	if err := p.init(); err != nil {
 		return nil, err
 	}
@@ -160,6 +160,10 @@ func (p *KvProvider) init() error {
 			return err
 		}
 	}
+	if err = p.checkEncryption(); err != nil {
+		p.Disconnect()
+		return err
+	}
 	return nil
 }
 
@@ -227,17 +231,6 @@ func (p *KvProvider) LoadOperators() ([]*ab.OperatorData, error) {
 		o.Claim = oc
 		o.Loaded = o.Claim.IssuedAt
 		o.EntityName = o.Claim.Name
-		o.Key, err = p.GetKey(o.Claim.Subject)
-		if err != nil {
-			return nil, err
-		}
-		for _, sk := range o.Claim.SigningKeys {
-			k, err := p.GetKey(sk)
-			if err != nil {
-				return nil, err
-			}
-			o.OperatorSigningKeys = append(o.OperatorSigningKeys, k)
-		}
 		operators = append(operators, o)
 	}
 	return operators, nil
@@ -263,17 +256,6 @@ func (p *KvProvider) LoadAccounts(od *ab.OperatorData) error {
 		a.Claim = ac
 		a.Loaded = a.Claim.IssuedAt
 		a.EntityName = a.Claim.Name
-		a.Key, err = p.GetKey(a.Claim.Subject)
-		if err != nil {
-			return err
-		}
-		for pk := range a.Claim.SigningKeys {
-			k, err := p.GetKey(pk)
-			if err != nil {
-				return err
-			}
-			a.AccountSigningKeys = append(a.AccountSigningKeys, k)
-		}
 		od.AccountDatas = append(od.AccountDatas, a)
 	}
 	return nil
@@ -299,57 +281,49 @@ func (p *KvProvider) LoadUsers(ad *ab.AccountData) error {
 		u.Claim = uc
 		u.Loaded = u.Claim.IssuedAt
 		u.EntityName = u.Claim.Name
-		u.Key, err = p.GetKey(u.Claim.Subject)
-		if err != nil {
-			return err
-		}
-
 		ad.UserDatas = append(ad.UserDatas, u)
 	}
 	return nil
 }
 
+// GetKey returns the key stored under "keys.<publicKey>" or nil if not found
 func (p *KvProvider) GetKey(pk string) (*ab.Key, error) {
-	e, err := p.Kv.Get(context.Background(), fmt.Sprintf("keys.%s", pk))
+	e, err := p.Kv.Get(context.Background(), fmt.Sprintf("%s.%s", KeysPrefix, pk))
 	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return nil, nil
+		}
 		return nil, err
 	}
 	if e == nil {
 		return nil, nil
 	}
-	value := e.Value()
-	if p.EncryptKey != nil {
-		pk, err := p.EncryptKey.PublicKey()
-		if err != nil {
-			return nil, err
-		}
-		value, err = p.EncryptKey.Open(value, pk)
-		if err != nil {
-			return nil, err
-		}
+	seed, err := open(p.EncryptKey, e.Value())
+	if err != nil {
+		return nil, err
 	}
-	seed := string(value)
-	return ab.KeyFrom(seed)
+	return ab.KeyFrom(string(seed))
 }
 
 func (p *KvProvider) PutKey(key *ab.Key) error {
-	v := key.Seed
-	if p.EncryptKey != nil {
-		pk, err := p.EncryptKey.PublicKey()
-		if err != nil {
-			return err
-		}
-		v, err = p.EncryptKey.Seal(v, pk)
-		if err != nil {
-			return err
-		}
+	v, err := seal(p.EncryptKey, key.Seed)
+	if err != nil {
+		return err
+	}
+	k := fmt.Sprintf("%s.%s", KeysPrefix, key.Public)
+	rev, err := p.Kv.Create(context.Background(), k, v)
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		// the seed of a public key doesn't change, it is already stored
+		return nil
+	}
+	if err != nil {
+		return err
 	}
-	_, err := p.Kv.Put(context.Background(), fmt.Sprintf("keys.%s", key.Public), v)
-	return err
+	return p.checkWrite(k, rev)
 }
 
 func (p *KvProvider) DeleteKey(key string) error {
-	return p.Kv.Delete(context.Background(), fmt.Sprintf("keys.%s", key))
+	return p.Kv.Delete(context.Background(), fmt.Sprintf("%s.%s", KeysPrefix, key))
 }
 
 func (p *KvProvider) Store(operators []*ab.OperatorData) error {
@@ -358,39 +332,30 @@ func (p *KvProvider) Store(operators []*ab.OperatorData) error {
 			return err
 		}
 
-		for _, a := range o.AccountDatas {
-			if err := p.StoreAccount(a); err != nil {
+		// deletes go first so that an entity can be replaced by a new one
+		// with the same name
+		for _, a := range o.DeletedAccounts {
+			if err := p.DeleteAccount(a); err != nil {
 				return err
 			}
 			for _, u := range a.UserDatas {
-				if err := p.StoreUser(u); err != nil {
+				if err := p.DeleteUser(u); err != nil {
 					return err
 				}
 			}
+		}
+		for _, a := range o.AccountDatas {
+			if err := p.StoreAccount(a); err != nil {
+				return err
+			}
 			for _, u := range a.DeletedUsers {
 				if err := p.DeleteUser(u); err != nil {
 					return err
 				}
 			}
 			a.DeletedUsers = nil
-		}
-
-		for _, k := range o.AddedKeys {
-			if err := p.PutKey(k); err != nil {
-				return err
-			}
-		}
-		for _, k := range o.DeletedKeys {
-			if err := p.DeleteKey(k); err != nil {
-				return err
-			}
-		}
-		for _, a := range o.DeletedAccounts {
-			if err := p.DeleteAccount(a); err != nil {
-				return err
-			}
 			for _, u := range a.UserDatas {
-				if err := p.DeleteUser(u); err != nil {
+				if err := p.StoreUser(u); err != nil {
 					return err
 				}
 			}
@@ -400,54 +365,55 @@ func (p *KvProvider) Store(operators []*ab.OperatorData) error {
 }
 
 func (p *KvProvider) StoreOperator(o *ab.OperatorData) error {
-	if o.Loaded > 0 && o.Loaded > o.Claim.IssuedAt {
+	if o.Loaded > 0 && (o.Loaded > o.Claim.IssuedAt || !o.Modified()) {
 		return nil
 	}
-	_, err := p.Kv.Put(context.Background(), fmt.Sprintf("%s.%s", OperatorPrefix, o.Subject()), []byte(o.Token))
-	if err != nil {
+	key := fmt.Sprintf("%s.%s", OperatorPrefix, o.Subject())
+	if err := p.checkStored(key, "operator", o.EntityName, o.Loaded); err != nil {
 		return err
 	}
-	if err := p.PutKey(o.Key); err != nil {
+	if err := p.checkName(OperatorPrefix, "operator", &o.BaseData, o.Subject()); err != nil {
 		return err
 	}
-	for _, k := range o.OperatorSigningKeys {
-		if err := p.PutKey(k); err != nil {
-			return err
-		}
+	_, err := p.Kv.Put(context.Background(), key, []byte(o.Token))
+	if err != nil {
+		return err
 	}
 	o.Loaded = o.Claim.IssuedAt
 	return nil
 }
 
 func (p *KvProvider) StoreAccount(a *ab.AccountData) error {
-	if a.Loaded > 0 && a.Loaded > a.Claim.IssuedAt {
+	if a.Loaded > 0 && (a.Loaded > a.Claim.IssuedAt || !a.Modified()) {
 		return nil
 	}
-	_, err := p.Kv.Put(context.Background(),
-		fmt.Sprintf("%s.%s", a.Operator.Subject(), a.Subject()),
-		[]byte(a.Token))
-	if err != nil {
+	key := fmt.Sprintf("%s.%s", a.Operator.Subject(), a.Subject())
+	if err := p.checkStored(key, "account", a.EntityName, a.Loaded); err != nil {
 		return err
 	}
-	if err := p.PutKey(a.Key); err != nil {
+	if err := p.checkName(a.Operator.Subject(), "account", &a.BaseData, a.Subject()); err != nil {
 		return err
 	}
-	for _, k := range a.AccountSigningKeys {
-		if err := p.PutKey(k); err != nil {
-			return err
-		}
+	_, err := p.Kv.Put(context.Background(), key, []byte(a.Token))
+	if err != nil {
+		return err
 	}
 	a.Loaded = a.Claim.IssuedAt
 	return nil
 }
 
 func (p *KvProvider) StoreUser(u *ab.UserData) error {
-	if u.Loaded > 0 && u.Loaded > u.Claim.IssuedAt {
+	if u.Loaded > 0 && (u.Loaded > u.Claim.IssuedAt || !u.Modified()) {
 		return nil
 	}
-	_, err := p.Kv.Put(context.Background(),
-		fmt.Sprintf("%s.%s", u.AccountData.Subject(), u.Subject()),
-		[]byte(u.Token))
+	key := fmt.Sprintf("%s.%s", u.AccountData.Subject(), u.Subject())
+	if err := p.checkStored(key, "user", u.EntityName, u.Loaded); err != nil {
+		return err
+	}
+	if err := p.checkName(u.AccountData.Subject(), "user", &u.BaseData, u.Subject()); err != nil {
+		return err
+	}
+	_, err := p.Kv.Put(context.Background(), key, []byte(u.Token))
 	if err != nil {
 		return err
 	}
@@ -455,6 +421,46 @@ func (p *KvProvider) StoreUser(u *ab.UserData) error {
 	return nil
 }
 
+// checkStored checks the entity stored under the key with ab.CheckStored
+func (p *KvProvider) checkStored(key string, kind string, name string, loaded int64) error {
+	e, err := p.Kv.Get(context.Background(), key)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+	return ab.CheckStored(kind, name, loaded, true, func() ([]byte, error) {
+		return e.Value(), nil
+	})
+}
+
+// checkName returns ErrAlreadyExists if a new entity has the name of another
+// entity stored under the prefix. Entities are stored by public key, so two
+// processes can otherwise add entities with the same name.
+func (p *KvProvider) checkName(prefix string, kind string, e *ab.BaseData, pk string) error {
+	if e.Loaded > 0 {
+		return nil
+	}
+	m, err := p.GetChildren(prefix)
+	if err != nil {
+		return err
+	}
+	for k, v := range m {
+		if k == pk {
+			continue
+		}
+		c, err := jwt.Decode(string(v))
+		if err != nil {
+			return err
+		}
+		if c.Claims().Name == e.EntityName {
+			return fmt.Errorf("%s %q: %w", kind, e.EntityName, ab.ErrAlreadyExists)
+		}
+	}
+	return nil
+}
+
 func (p *KvProvider) DeleteAccount(a *ab.AccountData) error {
 	return p.Kv.Delete(context.Background(), fmt.Sprintf("%s.%s", a.Operator.Subject(), a.Subject()))
 }
@@ -0,0 +1,256 @@
+package mem
+
+import (
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"sync"
+)
+
+type entity struct {
+	key   string
+	name  string
+	token string
+}
+
+type accountEntry struct {
+	entity
+	users []entity
+}
+
+type operatorEntry struct {
+	entity
+	accounts []accountEntry
+}
+
+// Snapshot is a copy of the state of a MemProvider
+type Snapshot struct {
+	operators []operatorEntry
+	keys      map[string]string
+}
+
+// operator returns the entry for the operator, adding it if not found
+func (s *Snapshot) operator(pk string) *operatorEntry {
+	for i := range s.operators {
+		if s.operators[i].key == pk {
+			return &s.operators[i]
+		}
+	}
+	s.operators = append(s.operators, operatorEntry{entity: entity{key: pk}})
+	return &s.operators[len(s.operators)-1]
+}
+
+// account returns the entry for the account, adding it if not found
+func (o *operatorEntry) account(pk string) *accountEntry {
+	for i := range o.accounts {
+		if o.accounts[i].key == pk {
+			return &o.accounts[i]
+		}
+	}
+	o.accounts = append(o.accounts, accountEntry{entity: entity{key: pk}})
+	return &o.accounts[len(o.accounts)-1]
+}
+
+func (o *operatorEntry) removeAccount(pk string) {
+	for i := range o.accounts {
+		if o.accounts[i].key == pk {
+			o.accounts = append(o.accounts[:i], o.accounts[i+1:]...)
+			return
+		}
+	}
+}
+
+// putUser adds or replaces the user
+func (a *accountEntry) putUser(u entity) {
+	for i := range a.users {
+		if a.users[i].key == u.key {
+			a.users[i] = u
+			return
+		}
+	}
+	a.users = append(a.users, u)
+}
+
+func (a *accountEntry) removeUser(pk string) {
+	for i := range a.users {
+		if a.users[i].key == pk {
+			a.users = append(a.users[:i], a.users[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Snapshot) clone() *Snapshot {
+	c := &Snapshot{keys: make(map[string]string, len(s.keys))}
+	for k, v := range s.keys {
+		c.keys[k] = v
+	}
+	c.operators = make([]operatorEntry, len(s.operators))
+	for i, o := range s.operators {
+		c.operators[i] = operatorEntry{entity: o.entity, accounts: make([]accountEntry, len(o.accounts))}
+		for j, a := range o.accounts {
+			c.operators[i].accounts[j] = accountEntry{entity: a.entity, users: append([]entity(nil), a.users...)}
+		}
+	}
+	return c
+}
+
+// MemProvider is an AuthProvider that keeps data in memory, it is useful
+// for tests and ephemeral configurations. Load and Store copy the data, so
+// edits are not visible until committed. The MemProvider is also a KeyStore.
+type MemProvider struct {
+	mu        sync.Mutex
+	state     *Snapshot
+	storeErr  error
+	storeFail int
+}
+
+func NewMemProvider() *MemProvider {
+	return &MemProvider{state: &Snapshot{keys: make(map[string]string)}}
+}
+
+// Snapshot returns a copy of the current state of the provider
+func (p *MemProvider) Snapshot() *Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state.clone()
+}
+
+// Restore sets the state of the provider to the specified Snapshot
+func (p *MemProvider) Restore(s *Snapshot) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state = s.clone()
+}
+
+// FailStore makes the next n calls to Store fail with the specified error
+// without modifying the stored entities. If n is negative, all calls fail
+// until FailStore is called with a nil error. Keys are not affected: Commit
+// writes the added keys before calling Store, so they are kept after the
+// failure, and only deletes keys after Store succeeds.
+func (p *MemProvider) FailStore(err error, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.storeErr = err
+	p.storeFail = n
+	if err == nil {
+		p.storeFail = 0
+	}
+}
+
+func (p *MemProvider) Load() ([]*authb.OperatorData, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	operators := make([]*authb.OperatorData, 0, len(p.state.operators))
+	for _, oe := range p.state.operators {
+		oc, err := jwt.DecodeOperatorClaims(oe.token)
+		if err != nil {
+			return nil, err
+		}
+		od := &authb.OperatorData{
+			BaseData: authb.BaseData{EntityName: oe.name, Loaded: oc.IssuedAt, Token: oe.token},
+			Claim:    oc,
+		}
+		for _, ae := range oe.accounts {
+			ac, err := jwt.DecodeAccountClaims(ae.token)
+			if err != nil {
+				return nil, err
+			}
+			ad := &authb.AccountData{
+				BaseData: authb.BaseData{EntityName: ae.name, Loaded: ac.IssuedAt, Token: ae.token},
+				Operator: od,
+				Claim:    ac,
+			}
+			for _, ue := range ae.users {
+				uc, err := jwt.DecodeUserClaims(ue.token)
+				if err != nil {
+					return nil, err
+				}
+				ud := &authb.UserData{
+					BaseData:    authb.BaseData{EntityName: ue.name, Loaded: uc.IssuedAt, Token: ue.token},
+					AccountData: ad,
+					Claim:       uc,
+				}
+				ud.RejectEdits = ud.IsScoped()
+				ad.UserDatas = append(ad.UserDatas, ud)
+			}
+			od.AccountDatas = append(od.AccountDatas, ad)
+		}
+		operators = append(operators, od)
+	}
+	return operators, nil
+}
+
+func (p *MemProvider) Store(operators []*authb.OperatorData) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.storeErr != nil && p.storeFail != 0 {
+		if p.storeFail > 0 {
+			p.storeFail--
+		}
+		return p.storeErr
+	}
+
+	// the operators are merged with the stored ones, like other providers
+	// the entities that are not specified are kept unless they were deleted
+	for _, o := range operators {
+		oe := p.state.operator(o.Subject())
+		oe.entity = entity{key: o.Subject(), name: o.EntityName, token: o.Token}
+		for _, a := range o.DeletedAccounts {
+			oe.removeAccount(a.Subject())
+		}
+		for _, a := range o.AccountDatas {
+			ae := oe.account(a.Subject())
+			ae.entity = entity{key: a.Subject(), name: a.EntityName, token: a.Token}
+			for _, u := range a.DeletedUsers {
+				ae.removeUser(u.Subject())
+			}
+			for _, u := range a.UserDatas {
+				ae.putUser(entity{key: u.Subject(), name: u.EntityName, token: u.Token})
+			}
+		}
+	}
+
+	for _, o := range operators {
+		o.Loaded = o.Claim.IssuedAt
+		for _, a := range o.AccountDatas {
+			a.Loaded = a.Claim.IssuedAt
+			for _, u := range a.UserDatas {
+				u.Loaded = u.Claim.IssuedAt
+			}
+			a.DeletedUsers = nil
+		}
+		o.DeletedAccounts = nil
+	}
+	return nil
+}
+
+// GetKey returns the stored key or nil if not found
+func (p *MemProvider) GetKey(pk string) (*authb.Key, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	seed, ok := p.state.keys[pk]
+	if !ok {
+		return nil, nil
+	}
+	return authb.KeyFrom(seed)
+}
+
+func (p *MemProvider) PutKey(key *authb.Key) error {
+	if key.Seed == nil {
+		return fmt.Errorf("key %s has no seed", key.Public)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.keys[key.Public] = string(key.Seed)
+	return nil
+}
+
+func (p *MemProvider) DeleteKey(pk string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.state.keys, pk)
+	return nil
+}
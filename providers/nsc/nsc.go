@@ -1,8 +1,8 @@
 package nsc
 
 import (
+	"fmt"
 	"github.com/nats-io/jwt/v2"
-	"github.com/nats-io/nkeys"
 	"github.com/nats-io/nsc/v2/cmd/store"
 	"github.com/nats-io/nsc/v2/home"
 	"github.com/synadia-io/jwt-auth-builder.go"
@@ -12,6 +12,8 @@ import (
 )
 
 // NscProvider is an AuthProvider that stores data using the nsc Store.
+// The NscProvider is also a KeyStore that stores seeds in the nsc keys
+// directory.
 type NscProvider struct {
 	storesDir string
 	keysDir   string
@@ -83,27 +85,8 @@ func (a *NscProvider) loadOperator(si store.IStore) (*authb.OperatorData, error)
 	if err != nil {
 		return nil, err
 	}
-	od := &authb.OperatorData{BaseData: authb.BaseData{EntityName: si.GetName(), Loaded: oc.IssuedAt}, Claim: oc}
-	ks := store.NewKeyStore(od.EntityName)
-	kp, err := ks.GetKeyPair(oc.Issuer)
-	if err != nil {
-		return nil, err
-	}
-	if kp != nil {
-		od.Key, _ = authb.KeyFromNkey(kp, nkeys.PrefixByteOperator)
-	}
-	if len(oc.SigningKeys) > 0 {
-		for _, sk := range oc.SigningKeys {
-			skp, _ := ks.GetKeyPair(sk)
-			if skp != nil {
-				k, _ := authb.KeyFromNkey(skp, nkeys.PrefixByteOperator)
-				if k != nil {
-					od.OperatorSigningKeys = append(od.OperatorSigningKeys, k)
-				}
-			}
-		}
-	}
-	od.AccountDatas, err = a.loadAccounts(si, ks)
+	od := &authb.OperatorData{BaseData: authb.BaseData{EntityName: si.GetName(), Loaded: oc.IssuedAt, Token: string(token)}, Claim: oc}
+	od.AccountDatas, err = a.loadAccounts(si)
 	if err != nil {
 		return nil, err
 	}
@@ -113,14 +96,14 @@ func (a *NscProvider) loadOperator(si store.IStore) (*authb.OperatorData, error)
 	return od, err
 }
 
-func (a *NscProvider) loadAccounts(si store.IStore, ks store.KeyStore) ([]*authb.AccountData, error) {
+func (a *NscProvider) loadAccounts(si store.IStore) ([]*authb.AccountData, error) {
 	var datas []*authb.AccountData
 	accountNames, err := si.ListSubContainers(store.Accounts)
 	if err != nil {
 		return nil, err
 	}
 	for _, name := range accountNames {
-		data, err := a.loadAccount(si, ks, name)
+		data, err := a.loadAccount(si, name)
 		if err != nil {
 			return nil, err
 		}
@@ -129,7 +112,7 @@ func (a *NscProvider) loadAccounts(si store.IStore, ks store.KeyStore) ([]*authb
 	return datas, nil
 }
 
-func (a *NscProvider) loadAccount(si store.IStore, ks store.KeyStore, name string) (*authb.AccountData, error) {
+func (a *NscProvider) loadAccount(si store.IStore, name string) (*authb.AccountData, error) {
 	ad := &authb.AccountData{BaseData: authb.BaseData{EntityName: name}}
 	token, err := si.ReadRawAccountClaim(name)
 	if err != nil {
@@ -141,22 +124,8 @@ func (a *NscProvider) loadAccount(si store.IStore, ks store.KeyStore, name strin
 		return nil, err
 	}
 	ad.Loaded = ad.Claim.IssuedAt
-	k, _ := ks.GetKeyPair(ad.Claim.Subject)
-	if k != nil {
-		ad.Key, _ = authb.KeyFromNkey(k, nkeys.PrefixByteAccount)
-	}
-	keys := ad.Claim.SigningKeys.Keys()
-	for _, k := range keys {
-		skp, _ := ks.GetKeyPair(k)
-		if skp != nil {
-			sk, _ := authb.KeyFromNkey(skp, nkeys.PrefixByteOperator)
-			if sk != nil {
-				ad.AccountSigningKeys = append(ad.AccountSigningKeys, sk)
-			}
-		}
-	}
 
-	ad.UserDatas, err = a.loadUsers(si, ks, name)
+	ad.UserDatas, err = a.loadUsers(si, name)
 	if err != nil {
 		return nil, err
 	}
@@ -168,14 +137,14 @@ func (a *NscProvider) loadAccount(si store.IStore, ks store.KeyStore, name strin
 	return ad, err
 }
 
-func (a *NscProvider) loadUsers(si store.IStore, ks store.KeyStore, account string) ([]*authb.UserData, error) {
+func (a *NscProvider) loadUsers(si store.IStore, account string) ([]*authb.UserData, error) {
 	var datas []*authb.UserData
 	names, err := si.ListEntries(store.Accounts, account, store.Users)
 	if err != nil {
 		return nil, err
 	}
 	for _, name := range names {
-		data, err := a.loadUser(si, ks, account, name)
+		data, err := a.loadUser(si, account, name)
 		if err != nil {
 			return nil, err
 		}
@@ -184,7 +153,7 @@ func (a *NscProvider) loadUsers(si store.IStore, ks store.KeyStore, account stri
 	return datas, nil
 }
 
-func (a *NscProvider) loadUser(si store.IStore, ks store.KeyStore, account string, name string) (*authb.UserData, error) {
+func (a *NscProvider) loadUser(si store.IStore, account string, name string) (*authb.UserData, error) {
 	var err error
 	ud := &authb.UserData{BaseData: authb.BaseData{EntityName: name}}
 	token, err := si.ReadRawUserClaim(account, name)
@@ -197,85 +166,107 @@ func (a *NscProvider) loadUser(si store.IStore, ks store.KeyStore, account strin
 		return nil, err
 	}
 	ud.Loaded = ud.Claim.IssuedAt
-	kp, err := ks.GetKeyPair(ud.Claim.Subject)
-	if err != nil {
-		return nil, err
-	}
-	ud.Key, err = authb.KeyFromNkey(kp, nkeys.PrefixByteUser)
-	if err != nil {
-		return nil, err
-	}
 	return ud, nil
 }
 
 func (a *NscProvider) Store(operators []*authb.OperatorData) error {
 	for _, o := range operators {
 		var err error
-		ks := store.NewKeyStore(o.EntityName)
-
 		if o.Loaded == 0 {
+			if _, err := os.Stat(filepath.Join(a.storesDir, o.EntityName)); err == nil {
+				return fmt.Errorf("operator %q: %w", o.EntityName, authb.ErrAlreadyExists)
+			}
 			nk := &store.NamedKey{Name: o.EntityName, KP: o.Key.Pair}
 			_, err = store.CreateStore("", a.storesDir, nk)
 			if err != nil {
 				return err
 			}
-			_, err = ks.Store(o.Key.Pair)
-			if err != nil {
-				return err
-			}
 		}
 		s, err := a.loadStore(o.EntityName)
 		if err != nil {
 			return err
 		}
 		// if the operator changed configuration save it
-		if o.Claim.IssuedAt > o.Loaded {
-			if err := s.StoreRaw([]byte(o.Token)); err != nil {
+		if o.Claim.IssuedAt > o.Loaded || o.Modified() {
+			// a new operator was just created in its own store
+			if err := authb.CheckStored("operator", o.EntityName, o.Loaded, o.Loaded > 0, s.ReadRawOperatorClaim); err != nil {
 				return err
 			}
-		}
-		// this will save all keys that were added, operator, account, users..
-		for _, k := range o.AddedKeys {
-			_, err := ks.Store(k.Pair)
-			if err != nil {
+			if err := s.StoreRaw([]byte(o.Token)); err != nil {
 				return err
 			}
 		}
-		o.AddedKeys = nil
-		// this will remove all keys that were added, operator, account, users..
-		for _, k := range o.DeletedKeys {
-			err := ks.Remove(k)
-			if err != nil {
+		for _, account := range o.DeletedAccounts {
+			if err := os.RemoveAll(s.Resolve(store.Accounts, account.EntityName)); err != nil {
 				return err
 			}
 		}
-		o.DeletedKeys = nil
-
+		o.DeletedAccounts = nil
 		for _, account := range o.AccountDatas {
-			if account.Claim.IssuedAt > account.Loaded {
+			if account.Claim.IssuedAt > account.Loaded || account.Modified() {
+				err := authb.CheckStored("account", account.EntityName, account.Loaded, s.HasAccount(account.EntityName), func() ([]byte, error) {
+					return s.ReadRawAccountClaim(account.EntityName)
+				})
+				if err != nil {
+					return err
+				}
 				if err := s.StoreRaw([]byte(account.Token)); err != nil {
 					return err
 				}
 				// check that signing keys were not modified
 				account.Loaded = account.Claim.IssuedAt
-
-				for _, u := range account.UserDatas {
-					if u.Claim.IssuedAt > u.Loaded {
-						if err := s.StoreRaw([]byte(u.Token)); err != nil {
-							return err
-						}
-						u.Loaded = u.Claim.IssuedAt
-					}
-				}
 			}
+			// deletes go first so that a user can be replaced by a new one with
+			// the same name
 			for _, u := range account.DeletedUsers {
+				// users deleted before they were stored have no file
+				if !s.Has(store.Accounts, account.EntityName, store.Users, store.JwtName(u.EntityName)) {
+					continue
+				}
 				if err := s.Delete(store.Accounts, account.EntityName, store.Users, store.JwtName(u.EntityName)); err != nil {
 					return err
 				}
 			}
+			account.DeletedUsers = nil
+			for _, u := range account.UserDatas {
+				if u.Claim.IssuedAt > u.Loaded || u.Modified() {
+					has := s.Has(store.Accounts, account.EntityName, store.Users, store.JwtName(u.EntityName))
+					err := authb.CheckStored("user", u.EntityName, u.Loaded, has, func() ([]byte, error) {
+						return s.ReadRawUserClaim(account.EntityName, u.EntityName)
+					})
+					if err != nil {
+						return err
+					}
+					if err := s.StoreRaw([]byte(u.Token)); err != nil {
+						return err
+					}
+					u.Loaded = u.Claim.IssuedAt
+				}
+			}
 		}
 		// update the loaded so that other mods can be detected
 		o.Loaded = o.Claim.IssuedAt
 	}
 	return nil
 }
+
+// GetKey returns the key from the nsc keys directory or nil if not found
+func (a *NscProvider) GetKey(pk string) (*authb.Key, error) {
+	ks := store.NewKeyStore("")
+	kp, err := ks.GetKeyPair(pk)
+	if err != nil || kp == nil {
+		return nil, err
+	}
+	return authb.KeyFromNkey(kp)
+}
+
+func (a *NscProvider) PutKey(key *authb.Key) error {
+	ks := store.NewKeyStore("")
+	_, err := ks.Store(key.Pair)
+	return err
+}
+
+func (a *NscProvider) DeleteKey(pk string) error {
+	ks := store.NewKeyStore("")
+	return ks.Remove(pk)
+}
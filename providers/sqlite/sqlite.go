@@ -0,0 +1,391 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS operators (
+	public_key TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	jwt        TEXT NOT NULL,
+	issued_at  INTEGER NOT NULL,
+	expires    INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS accounts (
+	public_key   TEXT PRIMARY KEY,
+	operator_key TEXT NOT NULL REFERENCES operators(public_key),
+	name         TEXT NOT NULL,
+	issuer       TEXT NOT NULL,
+	jwt          TEXT NOT NULL,
+	issued_at    INTEGER NOT NULL,
+	expires      INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS accounts_operator ON accounts(operator_key);
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_name ON accounts(operator_key, name);
+CREATE TABLE IF NOT EXISTS users (
+	public_key  TEXT PRIMARY KEY,
+	account_key TEXT NOT NULL REFERENCES accounts(public_key),
+	name        TEXT NOT NULL,
+	issuer      TEXT NOT NULL,
+	jwt         TEXT NOT NULL,
+	issued_at   INTEGER NOT NULL,
+	expires     INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS users_account ON users(account_key);
+CREATE UNIQUE INDEX IF NOT EXISTS users_name ON users(account_key, name);
+CREATE TABLE IF NOT EXISTS signing_keys (
+	public_key TEXT PRIMARY KEY,
+	owner_key  TEXT NOT NULL,
+	scoped     INTEGER NOT NULL,
+	role       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS signing_keys_owner ON signing_keys(owner_key);
+CREATE TABLE IF NOT EXISTS seeds (
+	public_key TEXT PRIMARY KEY,
+	seed       BLOB NOT NULL,
+	encrypted  INTEGER NOT NULL
+);
+`
+
+// SqlProvider is an AuthProvider that stores data in normalized tables in
+// a SQLite database, so the entities can be queried with SQL:
+// operators - one row per operator JWT
+// accounts - one row per account JWT, referencing its operator
+// users - one row per user JWT, referencing its account
+// signing_keys - the signing keys of operators and accounts, with their scope role
+// seeds - the seeds for all keys
+// Each call to Store is performed in a single transaction. The SqlProvider
+// is also a KeyStore. If an optional encryption key (an nkey CurveKeys) is
+// used, the seeds are encrypted and require the same key to be decrypted.
+// Seeds are not written in the Store transaction: PutKey and DeleteKey
+// are applied immediately. Commit writes added seeds before Store, and
+// deletes seeds after it succeeds, so a Store that is rolled back can leave
+// seeds that no entity references, but never removes a referenced seed.
+type SqlProvider struct {
+	Db         *sql.DB
+	EncryptKey nkeys.KeyPair
+}
+
+// Open opens or creates the SQLite database at the specified path
+func Open(path string, encrypt string) (*SqlProvider, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)", path))
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewSqlProvider(db, encrypt)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewSqlProvider creates a provider using the database, creating the
+// tables if needed
+func NewSqlProvider(db *sql.DB, encrypt string) (*SqlProvider, error) {
+	p := &SqlProvider{Db: db}
+	if encrypt != "" {
+		kp, err := nkeys.FromCurveSeed([]byte(encrypt))
+		if err != nil {
+			return nil, err
+		}
+		p.EncryptKey = kp
+	}
+	if _, err := db.Exec(schema); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *SqlProvider) Close() error {
+	return p.Db.Close()
+}
+
+type row struct {
+	parent string
+	name   string
+	token  string
+}
+
+func queryRows(db *sql.DB, query string) ([]row, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var v []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.parent, &r.name, &r.token); err != nil {
+			return nil, err
+		}
+		v = append(v, r)
+	}
+	return v, rows.Err()
+}
+
+func (p *SqlProvider) Load() ([]*authb.OperatorData, error) {
+	ors, err := queryRows(p.Db, "SELECT '', name, jwt FROM operators ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	ars, err := queryRows(p.Db, "SELECT operator_key, name, jwt FROM accounts ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	urs, err := queryRows(p.Db, "SELECT account_key, name, jwt FROM users ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+
+	operators := make([]*authb.OperatorData, 0, len(ors))
+	om := make(map[string]*authb.OperatorData, len(ors))
+	for _, r := range ors {
+		oc, err := jwt.DecodeOperatorClaims(r.token)
+		if err != nil {
+			return nil, fmt.Errorf("error loading operator %q: %w", r.name, err)
+		}
+		od := &authb.OperatorData{
+			BaseData: authb.BaseData{EntityName: r.name, Loaded: oc.IssuedAt, Token: r.token},
+			Claim:    oc,
+		}
+		om[oc.Subject] = od
+		operators = append(operators, od)
+	}
+	am := make(map[string]*authb.AccountData, len(ars))
+	for _, r := range ars {
+		od, ok := om[r.parent]
+		if !ok {
+			return nil, fmt.Errorf("error loading account %q: operator %s not found", r.name, r.parent)
+		}
+		ac, err := jwt.DecodeAccountClaims(r.token)
+		if err != nil {
+			return nil, fmt.Errorf("error loading account %q: %w", r.name, err)
+		}
+		ad := &authb.AccountData{
+			BaseData: authb.BaseData{EntityName: r.name, Loaded: ac.IssuedAt, Token: r.token},
+			Operator: od,
+			Claim:    ac,
+		}
+		am[ac.Subject] = ad
+		od.AccountDatas = append(od.AccountDatas, ad)
+	}
+	for _, r := range urs {
+		ad, ok := am[r.parent]
+		if !ok {
+			return nil, fmt.Errorf("error loading user %q: account %s not found", r.name, r.parent)
+		}
+		uc, err := jwt.DecodeUserClaims(r.token)
+		if err != nil {
+			return nil, fmt.Errorf("error loading user %q: %w", r.name, err)
+		}
+		ud := &authb.UserData{
+			BaseData:    authb.BaseData{EntityName: r.name, Loaded: uc.IssuedAt, Token: r.token},
+			AccountData: ad,
+			Claim:       uc,
+		}
+		ud.RejectEdits = ud.IsScoped()
+		ad.UserDatas = append(ad.UserDatas, ud)
+	}
+	return operators, nil
+}
+
+// modified returns true if the entity needs to be stored
+func modified(e *authb.BaseData, issuedAt int64) bool {
+	return e.Loaded == 0 || issuedAt > e.Loaded || e.Modified()
+}
+
+// checkUnique returns ErrAlreadyExists if the error is a violation of the
+// unique names of the accounts or users, which another process can store
+// since the entities were loaded
+func checkUnique(err error, kind string, name string) error {
+	var se *sqlite.Error
+	if errors.As(err, &se) && se.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return fmt.Errorf("%s %q: %w", kind, name, authb.ErrAlreadyExists)
+	}
+	return err
+}
+
+func (p *SqlProvider) Store(operators []*authb.OperatorData) error {
+	tx, err := p.Db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, o := range operators {
+		if err := storeOperator(tx, o); err != nil {
+			return err
+		}
+		for _, a := range o.DeletedAccounts {
+			if err := deleteAccount(tx, a.Subject()); err != nil {
+				return err
+			}
+		}
+		for _, a := range o.AccountDatas {
+			if err := storeAccount(tx, a); err != nil {
+				return err
+			}
+			for _, u := range a.DeletedUsers {
+				if _, err := tx.Exec("DELETE FROM users WHERE public_key = ?", u.Subject()); err != nil {
+					return err
+				}
+			}
+			for _, u := range a.UserDatas {
+				if err := storeUser(tx, u); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// only update the entities once the transaction succeeded
+	for _, o := range operators {
+		o.Loaded = o.Claim.IssuedAt
+		for _, a := range o.AccountDatas {
+			a.Loaded = a.Claim.IssuedAt
+			for _, u := range a.UserDatas {
+				u.Loaded = u.Claim.IssuedAt
+			}
+			a.DeletedUsers = nil
+		}
+		o.DeletedAccounts = nil
+	}
+	return nil
+}
+
+func storeSigningKeys(tx *sql.Tx, owner string, keys jwt.SigningKeys) error {
+	if _, err := tx.Exec("DELETE FROM signing_keys WHERE owner_key = ?", owner); err != nil {
+		return err
+	}
+	for k, scope := range keys {
+		scoped, role := 0, ""
+		if us, ok := scope.(*jwt.UserScope); ok && us != nil {
+			scoped, role = 1, us.Role
+		}
+		if _, err := tx.Exec("INSERT INTO signing_keys(public_key, owner_key, scoped, role) VALUES(?, ?, ?, ?)",
+			k, owner, scoped, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func storeOperator(tx *sql.Tx, o *authb.OperatorData) error {
+	if !modified(&o.BaseData, o.Claim.IssuedAt) {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT INTO operators(public_key, name, jwt, issued_at, expires) VALUES(?, ?, ?, ?, ?)
+		ON CONFLICT(public_key) DO UPDATE SET name = excluded.name, jwt = excluded.jwt,
+		issued_at = excluded.issued_at, expires = excluded.expires`,
+		o.Subject(), o.EntityName, o.Token, o.Claim.IssuedAt, o.Claim.Expires)
+	if err != nil {
+		return err
+	}
+	keys := make(jwt.SigningKeys)
+	for _, k := range o.Claim.SigningKeys {
+		keys.Add(k)
+	}
+	return storeSigningKeys(tx, o.Subject(), keys)
+}
+
+func storeAccount(tx *sql.Tx, a *authb.AccountData) error {
+	if !modified(&a.BaseData, a.Claim.IssuedAt) {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT INTO accounts(public_key, operator_key, name, issuer, jwt, issued_at, expires) VALUES(?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(public_key) DO UPDATE SET operator_key = excluded.operator_key, name = excluded.name,
+		issuer = excluded.issuer, jwt = excluded.jwt, issued_at = excluded.issued_at, expires = excluded.expires`,
+		a.Subject(), a.Operator.Subject(), a.EntityName, a.Claim.Issuer, a.Token, a.Claim.IssuedAt, a.Claim.Expires)
+	if err != nil {
+		return checkUnique(err, "account", a.EntityName)
+	}
+	return storeSigningKeys(tx, a.Subject(), a.Claim.SigningKeys)
+}
+
+func storeUser(tx *sql.Tx, u *authb.UserData) error {
+	if !modified(&u.BaseData, u.Claim.IssuedAt) {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT INTO users(public_key, account_key, name, issuer, jwt, issued_at, expires) VALUES(?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(public_key) DO UPDATE SET account_key = excluded.account_key, name = excluded.name,
+		issuer = excluded.issuer, jwt = excluded.jwt, issued_at = excluded.issued_at, expires = excluded.expires`,
+		u.Subject(), u.AccountData.Subject(), u.EntityName, u.Claim.Issuer, u.Token, u.Claim.IssuedAt, u.Claim.Expires)
+	return checkUnique(err, "user", u.EntityName)
+}
+
+func deleteAccount(tx *sql.Tx, pk string) error {
+	if _, err := tx.Exec("DELETE FROM users WHERE account_key = ?", pk); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM signing_keys WHERE owner_key = ?", pk); err != nil {
+		return err
+	}
+	_, err := tx.Exec("DELETE FROM accounts WHERE public_key = ?", pk)
+	return err
+}
+
+// GetKey returns the key from the seeds table or nil if not found
+func (p *SqlProvider) GetKey(pk string) (*authb.Key, error) {
+	var seed []byte
+	var encrypted bool
+	err := p.Db.QueryRow("SELECT seed, encrypted FROM seeds WHERE public_key = ?", pk).Scan(&seed, &encrypted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if encrypted {
+		if p.EncryptKey == nil {
+			return nil, fmt.Errorf("seed for %s is encrypted", pk)
+		}
+		xpk, err := p.EncryptKey.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		seed, err = p.EncryptKey.Open(seed, xpk)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return authb.KeyFrom(string(seed))
+}
+
+func (p *SqlProvider) PutKey(key *authb.Key) error {
+	if key.Seed == nil {
+		return fmt.Errorf("key %s has no seed", key.Public)
+	}
+	v := key.Seed
+	if p.EncryptKey != nil {
+		xpk, err := p.EncryptKey.PublicKey()
+		if err != nil {
+			return err
+		}
+		v, err = p.EncryptKey.Seal(v, xpk)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := p.Db.Exec(`INSERT INTO seeds(public_key, seed, encrypted) VALUES(?, ?, ?)
+		ON CONFLICT(public_key) DO UPDATE SET seed = excluded.seed, encrypted = excluded.encrypted`,
+		key.Public, v, p.EncryptKey != nil)
+	return err
+}
+
+func (p *SqlProvider) DeleteKey(pk string) error {
+	_, err := p.Db.Exec("DELETE FROM seeds WHERE public_key = ?", pk)
+	return err
+}
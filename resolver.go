@@ -0,0 +1,194 @@
+package authb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/synadia-io/jwt-auth-builder.go/internal/fileutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ResolverType is the type of a nats-server directory based account resolver
+type ResolverType string
+
+const (
+	// FullResolver stores all the account JWTs and synchronizes them
+	// with the other servers in the cluster
+	FullResolver ResolverType = "full"
+	// CacheResolver stores a limited number of account JWTs that are
+	// looked up from a full resolver
+	CacheResolver ResolverType = "cache"
+)
+
+// ResolverOptions configures the generation of a server configuration
+// that uses a directory based account resolver
+type ResolverOptions struct {
+	// Type is the resolver type, defaults to FullResolver
+	Type ResolverType
+	// Dir is the directory where the server stores the account JWTs
+	Dir string
+	// AllowDelete enables the deletion of accounts on a full resolver
+	AllowDelete bool
+	// Interval is the interval at which a full resolver synchronizes
+	// with the other servers, 0 uses the server default
+	Interval time.Duration
+	// Limit is the maximum number of JWTs stored, 0 uses the server default
+	Limit int64
+	// TTL is the time a cache resolver keeps a JWT, 0 uses the server default
+	TTL time.Duration
+	// OperatorPath is the path to the operator JWT in the server. If not
+	// set the operator JWT is inlined in the configuration
+	OperatorPath string
+}
+
+// Resolver is the resolver section of a server configuration
+type Resolver struct {
+	Type        ResolverType `json:"type"`
+	Dir         string       `json:"dir"`
+	AllowDelete bool         `json:"allow_delete,omitempty"`
+	Interval    string       `json:"interval,omitempty"`
+	Limit       int64        `json:"limit,omitempty"`
+	TTL         string       `json:"ttl,omitempty"`
+}
+
+// ResolverConfig is a server configuration for an operator that uses
+// a directory based account resolver
+type ResolverConfig struct {
+	// Operator is the operator JWT or the path to it
+	Operator      string   `json:"operator"`
+	SystemAccount string   `json:"system_account,omitempty"`
+	Resolver      Resolver `json:"resolver"`
+	// ResolverPreload maps account public keys to their JWTs
+	ResolverPreload map[string]string `json:"resolver_preload,omitempty"`
+
+	names map[string]string
+}
+
+func (o *OperatorData) ResolverConfig(opts ResolverOptions) (*ResolverConfig, error) {
+	if opts.Type == "" {
+		opts.Type = FullResolver
+	}
+	if opts.Dir == "" {
+		return nil, errors.New("resolver dir is required")
+	}
+	r := Resolver{Type: opts.Type, Dir: opts.Dir, Limit: opts.Limit}
+	switch opts.Type {
+	case FullResolver:
+		if opts.TTL != 0 {
+			return nil, errors.New("full resolver doesn't accept a ttl")
+		}
+		r.AllowDelete = opts.AllowDelete
+		if opts.Interval != 0 {
+			r.Interval = opts.Interval.String()
+		}
+	case CacheResolver:
+		if opts.AllowDelete || opts.Interval != 0 {
+			return nil, errors.New("cache resolver doesn't accept allow_delete or interval")
+		}
+		if opts.TTL != 0 {
+			r.TTL = opts.TTL.String()
+		}
+	default:
+		return nil, fmt.Errorf("unsupported resolver type %q", opts.Type)
+	}
+	if o.Token == "" {
+		return nil, errors.New("operator has no JWT")
+	}
+
+	c := &ResolverConfig{
+		Operator:        o.Token,
+		SystemAccount:   o.Claim.SystemAccount,
+		Resolver:        r,
+		ResolverPreload: make(map[string]string),
+		names:           map[string]string{o.Claim.Subject: o.EntityName},
+	}
+	if opts.OperatorPath != "" {
+		c.Operator = opts.OperatorPath
+	}
+	for _, a := range o.AccountDatas {
+		c.ResolverPreload[a.Claim.Subject] = a.Token
+		c.names[a.Claim.Subject] = a.EntityName
+	}
+	return c, nil
+}
+
+// ResolverJwtExtension is the extension of the account JWTs in a resolver directory
+const ResolverJwtExtension = ".jwt"
+
+func (o *OperatorData) WriteResolverDir(dir string) error {
+	for _, a := range o.AccountDatas {
+		if a.Token == "" {
+			continue
+		}
+		fp := filepath.Join(dir, a.Claim.Subject+ResolverJwtExtension)
+		if err := fileutil.WriteFile(fp, []byte(a.Token), 0600); err != nil {
+			return err
+		}
+	}
+	for _, a := range o.PendingDeletes() {
+		if err := fileutil.Remove(filepath.Join(dir, a.Claim.Subject+ResolverJwtExtension)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSON returns the configuration in JSON format
+func (c *ResolverConfig) JSON() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// quote returns the value as a double-quoted server configuration string
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// Text returns the configuration in the nats-server configuration format
+func (c *ResolverConfig) Text() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "operator: %s\n", quote(c.Operator))
+	if c.SystemAccount != "" {
+		if n := c.names[c.SystemAccount]; n != "" {
+			fmt.Fprintf(&b, "# system account %s\n", quote(n))
+		}
+		fmt.Fprintf(&b, "system_account: %s\n", c.SystemAccount)
+	}
+
+	b.WriteString("\nresolver {\n")
+	fmt.Fprintf(&b, "  type: %s\n", c.Resolver.Type)
+	fmt.Fprintf(&b, "  dir: %s\n", quote(c.Resolver.Dir))
+	if c.Resolver.AllowDelete {
+		b.WriteString("  allow_delete: true\n")
+	}
+	if c.Resolver.Interval != "" {
+		fmt.Fprintf(&b, "  interval: %s\n", quote(c.Resolver.Interval))
+	}
+	if c.Resolver.Limit != 0 {
+		fmt.Fprintf(&b, "  limit: %d\n", c.Resolver.Limit)
+	}
+	if c.Resolver.TTL != "" {
+		fmt.Fprintf(&b, "  ttl: %s\n", quote(c.Resolver.TTL))
+	}
+	b.WriteString("}\n")
+
+	if len(c.ResolverPreload) > 0 {
+		keys := make([]string, 0, len(c.ResolverPreload))
+		for k := range c.ResolverPreload {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteString("\nresolver_preload {\n")
+		for _, k := range keys {
+			if n := c.names[k]; n != "" {
+				fmt.Fprintf(&b, "  # account %s\n", quote(n))
+			}
+			fmt.Fprintf(&b, "  %s: %s\n", k, quote(c.ResolverPreload[k]))
+		}
+		b.WriteString("}\n")
+	}
+	return []byte(b.String())
+}
@@ -1,7 +1,6 @@
 package authb
 
 import (
-	"errors"
 	"github.com/nats-io/jwt/v2"
 	"time"
 )
@@ -9,13 +8,16 @@ import (
 type UserPermissions struct {
 	rejectEdits bool
 	accountData *AccountData
-	scope       *jwt.UserScope
-	limits      *jwt.UserPermissionLimits
+	// user is set when the limits are the limits of the user
+	user   *UserData
+	scope  *jwt.UserScope
+	limits *jwt.UserPermissionLimits
 }
 
-var ErrUserIsScoped = errors.New("user is scoped")
-
 func (u *UserPermissions) update() error {
+	if u.user != nil {
+		return u.user.update()
+	}
 	if u.scope != nil {
 		u.accountData.Claim.SigningKeys[u.scope.Key] = u.scope
 	}
@@ -250,6 +252,7 @@ func (u *UserPermissions) BearerToken() bool {
 func (u *UserPermissions) ConnectionTypes() ConnectionTypes {
 	v := &ConnectionTypesImpl{}
 	v.scope = u.scope
+	v.user = u.user
 	v.limits = u.limits
 	v.accountData = u.accountData
 	return v
@@ -258,6 +261,7 @@ func (u *UserPermissions) ConnectionTypes() ConnectionTypes {
 func (u *UserPermissions) PubPermissions() Permissions {
 	v := &PermissionsImpl{pub: true}
 	v.scope = u.scope
+	v.user = u.user
 	v.limits = u.limits
 	v.accountData = u.accountData
 	return v
@@ -266,6 +270,7 @@ func (u *UserPermissions) PubPermissions() Permissions {
 func (u *UserPermissions) SubPermissions() Permissions {
 	v := &PermissionsImpl{}
 	v.scope = u.scope
+	v.user = u.user
 	v.limits = u.limits
 	v.accountData = u.accountData
 	return v
@@ -274,6 +279,7 @@ func (u *UserPermissions) SubPermissions() Permissions {
 func (u *UserPermissions) ResponsePermissions() ResponsePermissions {
 	v := &ResponsePermissionsImpl{}
 	v.scope = u.scope
+	v.user = u.user
 	v.limits = u.limits
 	v.accountData = u.accountData
 	return v
@@ -282,6 +288,7 @@ func (u *UserPermissions) ResponsePermissions() ResponsePermissions {
 func (u *UserPermissions) ConnectionSources() ConnectionSources {
 	v := &ConnectionSourcesImpl{}
 	v.scope = u.scope
+	v.user = u.user
 	v.limits = u.limits
 	v.accountData = u.accountData
 	return v
@@ -290,6 +297,7 @@ func (u *UserPermissions) ConnectionSources() ConnectionSources {
 func (u *UserPermissions) ConnectionTimes() ConnectionTimes {
 	v := &ConnectionTimesImpl{}
 	v.scope = u.scope
+	v.user = u.user
 	v.limits = u.limits
 	v.accountData = u.accountData
 	return v
@@ -328,6 +336,9 @@ func (s *ScopeImpl) Role() string {
 }
 
 func (s *ScopeImpl) SetRole(name string) error {
+	if sl := (&accountSigningKeys{data: s.accountData}).GetScopeByRole(name); sl != nil && sl.Key() != s.scope.Key {
+		return alreadyExists("scope", name)
+	}
 	s.scope.Role = name
 	return s.update()
 }
@@ -0,0 +1,143 @@
+package signer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/nats-io/nats.go"
+	"net"
+	"time"
+)
+
+type natsRemote struct {
+	nc      *nats.Conn
+	subject string
+	timeout time.Duration
+}
+
+// NewNatsRemote returns a Remote that sends requests to a signing service
+// listening on the specified NATS subject
+func NewNatsRemote(nc *nats.Conn, subject string, timeout time.Duration) Remote {
+	if subject == "" {
+		subject = DefaultSubject
+	}
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	return &natsRemote{nc: nc, subject: subject, timeout: timeout}
+}
+
+func (r *natsRemote) request(req *Request) (*Response, error) {
+	d, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	m, err := r.nc.Request(r.subject, d, r.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return parseResponse(m.Data)
+}
+
+func (r *natsRemote) Keys() ([]string, error) {
+	resp, err := r.request(&Request{Op: OpKeys})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+func (r *natsRemote) Sign(pk string, data []byte) ([]byte, error) {
+	resp, err := r.request(&Request{Op: OpSign, Key: pk, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
+
+type unixRemote struct {
+	path    string
+	timeout time.Duration
+}
+
+// NewUnixRemote returns a Remote that sends requests to a signing service
+// listening on the specified Unix socket
+func NewUnixRemote(path string, timeout time.Duration) Remote {
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	return &unixRemote{path: path, timeout: timeout}
+}
+
+func (r *unixRemote) request(req *Request) (*Response, error) {
+	d, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	c, err := net.DialTimeout("unix", r.path, r.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	if err := c.SetDeadline(time.Now().Add(r.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := c.Write(append(d, '\n')); err != nil {
+		return nil, err
+	}
+	s := bufio.NewScanner(c)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !s.Scan() {
+		if s.Err() != nil {
+			return nil, s.Err()
+		}
+		return nil, errors.New("signer closed the connection")
+	}
+	return parseResponse(s.Bytes())
+}
+
+func (r *unixRemote) Keys() ([]string, error) {
+	resp, err := r.request(&Request{Op: OpKeys})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+func (r *unixRemote) Sign(pk string, data []byte) ([]byte, error) {
+	resp, err := r.request(&Request{Op: OpSign, Key: pk, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
+
+func parseResponse(data []byte) (*Response, error) {
+	var resp Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		var err error
+		if resp.Code == CodeUnknownKey {
+			err = ErrUnknownKey
+		}
+		return nil, &remoteError{msg: resp.Error, err: err}
+	}
+	return &resp, nil
+}
+
+// remoteError is an error returned by the signing service, it wraps the
+// sentinel error matching the code of the response
+type remoteError struct {
+	msg string
+	err error
+}
+
+func (e *remoteError) Error() string {
+	return e.msg
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,141 @@
+package signer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"net"
+	"sort"
+	"sync"
+)
+
+// Server holds seeds and signs requests from clients. The Server can be
+// exposed using NATS request/reply or a Unix socket, or used directly
+// as an in-process Remote.
+type Server struct {
+	mu   sync.RWMutex
+	keys map[string]nkeys.KeyPair
+}
+
+// NewServer creates a Server that can sign with the specified keys
+func NewServer(keys ...nkeys.KeyPair) (*Server, error) {
+	s := &Server{keys: make(map[string]nkeys.KeyPair)}
+	for _, kp := range keys {
+		if err := s.Add(kp); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add adds a key to the server, the key must have a seed
+func (s *Server) Add(kp nkeys.KeyPair) error {
+	if _, err := kp.Seed(); err != nil {
+		return err
+	}
+	pk, err := kp.PublicKey()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.keys[pk] = kp
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Server) Keys() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.keys))
+	for k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *Server) Sign(pk string, data []byte) ([]byte, error) {
+	s.mu.RLock()
+	kp, ok := s.keys[pk]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, pk)
+	}
+	return kp.Sign(data)
+}
+
+// Handle processes a request
+func (s *Server) Handle(req *Request) *Response {
+	var r Response
+	var err error
+	switch req.Op {
+	case OpKeys:
+		r.Keys, err = s.Keys()
+	case OpSign:
+		r.Signature, err = s.Sign(req.Key, req.Data)
+	default:
+		err = fmt.Errorf("unknown operation %q", req.Op)
+	}
+	if err != nil {
+		r.Error = err.Error()
+		if errors.Is(err, ErrUnknownKey) {
+			r.Code = CodeUnknownKey
+		}
+	}
+	return &r
+}
+
+func (s *Server) handle(data []byte) []byte {
+	var req Request
+	var resp *Response
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp = &Response{Error: err.Error()}
+	} else {
+		resp = s.Handle(&req)
+	}
+	d, _ := json.Marshal(resp)
+	return d
+}
+
+// ServeNats handles requests sent to the specified subject. Any client able
+// to publish on the subject can request signatures, so the subject should
+// be protected with permissions.
+func (s *Server) ServeNats(nc *nats.Conn, subject string) (*nats.Subscription, error) {
+	if subject == "" {
+		subject = DefaultSubject
+	}
+	return nc.Subscribe(subject, func(m *nats.Msg) {
+		_ = m.Respond(s.handle(m.Data))
+	})
+}
+
+// ServeUnix handles requests from connections accepted by the listener
+// until the listener is closed. Requests and responses are JSON documents
+// separated by newlines.
+func (s *Server) ServeUnix(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(c)
+	}
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewScanner(c)
+	r.Buffer(make([]byte, 64*1024), 1024*1024)
+	for r.Scan() {
+		d := append(s.handle(r.Bytes()), '\n')
+		if _, err := c.Write(d); err != nil {
+			return
+		}
+	}
+}
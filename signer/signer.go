@@ -0,0 +1,145 @@
+package signer
+
+import (
+	"errors"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"sync"
+)
+
+const (
+	// DefaultSubject is the NATS subject the signer listens on by default
+	DefaultSubject = "authb.signer"
+
+	OpSign = "sign"
+	OpKeys = "keys"
+
+	// CodeUnknownKey is the error code of responses to requests for a key
+	// that the service doesn't have
+	CodeUnknownKey = "unknown_key"
+)
+
+var ErrUnknownKey = errors.New("signer doesn't have the key")
+
+// Request is a request sent to a signing service
+type Request struct {
+	// Op is the operation, either OpSign or OpKeys
+	Op string `json:"op"`
+	// Key is the public key to sign with
+	Key string `json:"key,omitempty"`
+	// Data is the data to sign
+	Data []byte `json:"data,omitempty"`
+}
+
+// Response is the response from a signing service
+type Response struct {
+	// Signature is the signature of the requested data
+	Signature []byte `json:"sig,omitempty"`
+	// Keys is the list of public keys that the service can sign with
+	Keys []string `json:"keys,omitempty"`
+	// Error is set if the request failed
+	Error string `json:"error,omitempty"`
+	// Code identifies errors that clients can check, such as CodeUnknownKey
+	Code string `json:"code,omitempty"`
+}
+
+// Remote is the interface for a signing service that holds seeds outside
+// the process. The Server is a Remote that can be used in-process as
+// a stand-in for tests.
+type Remote interface {
+	// Keys returns the public keys that the service can sign with
+	Keys() ([]string, error)
+	// Sign returns the signature of the data using the specified public key
+	Sign(pk string, data []byte) ([]byte, error)
+}
+
+type remoteSigner struct {
+	remote Remote
+	pk     string
+}
+
+// NewSigner returns an authb.Signer that signs using the specified key
+// held by the Remote
+func NewSigner(r Remote, pk string) authb.Signer {
+	return &remoteSigner{remote: r, pk: pk}
+}
+
+func (s *remoteSigner) PublicKey() string {
+	return s.pk
+}
+
+func (s *remoteSigner) Sign(data []byte) ([]byte, error) {
+	return s.remote.Sign(s.pk, data)
+}
+
+// KeyStore is an authb.KeyStore that returns keys backed by the Remote for
+// all the keys held by the Remote. All other keys are read and stored
+// using the Fallback KeyStore. Keys held by the Remote are never stored
+// or deleted by the KeyStore.
+type KeyStore struct {
+	Remote   Remote
+	Fallback authb.KeyStore
+
+	mu     sync.Mutex
+	remote map[string]bool
+}
+
+func NewKeyStore(r Remote, fallback authb.KeyStore) *KeyStore {
+	return &KeyStore{Remote: r, Fallback: fallback}
+}
+
+// Refresh reloads the list of keys held by the Remote
+func (ks *KeyStore) Refresh() error {
+	keys, err := ks.Remote.Keys()
+	if err != nil {
+		return err
+	}
+	m := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		m[k] = true
+	}
+	ks.mu.Lock()
+	ks.remote = m
+	ks.mu.Unlock()
+	return nil
+}
+
+func (ks *KeyStore) isRemote(pk string) (bool, error) {
+	ks.mu.Lock()
+	loaded := ks.remote != nil
+	ks.mu.Unlock()
+	if !loaded {
+		if err := ks.Refresh(); err != nil {
+			return false, err
+		}
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.remote[pk], nil
+}
+
+func (ks *KeyStore) GetKey(pk string) (*authb.Key, error) {
+	ok, err := ks.isRemote(pk)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return authb.KeyFromSigner(NewSigner(ks.Remote, pk))
+	}
+	return ks.Fallback.GetKey(pk)
+}
+
+func (ks *KeyStore) PutKey(key *authb.Key) error {
+	ok, err := ks.isRemote(key.Public)
+	if err != nil || ok {
+		return err
+	}
+	return ks.Fallback.PutKey(key)
+}
+
+func (ks *KeyStore) DeleteKey(pk string) error {
+	ok, err := ks.isRemote(pk)
+	if err != nil || ok {
+		return err
+	}
+	return ks.Fallback.DeleteKey(pk)
+}
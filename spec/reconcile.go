@@ -0,0 +1,832 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Action is the type of change of a Step
+type Action string
+
+const (
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
+const unset = "<unset>"
+
+// Step is a change required to bring the store to the state of the spec
+type Step struct {
+	Action Action
+	// Kind is "operator", "account", "user", "scope" or "signing key"
+	Kind string
+	// Path is the path of the entity, scopes are identified by their role
+	Path string
+	// Field is the updated field, set for updates
+	Field string
+	// From is the current value of the field, or the public key of a
+	// deleted entity
+	From string
+	// To is the value of the field in the spec
+	To string
+	// Skipped is true if the step is not applied
+	Skipped bool
+	// Reason is the reason the step is skipped
+	Reason string
+}
+
+func (s Step) String() string {
+	var b strings.Builder
+	switch s.Action {
+	case Create:
+		b.WriteString("+ ")
+	case Delete:
+		b.WriteString("- ")
+	default:
+		b.WriteString("~ ")
+	}
+	fmt.Fprintf(&b, "%s %s", s.Kind, s.Path)
+	if s.Field != "" {
+		fmt.Fprintf(&b, " %s: %s -> %s", s.Field, s.From, s.To)
+	} else if s.From != "" {
+		fmt.Fprintf(&b, " %s", s.From)
+	}
+	if s.Skipped {
+		fmt.Fprintf(&b, " (skipped: %s)", s.Reason)
+	}
+	return b.String()
+}
+
+// Plan lists the steps of a reconciliation in the order they are applied
+type Plan struct {
+	Steps []Step
+}
+
+// Pending returns the steps that are applied
+func (p *Plan) Pending() []Step {
+	var steps []Step
+	for _, s := range p.Steps {
+		if !s.Skipped {
+			steps = append(steps, s)
+		}
+	}
+	return steps
+}
+
+// Skipped returns the steps that are not applied
+func (p *Plan) Skipped() []Step {
+	var steps []Step
+	for _, s := range p.Steps {
+		if s.Skipped {
+			steps = append(steps, s)
+		}
+	}
+	return steps
+}
+
+// Empty returns true if the store is in the state of the spec
+func (p *Plan) Empty() bool {
+	return len(p.Pending()) == 0
+}
+
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, s := range p.Steps {
+		b.WriteString(s.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Options configures a Reconciler
+type Options struct {
+	// AllowKeyDeletion allows deleting accounts, users, scopes and signing
+	// keys that are not in the spec, and recreating users whose scope
+	// changed. Otherwise, these steps are planned but skipped.
+	AllowKeyDeletion bool
+}
+
+// Reconciler brings the operators of an Auth to the state of a Spec. Changes
+// are not committed, the caller should Commit the Auth after Apply, or
+// Reload it to discard the changes.
+type Reconciler struct {
+	auth authb.Auth
+	spec *Spec
+	opts Options
+}
+
+// NewReconciler creates a Reconciler for the Auth and the Spec
+func NewReconciler(auth authb.Auth, spec *Spec, opts Options) *Reconciler {
+	return &Reconciler{auth: auth, spec: spec, opts: opts}
+}
+
+// Plan returns the steps required to reconcile the Auth without changing it
+func (r *Reconciler) Plan() (*Plan, error) {
+	return r.run(false)
+}
+
+// Apply reconciles the Auth and returns the applied and skipped steps
+func (r *Reconciler) Apply() (*Plan, error) {
+	return r.run(true)
+}
+
+func (r *Reconciler) run(apply bool) (*Plan, error) {
+	if err := r.spec.Validate(); err != nil {
+		return nil, err
+	}
+	rr := &run{Reconciler: r, apply: apply, plan: &Plan{}}
+	for _, o := range r.spec.Operators {
+		rr.operator(o)
+		if rr.err != nil {
+			return nil, rr.err
+		}
+	}
+	return rr.plan, nil
+}
+
+// run is a single reconciliation. Errors are sticky, once an error is set
+// no further changes are made. When not applying, entities that would be
+// created are nil.
+type run struct {
+	*Reconciler
+	apply bool
+	plan  *Plan
+	err   error
+}
+
+// node is an entity, fields of created entities are applied without steps
+type node struct {
+	kind    string
+	path    string
+	created bool
+}
+
+func (n node) child(kind string, name string) node {
+	return node{kind: kind, path: n.path + "/" + name}
+}
+
+func (r *run) add(s Step) {
+	r.plan.Steps = append(r.plan.Steps, s)
+}
+
+func (r *run) fail(n node, err error) {
+	if r.err == nil && err != nil {
+		r.err = fmt.Errorf("%s %s: %w", n.kind, n.path, err)
+	}
+}
+
+// create records the creation of an entity and calls fn when applying
+func (r *run) create(n node, fn func() error) {
+	if r.err != nil {
+		return
+	}
+	r.add(Step{Action: Create, Kind: n.kind, Path: n.path})
+	if r.apply {
+		r.fail(n, fn())
+	}
+}
+
+// remove records the deletion of an entity holding keys, fn is only called
+// when key deletion is allowed
+func (r *run) remove(n node, key string, fn func() error) bool {
+	if r.err != nil {
+		return false
+	}
+	s := Step{Action: Delete, Kind: n.kind, Path: n.path, From: key}
+	if !r.opts.AllowKeyDeletion {
+		s.Skipped = true
+		s.Reason = "key deletion is not allowed"
+	}
+	r.add(s)
+	if r.apply && !s.Skipped {
+		r.fail(n, fn())
+	}
+	return !s.Skipped
+}
+
+// change records an update of a field and calls fn when applying
+func (r *run) change(n node, field string, from string, to string, equal bool, fn func() error) {
+	if r.err != nil || equal {
+		return
+	}
+	if !n.created {
+		r.add(Step{Action: Update, Kind: n.kind, Path: n.path, Field: field, From: from, To: to})
+	}
+	if r.apply {
+		if err := fn(); err != nil {
+			r.fail(n, fmt.Errorf("%s: %w", field, err))
+		}
+	}
+}
+
+func (r *run) set(n node, field string, from string, to string, fn func() error) {
+	r.change(n, field, from, to, from == to, fn)
+}
+
+func (r *run) setInt(n node, field string, from int64, to *int64, fn func(int64) error) {
+	if to != nil {
+		r.set(n, field, fmtInt(from), fmtInt(*to), func() error { return fn(*to) })
+	}
+}
+
+func (r *run) setBool(n node, field string, from bool, to *bool, fn func(bool) error) {
+	if to != nil {
+		r.set(n, field, strconv.FormatBool(from), strconv.FormatBool(*to), func() error { return fn(*to) })
+	}
+}
+
+func (r *run) setTime(n node, field string, from int64, to *time.Time, fn func(int64) error) {
+	if to != nil {
+		r.set(n, field, fmtTime(from), fmtTime(to.Unix()), func() error { return fn(to.Unix()) })
+	}
+}
+
+func fmtInt(v int64) string {
+	if v == jwt.NoLimit {
+		return "unlimited"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+func fmtTime(v int64) string {
+	if v == 0 {
+		return unset
+	}
+	return time.Unix(v, 0).UTC().Format(time.RFC3339)
+}
+
+func fmtList(v []string) string {
+	if len(v) == 0 {
+		return unset
+	}
+	return strings.Join(v, ",")
+}
+
+func (r *run) operator(s Operator) {
+	n := node{kind: "operator", path: s.Name}
+	o := r.auth.Operators().Get(s.Name)
+	if o == nil {
+		r.create(n, func() error {
+			var err error
+			o, err = r.auth.Operators().Add(s.Name)
+			return err
+		})
+		n.created = true
+	}
+	if o != nil {
+		if s.AccountServerURL != nil {
+			r.set(n, "account_server_url", o.AccountServerURL(), *s.AccountServerURL, func() error {
+				return o.SetAccountServerURL(*s.AccountServerURL)
+			})
+		}
+		if s.ServiceURLs != nil {
+			r.set(n, "service_urls", fmtList(o.OperatorServiceURLs()), fmtList(s.ServiceURLs), func() error {
+				return o.SetOperatorServiceURL(s.ServiceURLs...)
+			})
+		}
+		r.setTime(n, "expiry", o.Expiry(), s.Expiry, o.SetExpiry)
+	}
+	if s.SigningKeys != nil {
+		var have []string
+		var add func() (string, error)
+		var del func(string) (bool, error)
+		if o != nil {
+			// keep the keys that issued accounts
+			used := make(map[string]bool)
+			for _, a := range o.Accounts().List() {
+				used[a.Issuer()] = true
+			}
+			have = byUse(o.SigningKeys().List(), used)
+			add, del = o.SigningKeys().Add, o.SigningKeys().Delete
+		}
+		r.signingKeys(n, have, *s.SigningKeys, add, del)
+	}
+
+	if s.Accounts != nil {
+		created := make(map[string]bool)
+		for _, as := range s.Accounts {
+			var a authb.Account
+			if o != nil {
+				a = o.Accounts().Get(as.Name)
+			}
+			if a == nil {
+				r.create(n.child("account", as.Name), func() error {
+					_, err := o.Accounts().Add(as.Name)
+					return err
+				})
+				created[as.Name] = true
+			}
+		}
+		// accounts are reconciled after all are created so imports resolve
+		for _, as := range s.Accounts {
+			an := n.child("account", as.Name)
+			an.created = created[as.Name]
+			r.account(o, an, as)
+		}
+	}
+
+	if s.SystemAccount != "" && o != nil {
+		from := unset
+		if sys := o.SystemAccount(); sys != nil {
+			from = sys.Name()
+		}
+		r.set(n, "system_account", from, s.SystemAccount, func() error {
+			a := o.Accounts().Get(s.SystemAccount)
+			if a == nil {
+				return fmt.Errorf("account %q: %w", s.SystemAccount, authb.ErrNotFound)
+			}
+			return o.SetSystemAccount(a)
+		})
+	}
+
+	if s.Accounts != nil && o != nil {
+		listed := make(map[string]bool)
+		for _, as := range s.Accounts {
+			listed[as.Name] = true
+		}
+		sys := o.SystemAccount()
+		for _, a := range o.Accounts().List() {
+			if listed[a.Name()] || r.err != nil {
+				continue
+			}
+			an := n.child("account", a.Name())
+			if sys != nil && sys.Subject() == a.Subject() {
+				r.add(Step{Action: Delete, Kind: an.kind, Path: an.path, From: a.Subject(), Skipped: true,
+					Reason: "the system account can't be deleted"})
+				continue
+			}
+			name := a.Name()
+			r.remove(an, a.Subject(), func() error {
+				return o.Accounts().Delete(name)
+			})
+		}
+	}
+}
+
+// byUse sorts the keys so that used keys are first
+func byUse(keys []string, used map[string]bool) []string {
+	v := append([]string{}, keys...)
+	sort.SliceStable(v, func(i, j int) bool {
+		if used[v[i]] != used[v[j]] {
+			return used[v[i]]
+		}
+		return v[i] < v[j]
+	})
+	return v
+}
+
+// signingKeys adds or deletes signing keys until there are want keys. Keys
+// at the end of have are deleted first.
+func (r *run) signingKeys(n node, have []string, want int, add func() (string, error), del func(string) (bool, error)) {
+	kn := node{kind: "signing key", path: n.path}
+	for i := len(have); i < want; i++ {
+		r.create(kn, func() error {
+			_, err := add()
+			return err
+		})
+	}
+	for i := len(have) - 1; i >= want && i >= 0; i-- {
+		k := have[i]
+		r.remove(kn, k, func() error {
+			_, err := del(k)
+			return err
+		})
+	}
+}
+
+func (r *run) account(o authb.Operator, n node, s Account) {
+	var a authb.Account
+	var ad *authb.AccountData
+	if o != nil {
+		a = o.Accounts().Get(s.Name)
+	}
+	if a != nil {
+		ad = a.(*authb.AccountData)
+		r.setTime(n, "expiry", a.Expiry(), s.Expiry, a.SetExpiry)
+		r.accountLimits(n, a.Limits(), s.Limits)
+		r.jetStream(n, ad, s.JetStream)
+		r.exports(n, ad, s.Exports)
+		r.imports(n, o, ad, s.Imports)
+	}
+
+	if s.SigningKeys != nil {
+		var have []string
+		var add func() (string, error)
+		var del func(string) (bool, error)
+		if ad != nil {
+			// only unscoped keys are counted, the ones that issued users are kept
+			used := make(map[string]bool)
+			for _, u := range ad.UserDatas {
+				used[u.Issuer()] = true
+			}
+			for k, scope := range ad.Claim.SigningKeys {
+				if scope == nil {
+					have = append(have, k)
+				}
+			}
+			have = byUse(have, used)
+			add, del = a.ScopedSigningKeys().Add, a.ScopedSigningKeys().Delete
+		}
+		r.signingKeys(n, have, *s.SigningKeys, add, del)
+	}
+	r.scopes(n, ad, s.Scopes)
+	r.users(n, ad, s.Users)
+}
+
+func (r *run) accountLimits(n node, l authb.AccountLimits, s *AccountLimits) {
+	if s == nil {
+		return
+	}
+	r.setInt(n, "limits.connections", l.MaxConnections(), s.Connections, l.SetMaxConnections)
+	r.setInt(n, "limits.leafnode_connections", l.MaxLeafNodeConnections(), s.LeafNodeConnections, l.SetMaxLeafNodeConnections)
+	r.setInt(n, "limits.subscriptions", l.MaxSubscriptions(), s.Subscriptions, l.SetMaxSubscriptions)
+	r.setInt(n, "limits.payload", l.MaxPayload(), s.Payload, l.SetMaxPayload)
+	r.setInt(n, "limits.data", l.MaxData(), s.Data, l.SetMaxData)
+	r.setInt(n, "limits.imports", l.MaxImports(), s.Imports, l.SetMaxImports)
+	r.setInt(n, "limits.exports", l.MaxExports(), s.Exports, l.SetMaxExports)
+	r.setBool(n, "limits.wildcard_exports", l.AllowWildcardExports(), s.WildcardExports, l.SetAllowWildcardExports)
+	r.setBool(n, "limits.disallow_bearer_tokens", l.DisallowBearerTokens(), s.DisallowBearerTokens, l.SetDisallowBearerTokens)
+}
+
+func tierField(tier int8) string {
+	if tier == 0 {
+		return "jetstream"
+	}
+	return fmt.Sprintf("jetstream.R%d", tier)
+}
+
+func (r *run) setLimit(n node, field string, get func() (int64, error), to *int64, fn func(int64) error) {
+	if to == nil || r.err != nil {
+		return
+	}
+	from, err := get()
+	if err != nil {
+		r.fail(n, err)
+		return
+	}
+	r.setInt(n, field, from, to, fn)
+}
+
+// jetStream reconciles the tiers listed in the spec, tiers that are not
+// listed are removed
+func (r *run) jetStream(n node, ad *authb.AccountData, tiers []JetStreamLimits) {
+	if tiers == nil {
+		return
+	}
+	js := ad.Limits().JetStream()
+	listed := make(map[int8]bool)
+	for _, t := range tiers {
+		tier := t.Tier
+		listed[tier] = true
+		field := tierField(tier)
+		l, err := js.Get(tier)
+		if err != nil {
+			r.fail(n, err)
+			return
+		}
+		if l == nil {
+			r.set(n, field, unset, "set", func() error {
+				var err error
+				l, err = js.Add(tier)
+				return err
+			})
+			if l == nil {
+				continue
+			}
+		}
+		r.setLimit(n, field+".memory_storage", l.MaxMemoryStorage, t.MemoryStorage, l.SetMaxMemoryStorage)
+		r.setLimit(n, field+".disk_storage", l.MaxDiskStorage, t.DiskStorage, l.SetMaxDiskStorage)
+		r.setLimit(n, field+".memory_stream_size", l.MaxMemoryStreamSize, t.MemoryStreamSize, l.SetMaxMemoryStreamSize)
+		r.setLimit(n, field+".disk_stream_size", l.MaxDiskStreamSize, t.DiskStreamSize, l.SetMaxDiskStreamSize)
+		r.setLimit(n, field+".streams", l.MaxStreams, t.Streams, l.SetMaxStreams)
+		r.setLimit(n, field+".consumers", l.MaxConsumers, t.Consumers, l.SetMaxConsumers)
+		r.setLimit(n, field+".max_ack_pending", l.MaxAckPending, t.MaxAckPending, l.SetMaxAckPending)
+		if t.MaxStreamSizeRequired != nil && r.err == nil {
+			from, err := l.MaxStreamSizeRequired()
+			if err != nil {
+				r.fail(n, err)
+				return
+			}
+			r.setBool(n, field+".max_stream_size_required", from, t.MaxStreamSizeRequired, l.SetMaxStreamSizeRequired)
+		}
+	}
+
+	var existing []int8
+	if ad.Claim.Limits.JetStreamLimits != (jwt.JetStreamLimits{}) {
+		existing = append(existing, 0)
+	}
+	for k := range ad.Claim.Limits.JetStreamTieredLimits {
+		if tier, err := strconv.ParseInt(strings.TrimPrefix(k, "R"), 10, 8); err == nil {
+			existing = append(existing, int8(tier))
+		}
+	}
+	sort.Slice(existing, func(i, j int) bool { return existing[i] < existing[j] })
+	for _, tier := range existing {
+		if listed[tier] {
+			continue
+		}
+		tier := tier
+		r.set(n, tierField(tier), "set", unset, func() error {
+			_, err := js.Delete(tier)
+			return err
+		})
+	}
+}
+
+func sameJSON(a any, b any) bool {
+	da, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	db, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(da) == string(db)
+}
+
+func exportType(t string) jwt.ExportType {
+	if t == "service" {
+		return jwt.Service
+	}
+	return jwt.Stream
+}
+
+func sortedExports(exports jwt.Exports) jwt.Exports {
+	v := append(jwt.Exports{}, exports...)
+	sort.Slice(v, func(i, j int) bool {
+		if v[i].Subject != v[j].Subject {
+			return v[i].Subject < v[j].Subject
+		}
+		return v[i].Type < v[j].Type
+	})
+	return v
+}
+
+func fmtExports(exports jwt.Exports) string {
+	var v []string
+	for _, e := range sortedExports(exports) {
+		v = append(v, fmt.Sprintf("%s %s", e.Type, e.Subject))
+	}
+	return fmtList(v)
+}
+
+// exports replaces the exports of the account if they differ from the spec
+func (r *run) exports(n node, ad *authb.AccountData, exports []Export) {
+	if exports == nil {
+		return
+	}
+	want := jwt.Exports{}
+	for _, e := range exports {
+		want = append(want, &jwt.Export{
+			Name:                 e.Name,
+			Subject:              jwt.Subject(e.Subject),
+			Type:                 exportType(e.Type),
+			TokenReq:             e.TokenRequired,
+			ResponseType:         jwt.ResponseType(e.ResponseType),
+			AccountTokenPosition: e.AccountTokenPosition,
+			Info:                 jwt.Info{Description: e.Description},
+		})
+	}
+	r.change(n, "exports", fmtExports(ad.Claim.Exports), fmtExports(want),
+		sameJSON(sortedExports(ad.Claim.Exports), sortedExports(want)),
+		func() error { return ad.SetExports(want) })
+}
+
+func sortedImports(imports jwt.Imports) jwt.Imports {
+	v := append(jwt.Imports{}, imports...)
+	sort.Slice(v, func(i, j int) bool {
+		if v[i].Account != v[j].Account {
+			return v[i].Account < v[j].Account
+		}
+		if v[i].Subject != v[j].Subject {
+			return v[i].Subject < v[j].Subject
+		}
+		return v[i].Type < v[j].Type
+	})
+	return v
+}
+
+func fmtImports(imports jwt.Imports) string {
+	var v []string
+	for _, i := range sortedImports(imports) {
+		v = append(v, fmt.Sprintf("%s %s from %s", i.Type, i.Subject, i.Account))
+	}
+	return fmtList(v)
+}
+
+// imports replaces the imports of the account if they differ from the
+// spec. Accounts are resolved by name in the operator.
+func (r *run) imports(n node, o authb.Operator, ad *authb.AccountData, imports []Import) {
+	if imports == nil {
+		return
+	}
+	want := jwt.Imports{}
+	for _, i := range imports {
+		account := i.Account
+		if a := o.Accounts().Get(i.Account); a != nil {
+			account = a.Subject()
+		} else if r.apply && !nkeys.IsValidPublicAccountKey(account) {
+			r.fail(n, fmt.Errorf("import %q: account %q: %w", i.Subject, i.Account, authb.ErrNotFound))
+			return
+		}
+		want = append(want, &jwt.Import{
+			Name:         i.Name,
+			Subject:      jwt.Subject(i.Subject),
+			Account:      account,
+			Type:         exportType(i.Type),
+			LocalSubject: jwt.RenamingSubject(i.LocalSubject),
+		})
+	}
+	r.change(n, "imports", fmtImports(ad.Claim.Imports), fmtImports(want),
+		sameJSON(sortedImports(ad.Claim.Imports), sortedImports(want)),
+		func() error { return ad.SetImports(want) })
+}
+
+// scopes reconciles the scoped signing keys, scopes are matched by role
+func (r *run) scopes(n node, ad *authb.AccountData, scopes []Scope) {
+	if scopes == nil {
+		return
+	}
+	listed := make(map[string]bool)
+	for _, s := range scopes {
+		listed[s.Role] = true
+		sn := n.child("scope", s.Role)
+		var sl authb.ScopeLimits
+		if ad != nil {
+			sl = ad.ScopedSigningKeys().GetScopeByRole(s.Role)
+		}
+		if sl == nil {
+			r.create(sn, func() error {
+				var err error
+				sl, err = ad.ScopedSigningKeys().AddScope(s.Role)
+				return err
+			})
+			sn.created = true
+		}
+		if sl != nil {
+			r.userLimits(sn, sl, s.UserLimits)
+		}
+	}
+	if ad == nil {
+		return
+	}
+	var keys []string
+	for k := range ad.Claim.SigningKeys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sl, _ := ad.ScopedSigningKeys().GetScope(k)
+		if sl == nil || listed[sl.Role()] {
+			continue
+		}
+		k := k
+		r.remove(n.child("scope", sl.Role()), k, func() error {
+			_, err := ad.ScopedSigningKeys().Delete(k)
+			return err
+		})
+	}
+}
+
+// issuedBy returns true if the user is issued by the scope with the role,
+// or by an unscoped key if the role is empty
+func issuedBy(ad *authb.AccountData, u authb.User, role string, key string) bool {
+	if role == "" {
+		scope, ok := ad.ScopedSigningKeys().GetScope(u.Issuer())
+		return u.Issuer() == ad.Subject() || (ok && scope == nil)
+	}
+	return key != "" && u.Issuer() == key
+}
+
+// users reconciles the users of the account. Users issued by a different
+// scope than in the spec are recreated, as users can't be reissued by
+// another key.
+func (r *run) users(n node, ad *authb.AccountData, users []User) {
+	if users == nil {
+		return
+	}
+	listed := make(map[string]bool)
+	for _, s := range users {
+		listed[s.Name] = true
+		un := n.child("user", s.Name)
+		var u authb.User
+		key := ""
+		if ad != nil {
+			u = ad.Users().Get(s.Name)
+			if s.Scope != "" {
+				if sl := ad.ScopedSigningKeys().GetScopeByRole(s.Scope); sl != nil {
+					key = sl.Key()
+				} else if r.apply {
+					r.fail(un, fmt.Errorf("scope %q: %w", s.Scope, authb.ErrNotFound))
+					return
+				}
+			}
+		}
+		if u != nil && !issuedBy(ad, u, s.Scope, key) {
+			if !r.remove(un, u.Subject(), func() error { return ad.Users().Delete(s.Name) }) {
+				r.add(Step{Action: Create, Kind: un.kind, Path: un.path, Skipped: true,
+					Reason: "the scope changed and key deletion is not allowed"})
+				continue
+			}
+			u = nil
+		}
+		if u == nil {
+			r.create(un, func() error {
+				var err error
+				u, err = ad.Users().Add(s.Name, key)
+				return err
+			})
+			un.created = true
+			if !r.apply {
+				continue
+			}
+		}
+		if u == nil {
+			continue
+		}
+		r.setTime(un, "expiry", u.Expiry(), s.Expiry, u.SetExpiry)
+		if s.Scope == "" {
+			r.userLimits(un, u, s.UserLimits)
+		}
+	}
+	if ad == nil {
+		return
+	}
+	for _, u := range ad.Users().List() {
+		ud := u.(*authb.UserData)
+		if listed[ud.Name()] || r.err != nil {
+			continue
+		}
+		name := ud.Name()
+		r.remove(n.child("user", name), ud.Subject(), func() error {
+			return ad.Users().Delete(name)
+		})
+	}
+}
+
+func (r *run) permission(n node, field string, p authb.Permissions, s *Permission) {
+	if s == nil {
+		return
+	}
+	r.set(n, field+".allow", fmtList(p.Allow()), fmtList(s.Allow), func() error {
+		return p.SetAllow(s.Allow...)
+	})
+	r.set(n, field+".deny", fmtList(p.Deny()), fmtList(s.Deny), func() error {
+		return p.SetDeny(s.Deny...)
+	})
+}
+
+func fmtResponse(maxMessages int, expires time.Duration) string {
+	if maxMessages == 0 && expires == 0 {
+		return unset
+	}
+	return fmt.Sprintf("%d msgs %s", maxMessages, expires)
+}
+
+// userLimits reconciles the limits of a user or a scope
+func (r *run) userLimits(n node, l authb.UserLimits, s UserLimits) {
+	r.setInt(n, "subscriptions", l.MaxSubscriptions(), s.Subscriptions, l.SetMaxSubscriptions)
+	r.setInt(n, "payload", l.MaxPayload(), s.Payload, l.SetMaxPayload)
+	r.setInt(n, "data", l.MaxData(), s.Data, l.SetMaxData)
+	r.setBool(n, "bearer_token", l.BearerToken(), s.BearerToken, l.SetBearerToken)
+	if s.Locale != nil {
+		r.set(n, "locale", l.Locale(), *s.Locale, func() error { return l.SetLocale(*s.Locale) })
+	}
+	if s.ConnectionTypes != nil {
+		ct := l.ConnectionTypes()
+		r.set(n, "connection_types", fmtList(ct.Types()), fmtList(s.ConnectionTypes), func() error {
+			return ct.Set(s.ConnectionTypes...)
+		})
+	}
+	if s.Sources != nil {
+		cs := l.ConnectionSources()
+		r.set(n, "sources", fmtList(cs.Sources()), fmtList(s.Sources), func() error {
+			return cs.Set(strings.Join(s.Sources, ","))
+		})
+	}
+	r.permission(n, "pub", l.PubPermissions(), s.Pub)
+	r.permission(n, "sub", l.SubPermissions(), s.Sub)
+	if s.Response != nil {
+		rp := l.ResponsePermissions()
+		from := fmtResponse(rp.MaxMessages(), rp.Expires())
+		to := fmtResponse(s.Response.MaxMessages, s.Response.Expires)
+		r.set(n, "response", from, to, func() error {
+			if to == unset {
+				return rp.Unset()
+			}
+			if err := rp.SetMaxMessages(s.Response.MaxMessages); err != nil {
+				return err
+			}
+			return rp.SetExpires(s.Response.Expires)
+		})
+	}
+}
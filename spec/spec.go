@@ -0,0 +1,253 @@
+// Package spec describes the desired state of operators, accounts and users
+// as YAML or JSON, and reconciles an Auth to that state. Specs only contain
+// names and settings, keys are created by the library and kept by the
+// KeyStore, so specs can be kept in version control.
+//
+// Fields that are not set in a spec are not managed, so an account without
+// limits keeps its current limits. Lists that are set are authoritative,
+// entries that are not listed are deleted.
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"time"
+)
+
+// Spec is the desired state of a store
+type Spec struct {
+	Operators []Operator `json:"operators" yaml:"operators"`
+}
+
+// Operator is the desired state of an operator
+type Operator struct {
+	Name string `json:"name" yaml:"name"`
+	// SigningKeys is the number of signing keys of the operator
+	SigningKeys *int `json:"signing_keys,omitempty" yaml:"signing_keys,omitempty"`
+	// SystemAccount is the name of the system account
+	SystemAccount    string     `json:"system_account,omitempty" yaml:"system_account,omitempty"`
+	AccountServerURL *string    `json:"account_server_url,omitempty" yaml:"account_server_url,omitempty"`
+	ServiceURLs      []string   `json:"service_urls,omitempty" yaml:"service_urls,omitempty"`
+	Expiry           *time.Time `json:"expiry,omitempty" yaml:"expiry,omitempty"`
+	Accounts         []Account  `json:"accounts,omitempty" yaml:"accounts,omitempty"`
+}
+
+// Account is the desired state of an account
+type Account struct {
+	Name      string            `json:"name" yaml:"name"`
+	Expiry    *time.Time        `json:"expiry,omitempty" yaml:"expiry,omitempty"`
+	Limits    *AccountLimits    `json:"limits,omitempty" yaml:"limits,omitempty"`
+	JetStream []JetStreamLimits `json:"jetstream,omitempty" yaml:"jetstream,omitempty"`
+	// SigningKeys is the number of signing keys without a scope
+	SigningKeys *int     `json:"signing_keys,omitempty" yaml:"signing_keys,omitempty"`
+	Scopes      []Scope  `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+	Exports     []Export `json:"exports,omitempty" yaml:"exports,omitempty"`
+	Imports     []Import `json:"imports,omitempty" yaml:"imports,omitempty"`
+	Users       []User   `json:"users,omitempty" yaml:"users,omitempty"`
+}
+
+// AccountLimits are the NATS limits of an account, -1 is unlimited
+type AccountLimits struct {
+	Connections          *int64 `json:"connections,omitempty" yaml:"connections,omitempty"`
+	LeafNodeConnections  *int64 `json:"leafnode_connections,omitempty" yaml:"leafnode_connections,omitempty"`
+	Subscriptions        *int64 `json:"subscriptions,omitempty" yaml:"subscriptions,omitempty"`
+	Payload              *int64 `json:"payload,omitempty" yaml:"payload,omitempty"`
+	Data                 *int64 `json:"data,omitempty" yaml:"data,omitempty"`
+	Imports              *int64 `json:"imports,omitempty" yaml:"imports,omitempty"`
+	Exports              *int64 `json:"exports,omitempty" yaml:"exports,omitempty"`
+	WildcardExports      *bool  `json:"wildcard_exports,omitempty" yaml:"wildcard_exports,omitempty"`
+	DisallowBearerTokens *bool  `json:"disallow_bearer_tokens,omitempty" yaml:"disallow_bearer_tokens,omitempty"`
+}
+
+// JetStreamLimits are the JetStream limits of a tier, -1 is unlimited.
+// Tier 0 is the default tier.
+type JetStreamLimits struct {
+	Tier                  int8   `json:"tier" yaml:"tier"`
+	MemoryStorage         *int64 `json:"memory_storage,omitempty" yaml:"memory_storage,omitempty"`
+	DiskStorage           *int64 `json:"disk_storage,omitempty" yaml:"disk_storage,omitempty"`
+	MemoryStreamSize      *int64 `json:"memory_stream_size,omitempty" yaml:"memory_stream_size,omitempty"`
+	DiskStreamSize        *int64 `json:"disk_stream_size,omitempty" yaml:"disk_stream_size,omitempty"`
+	MaxStreamSizeRequired *bool  `json:"max_stream_size_required,omitempty" yaml:"max_stream_size_required,omitempty"`
+	Streams               *int64 `json:"streams,omitempty" yaml:"streams,omitempty"`
+	Consumers             *int64 `json:"consumers,omitempty" yaml:"consumers,omitempty"`
+	MaxAckPending         *int64 `json:"max_ack_pending,omitempty" yaml:"max_ack_pending,omitempty"`
+}
+
+// UserLimits are the limits and permissions of a user or a scope
+type UserLimits struct {
+	Subscriptions   *int64              `json:"subscriptions,omitempty" yaml:"subscriptions,omitempty"`
+	Payload         *int64              `json:"payload,omitempty" yaml:"payload,omitempty"`
+	Data            *int64              `json:"data,omitempty" yaml:"data,omitempty"`
+	BearerToken     *bool               `json:"bearer_token,omitempty" yaml:"bearer_token,omitempty"`
+	Locale          *string             `json:"locale,omitempty" yaml:"locale,omitempty"`
+	ConnectionTypes []string            `json:"connection_types,omitempty" yaml:"connection_types,omitempty"`
+	Sources         []string            `json:"sources,omitempty" yaml:"sources,omitempty"`
+	Pub             *Permission         `json:"pub,omitempty" yaml:"pub,omitempty"`
+	Sub             *Permission         `json:"sub,omitempty" yaml:"sub,omitempty"`
+	Response        *ResponsePermission `json:"response,omitempty" yaml:"response,omitempty"`
+}
+
+// Permission lists the subjects allowed and denied
+type Permission struct {
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+}
+
+// ResponsePermission allows responding to requests
+type ResponsePermission struct {
+	MaxMessages int           `json:"max_messages" yaml:"max_messages"`
+	Expires     time.Duration `json:"expires" yaml:"expires"`
+}
+
+// Scope is a scoped signing key, identified by its role
+type Scope struct {
+	Role       string `json:"role" yaml:"role"`
+	UserLimits `json:",inline" yaml:",inline"`
+}
+
+// Export is an export of an account
+type Export struct {
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	Subject string `json:"subject" yaml:"subject"`
+	// Type is "service" or "stream"
+	Type                 string `json:"type" yaml:"type"`
+	TokenRequired        bool   `json:"token_required,omitempty" yaml:"token_required,omitempty"`
+	ResponseType         string `json:"response_type,omitempty" yaml:"response_type,omitempty"`
+	AccountTokenPosition uint   `json:"account_token_position,omitempty" yaml:"account_token_position,omitempty"`
+	Description          string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// Import is an import from another account of the operator
+type Import struct {
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	Subject string `json:"subject" yaml:"subject"`
+	// Account is the name or public key of the exporting account
+	Account string `json:"account" yaml:"account"`
+	// Type is "service" or "stream"
+	Type         string `json:"type" yaml:"type"`
+	LocalSubject string `json:"local_subject,omitempty" yaml:"local_subject,omitempty"`
+}
+
+// User is the desired state of a user
+type User struct {
+	Name string `json:"name" yaml:"name"`
+	// Scope is the role of the scope that issues the user, if not set the
+	// user is issued by the account. Scoped users can't have limits.
+	Scope      string     `json:"scope,omitempty" yaml:"scope,omitempty"`
+	Expiry     *time.Time `json:"expiry,omitempty" yaml:"expiry,omitempty"`
+	UserLimits `json:",inline" yaml:",inline"`
+}
+
+// Load reads a spec in YAML or JSON format
+func Load(r io.Reader) (*Spec, error) {
+	d := yaml.NewDecoder(r)
+	d.KnownFields(true)
+	var s Spec
+	if err := d.Decode(&s); err != nil {
+		return nil, fmt.Errorf("error parsing spec: %w", err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// LoadFile reads a spec from a YAML or JSON file
+func LoadFile(path string) (*Spec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+func (l *UserLimits) isSet() bool {
+	return l.Subscriptions != nil || l.Payload != nil || l.Data != nil || l.BearerToken != nil ||
+		l.Locale != nil || l.ConnectionTypes != nil || l.Sources != nil || l.Pub != nil ||
+		l.Sub != nil || l.Response != nil
+}
+
+func validType(t string) bool {
+	return t == "service" || t == "stream"
+}
+
+// Validate checks that names are unique and that the spec is consistent
+func (s *Spec) Validate() error {
+	operators := make(map[string]bool)
+	for _, o := range s.Operators {
+		if o.Name == "" {
+			return errors.New("operator name is required")
+		}
+		if operators[o.Name] {
+			return fmt.Errorf("duplicate operator %q", o.Name)
+		}
+		operators[o.Name] = true
+		accounts := make(map[string]bool)
+		for _, a := range o.Accounts {
+			if a.Name == "" {
+				return fmt.Errorf("operator %q: account name is required", o.Name)
+			}
+			if accounts[a.Name] {
+				return fmt.Errorf("operator %q: duplicate account %q", o.Name, a.Name)
+			}
+			accounts[a.Name] = true
+			if err := a.validate(); err != nil {
+				return fmt.Errorf("account %s/%s: %w", o.Name, a.Name, err)
+			}
+		}
+		if o.SystemAccount != "" && o.Accounts != nil && !accounts[o.SystemAccount] {
+			return fmt.Errorf("operator %q: system account %q is not listed", o.Name, o.SystemAccount)
+		}
+	}
+	return nil
+}
+
+func (a *Account) validate() error {
+	tiers := make(map[int8]bool)
+	for _, js := range a.JetStream {
+		if js.Tier < 0 || tiers[js.Tier] {
+			return fmt.Errorf("invalid or duplicate jetstream tier %d", js.Tier)
+		}
+		tiers[js.Tier] = true
+	}
+	roles := make(map[string]bool)
+	for _, sc := range a.Scopes {
+		if sc.Role == "" || roles[sc.Role] {
+			return fmt.Errorf("scope role %q is empty or duplicate", sc.Role)
+		}
+		roles[sc.Role] = true
+	}
+	for _, e := range a.Exports {
+		if !validType(e.Type) {
+			return fmt.Errorf("export %q has invalid type %q", e.Subject, e.Type)
+		}
+	}
+	for _, i := range a.Imports {
+		if !validType(i.Type) {
+			return fmt.Errorf("import %q has invalid type %q", i.Subject, i.Type)
+		}
+		if i.Account == "" {
+			return fmt.Errorf("import %q requires an account", i.Subject)
+		}
+	}
+	users := make(map[string]bool)
+	for _, u := range a.Users {
+		if u.Name == "" || users[u.Name] {
+			return fmt.Errorf("user name %q is empty or duplicate", u.Name)
+		}
+		users[u.Name] = true
+		if u.Scope != "" {
+			if u.isSet() {
+				return fmt.Errorf("user %q is scoped and can't have limits", u.Name)
+			}
+			if a.Scopes != nil && !roles[u.Scope] {
+				return fmt.Errorf("user %q has unknown scope %q", u.Name, u.Scope)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package authb
+
+import (
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+)
+
+const (
+	// SystemAccountName is the name of the system account created by
+	// BootstrapSystemAccount
+	SystemAccountName = "SYS"
+	// SystemUserName is the name of the system user created by
+	// BootstrapSystemAccount
+	SystemUserName = "sys"
+
+	sysInfoURL = "https://docs.nats.io/nats-server/configuration/sys_accounts"
+)
+
+// systemExports returns the exports nsc adds to a system account, which
+// allow accounts to request their own monitoring information
+func systemExports() jwt.Exports {
+	return jwt.Exports{
+		&jwt.Export{
+			Name:                 "account-monitoring-services",
+			Subject:              "$SYS.REQ.ACCOUNT.*.*",
+			Type:                 jwt.Service,
+			ResponseType:         jwt.ResponseTypeStream,
+			AccountTokenPosition: 4,
+			Info: jwt.Info{
+				Description: "Request account specific monitoring services for: SUBSZ, CONNZ, LEAFZ, JSZ and INFO",
+				InfoURL:     sysInfoURL,
+			},
+		},
+		&jwt.Export{
+			Name:                 "account-monitoring-streams",
+			Subject:              "$SYS.ACCOUNT.*.>",
+			Type:                 jwt.Stream,
+			AccountTokenPosition: 3,
+			Info: jwt.Info{
+				Description: "Account specific monitoring stream",
+				InfoURL:     sysInfoURL,
+			},
+		},
+	}
+}
+
+// systemImports returns the imports of the system account monitoring
+// exports for the account
+func systemImports(sys string, account string) jwt.Imports {
+	return jwt.Imports{
+		&jwt.Import{
+			Name:    "account-monitoring-services",
+			Subject: jwt.Subject(fmt.Sprintf("$SYS.REQ.ACCOUNT.%s.*", account)),
+			Account: sys,
+			Type:    jwt.Service,
+		},
+		&jwt.Import{
+			Name:    "account-monitoring-streams",
+			Subject: jwt.Subject(fmt.Sprintf("$SYS.ACCOUNT.%s.>", account)),
+			Account: sys,
+			Type:    jwt.Stream,
+		},
+	}
+}
+
+func hasExport(exports jwt.Exports, e *jwt.Export) bool {
+	for _, v := range exports {
+		if v.Subject == e.Subject && v.Type == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+func hasImport(imports jwt.Imports, i *jwt.Import) bool {
+	for _, v := range imports {
+		if v.Subject == i.Subject && v.Account == i.Account && v.Type == i.Type {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *OperatorData) BootstrapSystemAccount() (Account, error) {
+	var sys *AccountData
+	if a := o.SystemAccount(); a != nil {
+		sys = a.(*AccountData)
+	} else if a := o.Get(SystemAccountName); a != nil {
+		sys = a.(*AccountData)
+	} else {
+		a, err := o.Add(SystemAccountName)
+		if err != nil {
+			return nil, err
+		}
+		sys = a.(*AccountData)
+	}
+
+	changed := false
+	for _, e := range systemExports() {
+		if !hasExport(sys.Claim.Exports, e) {
+			sys.Claim.Exports.Add(e)
+			changed = true
+		}
+	}
+	if changed {
+		if err := sys.update(); err != nil {
+			return nil, err
+		}
+	}
+
+	if sys.Users().Get(SystemUserName) == nil {
+		if _, err := sys.Users().Add(SystemUserName, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, a := range o.AccountDatas {
+		if a == sys {
+			continue
+		}
+		changed = false
+		for _, i := range systemImports(sys.Subject(), a.Subject()) {
+			if !hasImport(a.Claim.Imports, i) {
+				a.Claim.Imports.Add(i)
+				changed = true
+			}
+		}
+		if changed {
+			if err := a.update(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if o.Claim.SystemAccount != sys.Subject() {
+		if err := o.SetSystemAccount(sys); err != nil {
+			return nil, err
+		}
+	}
+	return sys, nil
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"github.com/nats-io/jwt/v2"
 	"github.com/stretchr/testify/require"
 	authb "github.com/synadia-io/jwt-auth-builder.go"
 	"time"
@@ -63,6 +64,33 @@ func (suite *ProviderSuite) Test_AccountsBasics() {
 	require.Equal(t, o.Subject(), a.Issuer())
 }
 
+func (suite *ProviderSuite) Test_AccountImportsExports() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	b, err := o.Accounts().Add("B")
+	require.NoError(t, err)
+
+	require.NoError(t, a.SetExports(jwt.Exports{{Subject: "q.>", Type: jwt.Service}}))
+	require.NoError(t, b.SetImports(jwt.Imports{{Subject: "q.>", Account: a.Subject(), Type: jwt.Service}}))
+	require.NoError(t, auth.Commit())
+
+	ac := suite.Store.GetAccount("O", "A")
+	require.Len(t, ac.Exports, 1)
+	require.Equal(t, jwt.Subject("q.>"), ac.Exports[0].Subject)
+	bc := suite.Store.GetAccount("O", "B")
+	require.Len(t, bc.Imports, 1)
+	require.Equal(t, a.Subject(), bc.Imports[0].Account)
+
+	// the imports and exports are replaced
+	require.NoError(t, b.SetImports(nil))
+	require.Empty(t, b.(*authb.AccountData).Claim.Imports)
+}
+
 func setupTestWithOperatorAndAccount(p *ProviderSuite) (authb.Auth, authb.Operator, authb.Account) {
 	t := p.T()
 	auth, err := authb.NewAuth(p.Provider)
@@ -382,6 +410,59 @@ func (suite *ProviderSuite) Test_SigningKeyRotation() {
 	require.Equal(t, key, u.Issuer())
 }
 
+func (suite *ProviderSuite) Test_RotatedSigningKeyIssuesUsers() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	sk, err := a.ScopedSigningKeys().Add()
+	require.NoError(t, err)
+	_, err = a.Users().Add("U", sk)
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	key, err := a.ScopedSigningKeys().Rotate(sk)
+	require.NoError(t, err)
+	v, err := a.Users().Add("V", key)
+	require.NoError(t, err)
+	require.Equal(t, key, v.Issuer())
+	require.NoError(t, auth.Commit())
+	require.NotNil(t, suite.Store.GetKey(key))
+
+	// the seed of the rotated key is loaded back
+	require.NoError(t, auth.Reload())
+	a = auth.Operators().Get("O").Accounts().Get("A")
+	_, err = a.Users().Add("W", key)
+	require.NoError(t, err)
+}
+
+func (suite *ProviderSuite) Test_SigningKeyDelete() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	sk, err := a.ScopedSigningKeys().Add()
+	require.NoError(t, err)
+
+	ok, err := a.ScopedSigningKeys().Delete(sk)
+	require.NoError(t, err)
+	require.True(t, ok)
+	// the account is reissued without the key, and the key can't sign
+	require.NotContains(t, a.(*authb.AccountData).Claim.SigningKeys, sk)
+	_, err = a.Users().Add("U", sk)
+	require.Error(t, err)
+	require.NoError(t, auth.Commit())
+
+	ac := suite.Store.GetAccount("O", "A")
+	require.NotContains(t, ac.SigningKeys, sk)
+}
+
 func (suite *ProviderSuite) Test_AccountLimits() {
 	t := suite.T()
 	auth, err := authb.NewAuth(suite.Provider)
@@ -551,3 +632,31 @@ func (suite *ProviderSuite) Test_AccountJetStreamLimits() {
 	require.NoError(t, err)
 	suite.testTier(auth, b, 1)
 }
+
+func (suite *ProviderSuite) Test_AccountNotBefore() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	nbf := time.Now().Add(time.Hour).Unix()
+	require.NoError(t, o.SetNotBefore(nbf))
+	require.Equal(t, nbf, o.NotBefore())
+	require.ErrorIs(t, o.SetExpiry(nbf-1), authb.ErrNotBeforeAfterExpiry)
+
+	require.NoError(t, a.SetNotBefore(nbf))
+	require.Equal(t, nbf, a.NotBefore())
+	require.ErrorIs(t, a.SetExpiry(nbf-1), authb.ErrNotBeforeAfterExpiry)
+	require.NoError(t, a.SetExpiry(nbf))
+	require.ErrorIs(t, a.SetNotBefore(nbf+1), authb.ErrNotBeforeAfterExpiry)
+
+	require.NoError(t, auth.Commit())
+	require.NoError(t, auth.Reload())
+	o = auth.Operators().Get("O")
+	require.Equal(t, nbf, o.NotBefore())
+	a = o.Accounts().Get("A")
+	require.Equal(t, nbf, a.NotBefore())
+	require.Equal(t, nbf, a.Expiry())
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/accountserver"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func httpGet(t *testing.T, url string) (int, string) {
+	r, err := http.Get(url)
+	require.NoError(t, err)
+	defer r.Body.Close()
+	d, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	return r.StatusCode, string(d)
+}
+
+func httpPost(t *testing.T, url string, body string) int {
+	r, err := http.Post(url, "application/jwt", strings.NewReader(body))
+	require.NoError(t, err)
+	defer r.Body.Close()
+	return r.StatusCode
+}
+
+func Test_AccountServer(t *testing.T) {
+	p := mem.NewMemProvider()
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	sk, err := o.SigningKeys().Add()
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	h, err := accountserver.NewHandler(auth, "O", accountserver.Options{AllowUpdates: true})
+	require.NoError(t, err)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	code, body := httpGet(t, ts.URL+accountserver.OperatorPath)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, o.(*authb.OperatorData).Token, body)
+
+	code, body = httpGet(t, ts.URL+accountserver.AccountsPath+a.Subject())
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, a.(*authb.AccountData).Token, body)
+
+	code, body = httpGet(t, ts.URL+accountserver.AccountsPath+a.Subject()+"?decode=true")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, `"name": "A"`)
+
+	kp, err := authb.KeyFor(nkeys.PrefixByteAccount)
+	require.NoError(t, err)
+	code, _ = httpGet(t, ts.URL+accountserver.AccountsPath+kp.Public)
+	require.Equal(t, http.StatusNotFound, code)
+	code, _ = httpGet(t, ts.URL+accountserver.AccountsPath+"bad")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	// a new account signed by the operator signing key is stored
+	signer, err := p.GetKey(sk)
+	require.NoError(t, err)
+	ac := jwt.NewAccountClaims(kp.Public)
+	ac.Name = "B"
+	token, err := ac.Encode(signer.Pair)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, httpPost(t, ts.URL+accountserver.AccountsPath+kp.Public, token))
+
+	code, body = httpGet(t, ts.URL+accountserver.AccountsPath+kp.Public)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, token, body)
+	require.NoError(t, auth.Reload())
+	b := auth.Operators().Get("O").Accounts().Get("B")
+	require.NotNil(t, b)
+	require.Equal(t, token, b.(*authb.AccountData).Token)
+
+	// the JWT must be issued by the operator
+	other, err := authb.KeyFor(nkeys.PrefixByteOperator)
+	require.NoError(t, err)
+	token, err = ac.Encode(other.Pair)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, httpPost(t, ts.URL+accountserver.AccountsPath+kp.Public, token))
+	// and match the account in the path
+	require.Equal(t, http.StatusBadRequest, httpPost(t, ts.URL+accountserver.AccountsPath+a.Subject(), token))
+
+	// updates can be disabled
+	h, err = accountserver.NewHandler(auth, "O", accountserver.Options{})
+	require.NoError(t, err)
+	ro := httptest.NewServer(h)
+	defer ro.Close()
+	token, err = ac.Encode(signer.Pair)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusMethodNotAllowed, httpPost(t, ro.URL+accountserver.AccountsPath+kp.Public, token))
+}
+
+func Test_AccountServerResolver(t *testing.T) {
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	sys, err := o.Accounts().Add("SYS")
+	require.NoError(t, err)
+	require.NoError(t, o.SetSystemAccount(sys))
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	h, err := accountserver.NewHandler(auth, "O", accountserver.Options{})
+	require.NoError(t, err)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	conf := fmt.Sprintf("operator: %q\nsystem_account: %s\nresolver: URL(%q)\n",
+		o.(*authb.OperatorData).Token, sys.Subject(), ts.URL+accountserver.AccountsPath)
+	s := StartServerWithConfig(t, []byte(conf))
+	acct, err := s.LookupAccount(a.Subject())
+	require.NoError(t, err)
+	require.Equal(t, a.Subject(), acct.Name)
+}
@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/backup"
+	"github.com/synadia-io/jwt-auth-builder.go/migrate"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"io"
+	"strings"
+	"testing"
+)
+
+func curvePublic(t *testing.T, seed string) string {
+	kp, err := nkeys.FromCurveSeed([]byte(seed))
+	require.NoError(t, err)
+	pk, err := kp.PublicKey()
+	require.NoError(t, err)
+	return pk
+}
+
+// rewriteArchive copies the archive calling fn on every file
+func rewriteArchive(t *testing.T, d []byte, fn func(name string, data []byte) []byte) []byte {
+	gr, err := gzip.NewReader(bytes.NewReader(d))
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		data = fn(hdr.Name, data)
+		hdr.Size = int64(len(data))
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return out.Bytes()
+}
+
+func Test_BackupRestore(t *testing.T) {
+	from := mem.NewMemProvider()
+	populateWithSigningKeys(t, from)
+	seed := curveSeed(t)
+
+	var buf bytes.Buffer
+	m, err := backup.Export(&buf, from, nil, curvePublic(t, seed))
+	require.NoError(t, err)
+	require.Len(t, m.Entities, 5)
+	require.Len(t, m.Keys, 7)
+
+	rm, err := backup.ReadManifest(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, m.Sender, rm.Sender)
+
+	to := mem.NewMemProvider()
+	_, err = backup.Restore(bytes.NewReader(buf.Bytes()), to, nil, seed)
+	require.NoError(t, err)
+	require.NoError(t, migrate.Verify(from, to, migrate.Options{}))
+
+	// the restored store is usable
+	auth, err := authb.NewAuth(to)
+	require.NoError(t, err)
+	a := auth.Operators().Get("O").Accounts().Get("A")
+	require.NotNil(t, a)
+	require.True(t, a.Users().Get("S").IsScoped())
+	require.NoError(t, a.Limits().SetMaxConnections(10))
+	require.NoError(t, auth.Commit())
+
+	// operators are not overwritten
+	_, err = backup.Restore(bytes.NewReader(buf.Bytes()), to, nil, seed)
+	require.Error(t, err)
+}
+
+func Test_RestoreKeepsExistingOperators(t *testing.T) {
+	from := mem.NewMemProvider()
+	populateWithSigningKeys(t, from)
+	seed := curveSeed(t)
+	var buf bytes.Buffer
+	_, err := backup.Export(&buf, from, nil, curvePublic(t, seed))
+	require.NoError(t, err)
+
+	to := mem.NewMemProvider()
+	auth, err := authb.NewAuth(to)
+	require.NoError(t, err)
+	p, err := auth.Operators().Add("P")
+	require.NoError(t, err)
+	_, err = p.Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	_, err = backup.Restore(bytes.NewReader(buf.Bytes()), to, nil, seed)
+	require.NoError(t, err)
+	require.NoError(t, auth.Reload())
+	require.Len(t, auth.Operators().List(), 2)
+	require.NotNil(t, auth.Operators().Get("P").Accounts().Get("A"))
+	require.Len(t, auth.Operators().Get("O").Accounts().List(), 2)
+
+	// migrating into the store keeps the existing operators too
+	other := mem.NewMemProvider()
+	oauth, err := authb.NewAuth(other)
+	require.NoError(t, err)
+	_, err = oauth.Operators().Add("Q")
+	require.NoError(t, err)
+	require.NoError(t, oauth.Commit())
+	_, err = migrate.Migrate(other, to, migrate.Options{})
+	require.NoError(t, err)
+	require.NoError(t, auth.Reload())
+	require.Len(t, auth.Operators().List(), 3)
+	require.Len(t, auth.Operators().Get("O").Accounts().List(), 2)
+}
+
+func Test_RestoreRequiresRecipient(t *testing.T) {
+	from := mem.NewMemProvider()
+	populateWithSigningKeys(t, from)
+
+	var buf bytes.Buffer
+	_, err := backup.Export(&buf, from, nil, curvePublic(t, curveSeed(t)))
+	require.NoError(t, err)
+
+	_, err = backup.Restore(&buf, mem.NewMemProvider(), nil, curveSeed(t))
+	require.ErrorIs(t, err, backup.ErrRecipient)
+}
+
+func Test_RestoreVerifiesChecksums(t *testing.T) {
+	from := mem.NewMemProvider()
+	populateWithSigningKeys(t, from)
+	seed := curveSeed(t)
+
+	var buf bytes.Buffer
+	_, err := backup.Export(&buf, from, nil, curvePublic(t, seed))
+	require.NoError(t, err)
+
+	tampered := rewriteArchive(t, buf.Bytes(), func(name string, data []byte) []byte {
+		if strings.HasPrefix(name, "accounts/") {
+			return append(data, '\n')
+		}
+		return data
+	})
+	to := mem.NewMemProvider()
+	_, err = backup.Restore(bytes.NewReader(tampered), to, nil, seed)
+	require.ErrorIs(t, err, backup.ErrChecksum)
+
+	operators, err := to.Load()
+	require.NoError(t, err)
+	require.Empty(t, operators)
+}
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"errors"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/callout"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCreds(t *testing.T, u authb.User) string {
+	t.Helper()
+	creds, err := u.Creds(0)
+	require.NoError(t, err)
+	fp := filepath.Join(t.TempDir(), u.Subject()+".creds")
+	require.NoError(t, os.WriteFile(fp, creds, 0600))
+	return fp
+}
+
+func connAccount(t *testing.T, s *server.Server, name string) string {
+	cz, err := s.Connz(&server.ConnzOptions{Username: true})
+	require.NoError(t, err)
+	for _, c := range cz.Conns {
+		if c.Name == name {
+			return c.Account
+		}
+	}
+	return ""
+}
+
+func testCallout(t *testing.T, encrypt bool) {
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	sys, err := o.Accounts().Add("SYS")
+	require.NoError(t, err)
+	require.NoError(t, o.SetSystemAccount(sys))
+
+	app, err := o.Accounts().Add("APP")
+	require.NoError(t, err)
+	scope, err := app.ScopedSigningKeys().AddScope("client")
+	require.NoError(t, err)
+	tmpl, err := app.Users().Add("tmpl", "")
+	require.NoError(t, err)
+	require.NoError(t, tmpl.PubPermissions().SetAllow("app.>"))
+
+	ca, err := o.Accounts().Add("AUTH")
+	require.NoError(t, err)
+	responder, err := ca.Users().Add("responder", "")
+	require.NoError(t, err)
+	sentinel, err := ca.Users().Add("sentinel", "")
+	require.NoError(t, err)
+	var xkey, xpub string
+	if encrypt {
+		xkey = curveSeed(t)
+		xpub = curvePublic(t, xkey)
+	}
+	require.NoError(t, ca.SetExternalAuthorization([]string{responder.Subject()}, []string{app.Subject()}, xpub))
+	users, accounts, xk := ca.ExternalAuthorization()
+	require.Equal(t, []string{responder.Subject()}, users)
+	require.Equal(t, []string{app.Subject()}, accounts)
+	require.Equal(t, xpub, xk)
+	require.NoError(t, auth.Commit())
+
+	c, err := o.ResolverConfig(authb.ResolverOptions{Dir: t.TempDir()})
+	require.NoError(t, err)
+	s := StartServerWithConfig(t, c.Text())
+
+	r, err := callout.NewResponder(ca, callout.Options{
+		XKey: xkey,
+		Hook: func(req *jwt.AuthorizationRequest) (*callout.Authorization, error) {
+			switch req.ConnectOptions.Username {
+			case "alice":
+				return &callout.Authorization{Account: app, ScopedKey: scope.Key(), Name: "alice"}, nil
+			case "bob":
+				return &callout.Authorization{Account: app, Template: tmpl, Name: "bob", Expiry: time.Hour}, nil
+			default:
+				return nil, errors.New("unknown user")
+			}
+		},
+	})
+	require.NoError(t, err)
+	rnc, err := nats.Connect(s.ClientURL(), nats.UserCredentials(writeCreds(t, responder)))
+	require.NoError(t, err)
+	defer rnc.Close()
+	_, err = r.Serve(rnc)
+	require.NoError(t, err)
+	require.NoError(t, rnc.Flush())
+
+	sentinelCreds := writeCreds(t, sentinel)
+	connect := func(user string) (*nats.Conn, error) {
+		return nats.Connect(s.ClientURL(),
+			nats.UserCredentials(sentinelCreds),
+			nats.UserInfo(user, "secret"),
+			nats.Name(user))
+	}
+
+	alice, err := connect("alice")
+	require.NoError(t, err)
+	defer alice.Close()
+	require.Equal(t, app.Subject(), connAccount(t, s, "alice"))
+
+	bob, err := connect("bob")
+	require.NoError(t, err)
+	defer bob.Close()
+	require.Equal(t, app.Subject(), connAccount(t, s, "bob"))
+
+	_, err = connect("eve")
+	require.Error(t, err)
+}
+
+func Test_Callout(t *testing.T) {
+	testCallout(t, false)
+}
+
+func Test_CalloutEncrypted(t *testing.T) {
+	testCallout(t, true)
+}
+
+func Test_CalloutIssue(t *testing.T) {
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	tmpl, err := a.Users().Add("tmpl", "")
+	require.NoError(t, err)
+	require.NoError(t, tmpl.SubPermissions().SetAllow("q"))
+	b, err := o.Accounts().Add("B")
+	require.NoError(t, err)
+
+	uk, err := authb.KeyFor(nkeys.PrefixByteUser)
+	require.NoError(t, err)
+	token, err := callout.Issue(uk.Public, &callout.Authorization{Account: a, Template: tmpl, Name: "u"})
+	require.NoError(t, err)
+	uc, err := jwt.DecodeUserClaims(token)
+	require.NoError(t, err)
+	require.Equal(t, uk.Public, uc.Subject)
+	require.Equal(t, a.Subject(), uc.Issuer)
+	require.Equal(t, []string{"q"}, []string(uc.Sub.Allow))
+
+	// the template must belong to the account
+	_, err = callout.Issue(uk.Public, &callout.Authorization{Account: b, Template: tmpl})
+	require.Error(t, err)
+	// the key must be a scoped key
+	_, err = callout.Issue(uk.Public, &callout.Authorization{Account: a, ScopedKey: a.Subject()})
+	require.Error(t, err)
+}
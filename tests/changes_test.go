@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"time"
+)
+
+// changeTypes returns the change type of every changed entity by path
+func changeTypes(auth authb.Auth) map[string]authb.ChangeType {
+	m := make(map[string]authb.ChangeType)
+	for _, c := range auth.Changes() {
+		m[c.Path] = c.Type
+	}
+	return m
+}
+
+func (suite *ProviderSuite) Test_ChangesAndDiscard() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	require.False(t, auth.HasChanges())
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	u, err := a.Users().Add("U", "")
+	require.NoError(t, err)
+	require.True(t, auth.HasChanges())
+	require.Equal(t, map[string]authb.ChangeType{
+		"O":     authb.ChangeAdded,
+		"O/A":   authb.ChangeAdded,
+		"O/A/U": authb.ChangeAdded,
+	}, changeTypes(auth))
+	require.Error(t, o.Discard())
+
+	require.NoError(t, auth.Commit())
+	require.False(t, auth.HasChanges())
+	require.Empty(t, auth.Changes())
+
+	// modifications are discarded
+	token := a.(*authb.AccountData).Token
+	require.NoError(t, a.SetExpiry(time.Now().Add(time.Hour).Unix()))
+	changes := auth.Changes()
+	require.Len(t, changes, 1)
+	require.Equal(t, authb.ChangeModified, changes[0].Type)
+	require.Equal(t, "account", changes[0].Kind)
+	require.Equal(t, token, changes[0].Committed)
+	require.NotEqual(t, token, changes[0].Token)
+	require.NoError(t, a.Discard())
+	require.False(t, auth.HasChanges())
+	require.Equal(t, int64(0), a.Expiry())
+	require.Equal(t, token, a.(*authb.AccountData).Token)
+
+	// added users are removed with their keys
+	v, err := a.Users().Add("V", "")
+	require.NoError(t, err)
+	require.Equal(t, map[string]authb.ChangeType{"O/A/V": authb.ChangeAdded}, changeTypes(auth))
+	require.NoError(t, v.Discard())
+	require.Nil(t, a.Users().Get("V"))
+	require.False(t, auth.HasChanges())
+
+	// deleted users are restored
+	require.NoError(t, a.Users().Delete("U"))
+	require.Equal(t, map[string]authb.ChangeType{"O/A/U": authb.ChangeDeleted}, changeTypes(auth))
+	require.NoError(t, u.Discard())
+	require.NotNil(t, a.Users().Get("U"))
+	require.False(t, auth.HasChanges())
+
+	// signing keys added to the account are dropped
+	sk, err := a.ScopedSigningKeys().Add()
+	require.NoError(t, err)
+	_, err = a.Users().Add("W", sk)
+	require.NoError(t, err)
+	require.Equal(t, map[string]authb.ChangeType{
+		"O/A":   authb.ChangeModified,
+		"O/A/W": authb.ChangeAdded,
+	}, changeTypes(auth))
+	require.NoError(t, a.Discard())
+	require.False(t, auth.HasChanges())
+	require.Nil(t, a.Users().Get("W"))
+	_, ok := a.ScopedSigningKeys().GetScope(sk)
+	require.False(t, ok)
+
+	// deleted accounts are restored by the operator
+	require.NoError(t, o.Accounts().Delete("A"))
+	_, err = o.Accounts().Add("B")
+	require.NoError(t, err)
+	require.Equal(t, map[string]authb.ChangeType{
+		"O/A": authb.ChangeDeleted,
+		"O/B": authb.ChangeAdded,
+	}, changeTypes(auth))
+	require.NoError(t, o.Discard())
+	require.False(t, auth.HasChanges())
+	require.NotNil(t, o.Accounts().Get("A"))
+	require.Nil(t, o.Accounts().Get("B"))
+
+	require.NoError(t, auth.Commit())
+	require.True(t, suite.Store.KeyExists(u.Subject()))
+	require.False(t, suite.Store.KeyExists(v.Subject()))
+	require.False(t, suite.Store.KeyExists(sk))
+	require.NoError(t, auth.Reload())
+	o = auth.Operators().Get("O")
+	require.Len(t, o.Accounts().List(), 1)
+	require.Len(t, o.Accounts().Get("A").Users().List(), 1)
+}
+
+func (suite *ProviderSuite) Test_EditsAfterCommitAreStored() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	_, err = a.Users().Add("U", "")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	// edits in the same second as the commit, the user without its account
+	auth, err = authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	a = auth.Operators().Get("O").Accounts().Get("A")
+	require.NoError(t, a.Users().Get("U").SetMaxSubscriptions(10))
+	require.NoError(t, auth.Commit())
+	require.NoError(t, a.Limits().SetMaxConnections(5))
+	require.NoError(t, auth.Commit())
+
+	auth, err = authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	a = auth.Operators().Get("O").Accounts().Get("A")
+	require.Equal(t, int64(5), a.Limits().MaxConnections())
+	require.Equal(t, int64(10), a.Users().Get("U").MaxSubscriptions())
+}
+
+func (suite *ProviderSuite) Test_NoChangesAfterDeleteCommit() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	_, err = a.Users().Add("U", "")
+	require.NoError(t, err)
+	_, err = o.Accounts().Add("B")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	require.NoError(t, a.Users().Delete("U"))
+	require.NoError(t, auth.Commit())
+	require.False(t, auth.HasChanges(), auth.Changes())
+
+	require.NoError(t, o.Accounts().Delete("B"))
+	require.NoError(t, auth.Commit())
+	require.False(t, auth.HasChanges(), auth.Changes())
+	od := o.(*authb.OperatorData)
+	require.Empty(t, od.DeletedAccounts)
+	require.NoError(t, auth.Commit())
+	require.Len(t, od.RemovedAccounts, 1)
+}
+
+func (suite *ProviderSuite) Test_DiscardRestoresDeletedSigningKeys() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	osk, err := o.SigningKeys().Add()
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	sk, err := a.ScopedSigningKeys().Add()
+	require.NoError(t, err)
+	u, err := a.Users().Add("U", sk)
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	// account signing key
+	ok, err := a.ScopedSigningKeys().Delete(sk)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, a.Discard())
+	require.False(t, auth.HasChanges())
+	_, ok = a.ScopedSigningKeys().GetScope(sk)
+	require.True(t, ok)
+	require.NoError(t, u.SetExpiry(time.Now().Add(time.Hour).Unix()))
+	require.Equal(t, sk, u.Issuer())
+
+	// operator signing key
+	ok, err = o.SigningKeys().Delete(osk)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, o.Discard())
+	require.False(t, auth.HasChanges())
+	od := o.(*authb.OperatorData)
+	require.Len(t, od.OperatorSigningKeys, 1)
+	require.Equal(t, osk, od.OperatorSigningKeys[0].Public)
+	require.NoError(t, a.SetExpiry(time.Now().Add(time.Hour).Unix()))
+	require.Equal(t, osk, a.Issuer())
+
+	require.NoError(t, auth.Commit())
+	require.True(t, suite.Store.KeyExists(sk))
+	require.True(t, suite.Store.KeyExists(osk))
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/deploy"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startResolverServer starts a server with a full resolver that trusts the
+// operator and returns a connection for the sys user of the system account
+func startResolverServer(t *testing.T, auth authb.Auth, o authb.Operator, allowDelete bool) (*server.Server, *nats.Conn, string) {
+	if o.SystemAccount() == nil {
+		sys, err := o.Accounts().Add("SYS")
+		require.NoError(t, err)
+		require.NoError(t, o.SetSystemAccount(sys))
+		_, err = sys.Users().Add("sys", "")
+		require.NoError(t, err)
+		require.NoError(t, auth.Commit())
+	}
+	dir := t.TempDir()
+	c, err := o.ResolverConfig(authb.ResolverOptions{Dir: dir, AllowDelete: allowDelete})
+	require.NoError(t, err)
+	s := StartServerWithConfig(t, c.Text())
+	nc, err := deploy.Connect(s.ClientURL(), o, "sys")
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+	return s, nc, dir
+}
+
+func Test_PushAccounts(t *testing.T) {
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	s, nc, dir := startResolverServer(t, auth, o, true)
+
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	changed := deploy.Changed(o)
+	require.Len(t, changed, 1)
+	require.NoError(t, auth.Commit())
+	require.Empty(t, deploy.Changed(o))
+
+	p := deploy.NewPublisher(nc, deploy.Options{Servers: 1})
+	r, err := p.Push(o, changed...)
+	require.NoError(t, err)
+	require.Len(t, r.Results, 1)
+	require.Empty(t, r.Failed(), r.String())
+	require.Equal(t, deploy.OpUpdate, r.Results[0].Op)
+	require.Len(t, r.Results[0].Responses, 1)
+
+	_, err = os.Stat(filepath.Join(dir, a.Subject()+".jwt"))
+	require.NoError(t, err)
+	acct, err := s.LookupAccount(a.Subject())
+	require.NoError(t, err)
+	require.Equal(t, a.Subject(), acct.Name)
+
+	// edits in the same second as the commit are detected
+	require.NoError(t, a.SetExpiry(time.Now().Add(time.Hour).Unix()))
+	require.Len(t, deploy.Changed(o), 1)
+	require.NoError(t, auth.Commit())
+
+	// deletions are pushed after they are committed
+	require.NoError(t, o.Accounts().Delete("A"))
+	require.NoError(t, auth.Commit())
+	r, err = p.Push(o)
+	require.NoError(t, err)
+	require.Len(t, r.Results, 1)
+	require.Empty(t, r.Failed(), r.String())
+	require.Equal(t, deploy.OpDelete, r.Results[0].Op)
+	require.Equal(t, "A", r.Results[0].Name)
+	_, err = os.Stat(filepath.Join(dir, a.Subject()+".jwt"))
+	require.True(t, os.IsNotExist(err))
+
+	// and only once
+	r, err = p.Push(o)
+	require.NoError(t, err)
+	require.Empty(t, r.Results)
+}
+
+func Test_PushReportsFailures(t *testing.T) {
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	u, err := a.Users().Add("U", "")
+	require.NoError(t, err)
+	s, nc, _ := startResolverServer(t, auth, o, false)
+
+	// the server doesn't allow deletes
+	require.NoError(t, o.Accounts().Delete("A"))
+	require.NoError(t, auth.Commit())
+	p := deploy.NewPublisher(nc, deploy.Options{Servers: 1})
+	r, err := p.Push(o)
+	require.NoError(t, err)
+	require.Len(t, r.Failed(), 1)
+	require.Equal(t, a.Subject(), r.Failed()[0].Account)
+	require.Len(t, r.Failed()[0].Responses, 1)
+
+	// failed deletions are retried
+	r, err = p.Push(o)
+	require.NoError(t, err)
+	require.Len(t, r.Failed(), 1)
+	require.Equal(t, a.Subject(), r.Failed()[0].Account)
+
+	// accounts must belong to the operator
+	o2, err := auth.Operators().Add("O2")
+	require.NoError(t, err)
+	b, err := o2.Accounts().Add("B")
+	require.NoError(t, err)
+	_, err = p.Push(o, b)
+	require.Error(t, err)
+
+	// users outside the system account get no responses
+	creds, err := u.Creds(0)
+	require.NoError(t, err)
+	fp := filepath.Join(t.TempDir(), "user.creds")
+	require.NoError(t, os.WriteFile(fp, creds, 0600))
+	unc, err := nats.Connect(s.ClientURL(), nats.UserCredentials(fp))
+	require.NoError(t, err)
+	defer unc.Close()
+	r, err = deploy.NewPublisher(unc, deploy.Options{Timeout: 100 * time.Millisecond}).Push(o, o.Accounts().List()...)
+	require.NoError(t, err)
+	require.Len(t, r.Failed(), 2)
+	require.ErrorIs(t, r.Failed()[0].Err, deploy.ErrNoResponse)
+}
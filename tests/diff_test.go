@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"github.com/nats-io/jwt/v2"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/diff"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"testing"
+	"time"
+)
+
+// difference returns the difference for the entity subject and field
+func difference(d *diff.Diff, subject string, field string) *diff.Difference {
+	for _, v := range d.Differences {
+		if v.Subject == subject && v.Field == field {
+			return &v
+		}
+	}
+	return nil
+}
+
+func Test_DiffOperators(t *testing.T) {
+	p := mem.NewMemProvider()
+	populateWithSigningKeys(t, p)
+	from, err := p.Load()
+	require.NoError(t, err)
+	require.True(t, diff.Operators(from, from).Empty())
+
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o := auth.Operators().Get("O")
+	sk, err := o.SigningKeys().Add()
+	require.NoError(t, err)
+	a := o.Accounts().Get("A")
+	exp := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, a.SetExpiry(exp.Unix()))
+	require.NoError(t, a.Limits().SetMaxConnections(10))
+	ad := a.(*authb.AccountData)
+	ad.Claim.Exports.Add(&jwt.Export{Subject: "q.>", Type: jwt.Service})
+	require.NoError(t, a.SetExpiry(exp.Unix()))
+	u := a.Users().Get("U")
+	require.NoError(t, u.SetMaxSubscriptions(100))
+	s := a.Users().Get("S")
+	require.NoError(t, a.Users().Delete("S"))
+	b := o.Accounts().Get("B")
+	require.NoError(t, o.Accounts().Delete("B"))
+	c, err := o.Accounts().Add("C")
+	require.NoError(t, err)
+
+	// compare the stored state with the edits
+	d := diff.Operators(from, []*authb.OperatorData{o.(*authb.OperatorData)})
+	require.False(t, d.Empty())
+
+	v := difference(d, o.Subject(), "signing_keys")
+	require.NotNil(t, v)
+	require.Equal(t, diff.Added, v.Op)
+	require.Equal(t, sk, v.To)
+
+	v = difference(d, a.Subject(), "expiry")
+	require.NotNil(t, v)
+	require.Equal(t, "<unset>", v.From)
+	require.Equal(t, "2030-01-01T00:00:00Z", v.To)
+	v = difference(d, a.Subject(), "limits.conn")
+	require.NotNil(t, v)
+	require.Equal(t, "-1", v.From)
+	require.Equal(t, "10", v.To)
+	v = difference(d, a.Subject(), "exports")
+	require.NotNil(t, v)
+	require.Equal(t, diff.Added, v.Op)
+	require.Equal(t, "service q.>", v.To)
+
+	v = difference(d, u.Subject(), "limits.subs")
+	require.NotNil(t, v)
+	require.Equal(t, "-1", v.From)
+	require.Equal(t, "100", v.To)
+
+	v = difference(d, s.Subject(), "")
+	require.NotNil(t, v)
+	require.Equal(t, diff.Removed, v.Op)
+	require.Equal(t, "O/A/S", v.Path)
+	require.Equal(t, diff.Removed, difference(d, b.Subject(), "").Op)
+	require.Equal(t, diff.Added, difference(d, c.Subject(), "").Op)
+
+	text := d.String()
+	require.Contains(t, text, "~ account O/A ("+a.Subject()+") limits.conn: -1 -> 10\n")
+	require.Contains(t, text, "- user O/A/S ("+s.Subject()+")\n")
+	require.Contains(t, text, "+ account O/C ("+c.Subject()+")\n")
+	require.Contains(t, text, "+ operator O ("+o.Subject()+") signing_keys: + "+sk+"\n")
+}
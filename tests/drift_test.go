@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/deploy"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"testing"
+	"time"
+)
+
+func driftStatus(r *deploy.DriftReport, id string) deploy.DriftStatus {
+	for _, d := range r.Accounts {
+		if d.Account == id {
+			return d.Status
+		}
+	}
+	return ""
+}
+
+func Test_DriftCheck(t *testing.T) {
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+	_, nc, _ := startResolverServer(t, auth, o, true)
+
+	c := deploy.NewChecker(nc, deploy.Options{Servers: 1})
+	r, err := c.Check(o)
+	require.NoError(t, err)
+	require.Empty(t, r.Drifted(), r.String())
+	require.Len(t, r.Accounts, 2)
+
+	// the server has an older version of A, doesn't have B, and has
+	// an account from another operator
+	time.Sleep(time.Second)
+	require.NoError(t, a.Limits().SetMaxConnections(10))
+	b, err := o.Accounts().Add("B")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+	o2, err := auth.Operators().Add("O2")
+	require.NoError(t, err)
+	x, err := o2.Accounts().Add("X")
+	require.NoError(t, err)
+	pr, err := deploy.NewPublisher(nc, deploy.Options{Servers: 1}).Push(o2, x)
+	require.NoError(t, err)
+	require.Empty(t, pr.Failed())
+
+	r, err = c.Check(o)
+	require.NoError(t, err)
+	require.Len(t, r.Drifted(), 3, r.String())
+	require.Equal(t, deploy.Older, driftStatus(r, a.Subject()))
+	require.Equal(t, deploy.Missing, driftStatus(r, b.Subject()))
+	require.Equal(t, deploy.Unknown, driftStatus(r, x.Subject()))
+	require.Equal(t, deploy.InSync, driftStatus(r, o.SystemAccount().Subject()))
+	require.Len(t, r.Outdated(o), 2)
+
+	// sync pushes the outdated accounts
+	r, pr, err = c.Sync(o)
+	require.NoError(t, err)
+	require.Len(t, r.Drifted(), 3)
+	require.Len(t, pr.Results, 2)
+	require.Empty(t, pr.Failed())
+
+	r, err = c.Check(o)
+	require.NoError(t, err)
+	require.Len(t, r.Drifted(), 1)
+	require.Equal(t, deploy.Unknown, r.Drifted()[0].Status)
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+)
+
+func (suite *ProviderSuite) Test_UniqueNamesAndErrors() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	_, err = auth.Operators().Add("O")
+	require.ErrorIs(t, err, authb.ErrAlreadyExists)
+	sys, err := o.BootstrapSystemAccount()
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	_, err = o.Accounts().Add("A")
+	require.ErrorIs(t, err, authb.ErrAlreadyExists)
+	_, err = a.Users().Add("U", "")
+	require.NoError(t, err)
+	_, err = a.Users().Add("U", "")
+	require.ErrorIs(t, err, authb.ErrAlreadyExists)
+	require.Len(t, a.Users().List(), 1)
+
+	// scopes are unique by role
+	sl, err := a.ScopedSigningKeys().AddScope("service")
+	require.NoError(t, err)
+	_, err = a.ScopedSigningKeys().AddScope("service")
+	require.ErrorIs(t, err, authb.ErrAlreadyExists)
+
+	// scoped users can't be edited
+	s, err := a.Users().Add("S", sl.Key())
+	require.NoError(t, err)
+	require.ErrorIs(t, s.SetMaxSubscriptions(10), authb.ErrUserIsScoped)
+
+	// deletes of missing entities and keys
+	require.ErrorIs(t, a.Users().Delete("X"), authb.ErrNotFound)
+	require.ErrorIs(t, o.Accounts().Delete("X"), authb.ErrNotFound)
+	require.ErrorIs(t, auth.Operators().Delete("X"), authb.ErrNotFound)
+	ok, err := o.SigningKeys().Delete(a.Subject())
+	require.ErrorIs(t, err, authb.ErrKeyNotFound)
+	require.False(t, ok)
+	_, err = a.ScopedSigningKeys().Rotate(o.Subject())
+	require.ErrorIs(t, err, authb.ErrKeyNotFound)
+	_, err = a.Limits().JetStream().Delete(1)
+	require.ErrorIs(t, err, authb.ErrNotFound)
+
+	// the system account is in use by the operator
+	require.ErrorIs(t, o.Accounts().Delete(sys.Name()), authb.ErrConflict)
+
+	// names are free again after a delete
+	require.NoError(t, a.Users().Delete("U"))
+	_, err = a.Users().Add("U", "")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	require.NoError(t, auth.Reload())
+	a = auth.Operators().Get("O").Accounts().Get("A")
+	require.Len(t, a.Users().List(), 2)
+}
+
+func (suite *ProviderSuite) Test_StoreConflicts() {
+	t := suite.T()
+	if suite.Kind != NscProvider && suite.Kind != KvProvider && suite.Kind != FsProvider {
+		t.Skip("only the nsc, kv and fs providers detect conflicts")
+	}
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	other, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	// the other copy was loaded before the account was last changed
+	a2 := other.Operators().Get("O").Accounts().Get("A")
+	a2.(*authb.AccountData).Loaded--
+
+	require.NoError(t, a.Limits().SetMaxConnections(10))
+	require.NoError(t, auth.Commit())
+	require.NoError(t, a2.Limits().SetMaxConnections(20))
+	require.ErrorIs(t, other.Commit(), authb.ErrConflict)
+
+	// reloading picks the stored changes
+	require.NoError(t, other.Reload())
+	a2 = other.Operators().Get("O").Accounts().Get("A")
+	require.Equal(t, int64(10), a2.Limits().MaxConnections())
+	require.NoError(t, a2.Limits().SetMaxConnections(20))
+	require.NoError(t, other.Commit())
+
+	// an operator with the same name
+	if suite.Kind == NscProvider || suite.Kind == FsProvider {
+		third, err := authb.NewAuth(suite.Provider)
+		require.NoError(t, err)
+		require.NoError(t, third.Operators().Delete("O"))
+		_, err = third.Operators().Add("O")
+		require.NoError(t, err)
+		require.ErrorIs(t, third.Commit(), authb.ErrAlreadyExists)
+	}
+}
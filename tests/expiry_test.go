@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"testing"
+	"time"
+)
+
+func Test_ExpiringAndRenew(t *testing.T) {
+	p := mem.NewMemProvider()
+	populateWithSigningKeys(t, p)
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o := auth.Operators().Get("O")
+	a := o.Accounts().Get("A")
+	b := o.Accounts().Get("B")
+	u := a.Users().Get("U")
+	s := a.Users().Get("S")
+
+	now := time.Now()
+	require.NoError(t, o.SetExpiry(now.Add(time.Hour).Unix()))
+	require.NoError(t, a.SetExpiry(now.Add(2*time.Hour).Unix()))
+	require.NoError(t, b.SetExpiry(now.Add(60*24*time.Hour).Unix()))
+	require.NoError(t, u.SetExpiry(now.Add(time.Hour).Unix()))
+	require.NoError(t, s.SetExpiry(now.Add(-time.Hour).Unix()))
+	require.True(t, s.IsScoped())
+
+	entries := o.Expiring(24 * time.Hour)
+	require.Len(t, entries, 4)
+	kinds := make(map[string]string)
+	for _, e := range entries {
+		kinds[e.Subject] = e.Kind
+	}
+	require.Equal(t, "operator", kinds[o.Subject()])
+	require.Equal(t, "account", kinds[a.Subject()])
+	require.Equal(t, "user", kinds[u.Subject()])
+	require.Equal(t, "user", kinds[s.Subject()])
+
+	// A is issued by the operator signing key, whose seed is not held
+	require.NoError(t, auth.Commit())
+	require.NoError(t, p.DeleteKey(a.Issuer()))
+	require.NoError(t, auth.Reload())
+	o = auth.Operators().Get("O")
+	a = o.Accounts().Get("A")
+	u = a.Users().Get("U")
+	s = a.Users().Get("S")
+	uexp := u.Expiry()
+
+	_, err = o.Renew(24*time.Hour, authb.RenewalPolicy{})
+	require.Error(t, err)
+
+	r, err := o.Renew(24*time.Hour, authb.RenewalPolicy{Extend: 30 * 24 * time.Hour})
+	require.NoError(t, err)
+	require.Len(t, r.Renewed, 3, r.String())
+	require.Len(t, r.Skipped, 1)
+	require.Equal(t, a.Subject(), r.Skipped[0].Subject)
+	require.Contains(t, r.Skipped[0].Reason, "not held")
+
+	require.Equal(t, uexp+int64((30*24*time.Hour).Seconds()), u.Expiry())
+	// expired entities are extended from now
+	require.GreaterOrEqual(t, s.Expiry(), now.Add(30*24*time.Hour).Unix())
+	require.True(t, s.IsScoped())
+	require.Len(t, o.Expiring(24*time.Hour), 1)
+
+	// renew until a fixed date
+	until := now.Add(45 * 24 * time.Hour)
+	r, err = o.Renew(50*24*time.Hour, authb.RenewalPolicy{Until: until})
+	require.NoError(t, err)
+	require.Len(t, r.Renewed, 3, r.String())
+	require.Len(t, r.Skipped, 1)
+	require.Equal(t, until.Unix(), u.Expiry())
+
+	// the renewed entities verify
+	require.NoError(t, auth.Commit())
+	_, err = authb.NewAuth(p, authb.WithLoadMode(authb.LoadStrict))
+	require.NoError(t, err)
+}
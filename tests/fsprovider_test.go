@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/fs"
+
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_FsProviderConcurrentCommits(t *testing.T) {
+	ts := NewFsStore(t)
+	auth, err := authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()))
+	require.NoError(t, err)
+	_, err = auth.Operators().Add("O")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			auth, err := authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()))
+			if err != nil {
+				errs <- err
+				return
+			}
+			o := auth.Operators().Get("O")
+			if _, err := o.Accounts().Add(fmt.Sprintf("A%d", i)); err != nil {
+				errs <- err
+				return
+			}
+			errs <- auth.Commit()
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	auth, err = authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()))
+	require.NoError(t, err)
+	require.Len(t, auth.Operators().Get("O").Accounts().List(), 10)
+
+	// no temporary files are left behind
+	err = filepath.Walk(ts.root, func(path string, info os.FileInfo, err error) error {
+		require.False(t, strings.HasSuffix(path, ".tmp"), path)
+		return err
+	})
+	require.NoError(t, err)
+}
+
+func Test_FsProviderStaleWrites(t *testing.T) {
+	ts := NewFsStore(t)
+	auth, err := authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()))
+	require.NoError(t, err)
+	_, err = auth.Operators().Add("O")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	auth1, err := authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()))
+	require.NoError(t, err)
+	auth2, err := authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()))
+	require.NoError(t, err)
+	_, err = auth1.Operators().Get("O").Accounts().Add("A")
+	require.NoError(t, err)
+	_, err = auth2.Operators().Get("O").Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth1.Commit())
+	require.ErrorIs(t, auth2.Commit(), authb.ErrAlreadyExists)
+
+	// entities that were not modified are not checked or written
+	require.NoError(t, auth2.Reload())
+	a := auth2.Operators().Get("O").Accounts().Get("A")
+	require.NoError(t, a.Limits().SetMaxConnections(5))
+	_, err = auth1.Operators().Get("O").Accounts().Add("B")
+	require.NoError(t, err)
+	require.NoError(t, auth1.Commit())
+	require.NoError(t, auth2.Commit())
+
+	auth, err = authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()))
+	require.NoError(t, err)
+	o := auth.Operators().Get("O")
+	require.Len(t, o.Accounts().List(), 2)
+	require.Equal(t, int64(5), o.Accounts().Get("A").Limits().MaxConnections())
+}
+
+func Test_FsProviderRejectsInvalidNames(t *testing.T) {
+	ts := NewFsStore(t)
+	auth, err := authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()))
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	_, err = o.Accounts().Add("../A")
+	require.NoError(t, err)
+	require.Error(t, auth.Commit())
+}
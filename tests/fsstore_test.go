@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"github.com/nats-io/jwt/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/synadia-io/jwt-auth-builder.go"
+
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type FsStore struct {
+	root string
+	t    *testing.T
+}
+
+func NewFsStore(t *testing.T) *FsStore {
+	return &FsStore{root: t.TempDir(), t: t}
+}
+
+func (ts *FsStore) Dir() string {
+	return filepath.Join(ts.root, "jwts")
+}
+
+func (ts *FsStore) KeysDir() string {
+	return filepath.Join(ts.root, "keys")
+}
+
+func (ts *FsStore) KeyExists(k string) bool {
+	_, err := os.Stat(filepath.Join(ts.KeysDir(), k+".nk"))
+	return err == nil
+}
+
+func (ts *FsStore) GetKey(k string) *authb.Key {
+	d, err := os.ReadFile(filepath.Join(ts.KeysDir(), k+".nk"))
+	require.NoError(ts.t, err)
+	key, err := authb.KeyFrom(string(d))
+	require.NoError(ts.t, err)
+	return key
+}
+
+func (ts *FsStore) OperatorExists(name string) bool {
+	_, err := os.Stat(filepath.Join(ts.Dir(), name+".jwt"))
+	return err == nil
+}
+
+func (ts *FsStore) GetOperator(name string) *jwt.OperatorClaims {
+	d, err := os.ReadFile(filepath.Join(ts.Dir(), name+".jwt"))
+	require.NoError(ts.t, err)
+	oc, err := jwt.DecodeOperatorClaims(string(d))
+	require.NoError(ts.t, err)
+	return oc
+}
+
+func (ts *FsStore) AccountExists(operator string, name string) bool {
+	_, err := os.Stat(filepath.Join(ts.Dir(), operator, name+".jwt"))
+	return err == nil
+}
+
+func (ts *FsStore) GetAccount(operator string, name string) *jwt.AccountClaims {
+	d, err := os.ReadFile(filepath.Join(ts.Dir(), operator, name+".jwt"))
+	require.NoError(ts.t, err)
+	ac, err := jwt.DecodeAccountClaims(string(d))
+	require.NoError(ts.t, err)
+	return ac
+}
+
+func (ts *FsStore) UserExists(operator string, account string, name string) bool {
+	_, err := os.Stat(filepath.Join(ts.Dir(), operator, account, name+".jwt"))
+	return err == nil
+}
+
+func (ts *FsStore) GetUser(operator string, account string, name string) *jwt.UserClaims {
+	d, err := os.ReadFile(filepath.Join(ts.Dir(), operator, account, name+".jwt"))
+	require.NoError(ts.t, err)
+	uc, err := jwt.DecodeUserClaims(string(d))
+	require.NoError(ts.t, err)
+	return uc
+}
+
+func (ts *FsStore) Cleanup() {
+}
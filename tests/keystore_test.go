@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"errors"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/kv"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/nsc"
+
+	"testing"
+	"time"
+)
+
+func Test_SeparateKeyStore(t *testing.T) {
+	s := StartJetStreamServer(t)
+	nc, err := nats.Connect(s.ClientURL())
+	require.NoError(t, err)
+	keys, err := kv.NewKvProviderWithConnection(nc, nuid.Next(), curveSeed(t))
+	require.NoError(t, err)
+	defer keys.Disconnect()
+
+	ts := NewNscStore(t)
+	jwts := nsc.NewNscProvider(ts.StoresDir(), ts.KeysDir())
+
+	auth, err := authb.NewAuthWithKeyStore(jwts, keys)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	sk, err := o.SigningKeys().Add()
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	ask, err := a.ScopedSigningKeys().Add()
+	require.NoError(t, err)
+	u, err := a.Users().Add("U", ask)
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	for _, pk := range []string{o.Subject(), sk, a.Subject(), ask, u.Subject()} {
+		require.False(t, ts.KeyExists(pk))
+		k, err := keys.GetKey(pk)
+		require.NoError(t, err)
+		require.NotNil(t, k)
+		require.Equal(t, pk, k.Public)
+	}
+	require.True(t, ts.UserExists("O", "A", "U"))
+
+	auth, err = authb.NewAuthWithKeyStore(jwts, keys)
+	require.NoError(t, err)
+	o = auth.Operators().Get("O")
+	require.NotNil(t, o)
+	a = o.Accounts().Get("A")
+	require.NotNil(t, a)
+	require.NoError(t, a.Limits().SetMaxConnections(10))
+	u = a.Users().Get("U")
+	require.NotNil(t, u)
+	_, err = u.Creds(time.Hour)
+	require.NoError(t, err)
+
+	require.NoError(t, a.Users().Delete("U"))
+	require.NoError(t, auth.Commit())
+	k, err := keys.GetKey(u.Subject())
+	require.NoError(t, err)
+	require.Nil(t, k)
+}
+
+func Test_FailedStoreKeepsDeletedKeys(t *testing.T) {
+	p := mem.NewMemProvider()
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	sk, err := a.ScopedSigningKeys().Add()
+	require.NoError(t, err)
+	u, err := a.Users().Add("U", "")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	ok, err := a.ScopedSigningKeys().Delete(sk)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, a.Users().Delete("U"))
+	v, err := a.Users().Add("V", "")
+	require.NoError(t, err)
+
+	boom := errors.New("boom")
+	p.FailStore(boom, 1)
+	require.ErrorIs(t, auth.Commit(), boom)
+
+	// the stored entities still reference the deleted keys
+	for _, pk := range []string{sk, u.Subject()} {
+		k, err := p.GetKey(pk)
+		require.NoError(t, err)
+		require.NotNil(t, k, pk)
+	}
+	k, err := p.GetKey(v.Subject())
+	require.NoError(t, err)
+	require.NotNil(t, k)
+
+	// a retry deletes them
+	require.NoError(t, auth.Commit())
+	for _, pk := range []string{sk, u.Subject()} {
+		k, err := p.GetKey(pk)
+		require.NoError(t, err)
+		require.Nil(t, k, pk)
+	}
+}
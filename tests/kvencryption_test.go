@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"context"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nkeys"
+	"github.com/nats-io/nuid"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/kv"
+
+	"sync"
+	"testing"
+)
+
+func curveSeed(t *testing.T) string {
+	kp, err := nkeys.CreateCurveKeys()
+	require.NoError(t, err)
+	seed, err := kp.Seed()
+	require.NoError(t, err)
+	return string(seed)
+}
+
+func kvProvider(t *testing.T, url string, bucket string, key string) (*kv.KvProvider, error) {
+	nc, err := nats.Connect(url)
+	require.NoError(t, err)
+	return kv.NewKvProviderWithConnection(nc, bucket, key)
+}
+
+func populate(t *testing.T, p authb.AuthProvider) []string {
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	_, err = o.SigningKeys().Add()
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	u, err := a.Users().Add("U", "")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+	return []string{o.Subject(), a.Subject(), u.Subject()}
+}
+
+func Test_KvRotateEncryptKey(t *testing.T) {
+	s := StartJetStreamServer(t)
+	bucket := nuid.Next()
+	k1 := curveSeed(t)
+	k2 := curveSeed(t)
+
+	p, err := kvProvider(t, s.ClientURL(), bucket, k1)
+	require.NoError(t, err)
+	keys := populate(t, p)
+	require.NoError(t, p.RotateEncryptKey(k2))
+	for _, k := range keys {
+		key, err := p.GetKey(k)
+		require.NoError(t, err)
+		require.Equal(t, k, key.Public)
+	}
+	p.Disconnect()
+
+	// the old key is rejected
+	_, err = kvProvider(t, s.ClientURL(), bucket, k1)
+	require.ErrorIs(t, err, kv.ErrEncryptionMismatch)
+	// plaintext is rejected
+	_, err = kvProvider(t, s.ClientURL(), bucket, "")
+	require.ErrorIs(t, err, kv.ErrEncryptionMismatch)
+
+	p, err = kvProvider(t, s.ClientURL(), bucket, k2)
+	require.NoError(t, err)
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	require.NotNil(t, auth.Operators().Get("O"))
+	p.Disconnect()
+}
+
+func Test_KvEncryptPlaintextBucket(t *testing.T) {
+	s := StartJetStreamServer(t)
+	bucket := nuid.Next()
+	k := curveSeed(t)
+
+	p, err := kvProvider(t, s.ClientURL(), bucket, "")
+	require.NoError(t, err)
+	keys := populate(t, p)
+	p.Disconnect()
+
+	_, err = kvProvider(t, s.ClientURL(), bucket, k)
+	require.ErrorIs(t, err, kv.ErrEncryptionMismatch)
+
+	p, err = kvProvider(t, s.ClientURL(), bucket, "")
+	require.NoError(t, err)
+	require.NoError(t, p.RotateEncryptKey(k))
+	p.Disconnect()
+
+	p, err = kvProvider(t, s.ClientURL(), bucket, k)
+	require.NoError(t, err)
+	for _, pk := range keys {
+		key, err := p.GetKey(pk)
+		require.NoError(t, err)
+		require.Equal(t, pk, key.Public)
+	}
+	p.Disconnect()
+}
+
+func Test_KvRotateEncryptKeyResumes(t *testing.T) {
+	s := StartJetStreamServer(t)
+	bucket := nuid.Next()
+	k1 := curveSeed(t)
+	k2 := curveSeed(t)
+
+	p, err := kvProvider(t, s.ClientURL(), bucket, k1)
+	require.NoError(t, err)
+	keys := populate(t, p)
+
+	// simulate an interrupted rotation that rotated a single entry
+	fk, err := nkeys.FromCurveSeed([]byte(k1))
+	require.NoError(t, err)
+	tk, err := nkeys.FromCurveSeed([]byte(k2))
+	require.NoError(t, err)
+	fpk, _ := fk.PublicKey()
+	tpk, _ := tk.PublicKey()
+	_, err = p.Kv.Put(context.Background(), kv.EncryptionMarker, []byte("rotating "+fpk+" "+tpk))
+	require.NoError(t, err)
+	key, err := p.GetKey(keys[0])
+	require.NoError(t, err)
+	sealed, err := tk.Seal(key.Seed, tpk)
+	require.NoError(t, err)
+	_, err = p.Kv.Put(context.Background(), "keys."+keys[0], sealed)
+	require.NoError(t, err)
+	p.Disconnect()
+
+	_, err = kvProvider(t, s.ClientURL(), bucket, k1)
+	require.ErrorIs(t, err, kv.ErrRotationInProgress)
+
+	nc, err := nats.Connect(s.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+	bkv, err := js.KeyValue(context.Background(), bucket)
+	require.NoError(t, err)
+	require.NoError(t, kv.RotateEncryptKey(bkv, k1, k2))
+
+	p, err = kvProvider(t, s.ClientURL(), bucket, k2)
+	require.NoError(t, err)
+	for _, pk := range keys {
+		key, err := p.GetKey(pk)
+		require.NoError(t, err)
+		require.Equal(t, pk, key.Public)
+	}
+	p.Disconnect()
+}
+
+func Test_KvPutKeyChecksRotation(t *testing.T) {
+	s := StartJetStreamServer(t)
+	bucket := nuid.Next()
+	k1 := curveSeed(t)
+	k2 := curveSeed(t)
+
+	p, err := kvProvider(t, s.ClientURL(), bucket, k1)
+	require.NoError(t, err)
+	defer p.Disconnect()
+	populate(t, p)
+	k, err := authb.KeyFor(nkeys.PrefixByteAccount)
+	require.NoError(t, err)
+
+	// seeds can't be written while a rotation is in progress
+	fk, err := nkeys.FromCurveSeed([]byte(k1))
+	require.NoError(t, err)
+	tk, err := nkeys.FromCurveSeed([]byte(k2))
+	require.NoError(t, err)
+	fpk, _ := fk.PublicKey()
+	tpk, _ := tk.PublicKey()
+	_, err = p.Kv.Put(context.Background(), kv.EncryptionMarker, []byte("rotating "+fpk+" "+tpk))
+	require.NoError(t, err)
+	require.ErrorIs(t, p.PutKey(k), kv.ErrRotationInProgress)
+
+	// nor with the old key after the rotation completes
+	require.NoError(t, kv.RotateEncryptKey(p.Kv, k1, k2))
+	require.ErrorIs(t, p.PutKey(k), kv.ErrEncryptionMismatch)
+
+	q, err := kvProvider(t, s.ClientURL(), bucket, k2)
+	require.NoError(t, err)
+	defer q.Disconnect()
+	require.NoError(t, q.PutKey(k))
+	key, err := q.GetKey(k.Public)
+	require.NoError(t, err)
+	require.Equal(t, k.Seed, key.Seed)
+}
+
+func Test_KvPutKeyDuringRotation(t *testing.T) {
+	s := StartJetStreamServer(t)
+	bucket := nuid.Next()
+	k1 := curveSeed(t)
+	k2 := curveSeed(t)
+
+	p, err := kvProvider(t, s.ClientURL(), bucket, k1)
+	require.NoError(t, err)
+	defer p.Disconnect()
+	populate(t, p)
+	for i := 0; i < 200; i++ {
+		k, err := authb.KeyFor(nkeys.PrefixByteUser)
+		require.NoError(t, err)
+		require.NoError(t, p.PutKey(k))
+	}
+
+	// writers using the old key run until the rotation completes
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var stored []*authb.Key
+	for i := 0; i < 4; i++ {
+		w, err := kvProvider(t, s.ClientURL(), bucket, k1)
+		require.NoError(t, err)
+		defer w.Disconnect()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				k, err := authb.KeyFor(nkeys.PrefixByteUser)
+				if err != nil {
+					return
+				}
+				if w.PutKey(k) == nil {
+					mu.Lock()
+					stored = append(stored, k)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	require.NoError(t, kv.RotateEncryptKey(p.Kv, k1, k2))
+	close(done)
+	wg.Wait()
+
+	// every seed left in the bucket can be read with the new key, including
+	// all the seeds that were stored without an error
+	q, err := kvProvider(t, s.ClientURL(), bucket, k2)
+	require.NoError(t, err)
+	defer q.Disconnect()
+	m, err := q.GetChildren(kv.KeysPrefix)
+	require.NoError(t, err)
+	for pk := range m {
+		key, err := q.GetKey(pk)
+		require.NoError(t, err, pk)
+		require.Equal(t, pk, key.Public)
+	}
+	for _, k := range stored {
+		key, err := q.GetKey(k.Public)
+		require.NoError(t, err)
+		require.NotNil(t, key, k.Public)
+		require.Equal(t, k.Seed, key.Seed)
+	}
+}
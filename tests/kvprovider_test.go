@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"github.com/nats-io/nuid"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+
+	"testing"
+)
+
+func Test_KvProviderUniqueNames(t *testing.T) {
+	ns := StartJetStreamServer(t)
+	bucket := nuid.Next()
+	p, err := kvProvider(t, ns.ClientURL(), bucket, "")
+	require.NoError(t, err)
+	defer p.Disconnect()
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	_, err = auth.Operators().Add("O")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	p1, err := kvProvider(t, ns.ClientURL(), bucket, "")
+	require.NoError(t, err)
+	defer p1.Disconnect()
+	auth1, err := authb.NewAuth(p1)
+	require.NoError(t, err)
+	auth2, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	a1, err := auth1.Operators().Get("O").Accounts().Add("A")
+	require.NoError(t, err)
+	_, err = a1.Users().Add("U", "")
+	require.NoError(t, err)
+	_, err = auth2.Operators().Get("O").Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth1.Commit())
+	require.ErrorIs(t, auth2.Commit(), authb.ErrAlreadyExists)
+
+	auth2, err = authb.NewAuth(p)
+	require.NoError(t, err)
+	_, err = auth1.Operators().Get("O").Accounts().Get("A").Users().Add("V", "")
+	require.NoError(t, err)
+	_, err = auth2.Operators().Get("O").Accounts().Get("A").Users().Add("V", "")
+	require.NoError(t, err)
+	require.NoError(t, auth1.Commit())
+	require.ErrorIs(t, auth2.Commit(), authb.ErrAlreadyExists)
+}
+
+func Test_KvProviderDeleteAndAddSameName(t *testing.T) {
+	ns := StartJetStreamServer(t)
+	p, err := kvProvider(t, ns.ClientURL(), nuid.Next(), "")
+	require.NoError(t, err)
+	defer p.Disconnect()
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	_, err = a.Users().Add("U", "")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	// the deletes are stored before the entities that replace them
+	require.NoError(t, a.Users().Delete("U"))
+	u, err := a.Users().Add("U", "")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+	require.NoError(t, o.Accounts().Delete("A"))
+	b, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	auth, err = authb.NewAuth(p)
+	require.NoError(t, err)
+	accounts := auth.Operators().Get("O").Accounts().List()
+	require.Len(t, accounts, 1)
+	require.Equal(t, b.Subject(), accounts[0].Subject())
+	require.Empty(t, accounts[0].Users().List())
+	m, err := p.GetChildren(a.Subject())
+	require.NoError(t, err)
+	require.NotContains(t, m, u.Subject())
+}
@@ -0,0 +1,254 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadUsers appends n users to the account the way providers load them,
+// without generating keys or signing JWTs
+func loadUsers(ad *authb.AccountData, n int) {
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("U%d", i)
+		ad.UserDatas = append(ad.UserDatas, &authb.UserData{
+			BaseData:    authb.BaseData{EntityName: name},
+			AccountData: ad,
+			Claim:       &jwt.UserClaims{ClaimsData: jwt.ClaimsData{Subject: "S" + name}},
+		})
+	}
+}
+
+func Test_ListPagingAndFilter(t *testing.T) {
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = o.Accounts().Add(fmt.Sprintf("A%d", i))
+		require.NoError(t, err)
+	}
+	a := o.Accounts().Get("A0")
+	for i := 0; i < 10; i++ {
+		_, err = a.Users().Add(fmt.Sprintf("U%d", i), "")
+		require.NoError(t, err)
+	}
+
+	names := func(users []authb.User) []string {
+		var v []string
+		for _, u := range users {
+			v = append(v, u.(*authb.UserData).EntityName)
+		}
+		return v
+	}
+	require.Len(t, a.Users().List(), 10)
+	require.Equal(t, []string{"U0", "U1", "U2"}, names(a.Users().List(authb.WithLimit(3))))
+	require.Equal(t, []string{"U8", "U9"}, names(a.Users().List(authb.WithOffset(8), authb.WithLimit(3))))
+	require.Empty(t, a.Users().List(authb.WithOffset(20)))
+
+	odd := authb.WithUserFilter(func(u authb.User) bool {
+		return strings.ContainsAny(u.(*authb.UserData).EntityName, "13579")
+	})
+	require.Equal(t, []string{"U1", "U3", "U5", "U7", "U9"}, names(a.Users().List(odd)))
+	require.Equal(t, []string{"U5", "U7"}, names(a.Users().List(odd, authb.WithOffset(2), authb.WithLimit(2))))
+	// the filter of the other kind is ignored
+	require.Len(t, o.Accounts().List(odd), 5)
+
+	accounts := o.Accounts().List(authb.WithAccountFilter(func(a authb.Account) bool {
+		return a.Name() > "A2"
+	}))
+	require.Len(t, accounts, 2)
+	require.Equal(t, "A3", accounts[0].Name())
+	require.Equal(t, "A4", accounts[1].Name())
+}
+
+func Test_LookupsFollowChanges(t *testing.T) {
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	ad := a.(*authb.AccountData)
+	u, err := a.Users().Add("U", "")
+	require.NoError(t, err)
+	require.Equal(t, u, a.Users().Get("U"))
+
+	// users appended directly to the slice are found
+	loadUsers(ad, 100)
+	require.NotNil(t, a.Users().Get("U50"))
+	require.NotNil(t, a.Users().Get("SU99"))
+	require.Equal(t, u, a.Users().Get(u.Subject()))
+
+	// deletes keep the order of the other users, so paging is stable
+	page := a.Users().List(authb.WithOffset(50), authb.WithLimit(5))
+	require.NoError(t, a.Users().Delete("U"))
+	require.NoError(t, a.Users().Delete("SU10"))
+	require.Nil(t, a.Users().Get("U"))
+	require.Nil(t, a.Users().Get("U10"))
+	require.Len(t, a.Users().List(), 99)
+	require.Equal(t, page[2:], a.Users().List(authb.WithOffset(50), authb.WithLimit(3)))
+	for i := 0; i < 100; i++ {
+		if i != 10 {
+			require.NotNil(t, a.Users().Get(fmt.Sprintf("U%d", i)), i)
+		}
+	}
+
+	// slices assigned directly are followed
+	users := ad.UserDatas
+	ad.UserDatas = append([]*authb.UserData{}, users[:20]...)
+	require.Nil(t, a.Users().Get("U50"))
+	ad.UserDatas = users
+	require.NotNil(t, a.Users().Get("U50"))
+
+	// replacing a user in place drops the old one, but the new one is only
+	// found after a Reindex
+	r := &authb.UserData{
+		BaseData:    authb.BaseData{EntityName: "R"},
+		AccountData: ad,
+		Claim:       &jwt.UserClaims{ClaimsData: jwt.ClaimsData{Subject: "SR"}},
+	}
+	ad.UserDatas[50] = r
+	require.Nil(t, a.Users().Get("U51"))
+	ad.Reindex()
+	require.Equal(t, r, a.Users().Get("R"))
+
+	// discards restore deleted users and remove added ones
+	_, err = a.Users().Add("V", "")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+	_, err = a.Users().Add("W", "")
+	require.NoError(t, err)
+	require.NoError(t, a.Users().Delete("V"))
+	require.NoError(t, a.Discard())
+	require.NotNil(t, a.Users().Get("V"))
+	require.Nil(t, a.Users().Get("W"))
+	_, err = a.Users().Add("W", "")
+	require.NoError(t, err)
+
+	// signing keys
+	sk, err := a.ScopedSigningKeys().Add()
+	require.NoError(t, err)
+	su, err := a.Users().Add("S", sk)
+	require.NoError(t, err)
+	require.Equal(t, sk, su.Issuer())
+	sk2, err := a.ScopedSigningKeys().Rotate(sk)
+	require.NoError(t, err)
+	_, err = a.Users().Add("X", sk)
+	require.ErrorIs(t, err, authb.ErrKeyNotFound)
+	_, err = a.Users().Add("X", sk2)
+	require.NoError(t, err)
+	sk3, err := a.ScopedSigningKeys().Add()
+	require.NoError(t, err)
+	ok, err := a.ScopedSigningKeys().Delete(sk2)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, err = a.Users().Add("Y", sk2)
+	require.ErrorIs(t, err, authb.ErrKeyNotFound)
+	_, err = a.Users().Add("Y", sk3)
+	require.NoError(t, err)
+}
+
+var counts = []int{1_000, 10_000, 50_000}
+
+// benchAccount returns an account with n users
+func benchAccount(b *testing.B, n int) authb.Account {
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(b, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(b, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(b, err)
+	loadUsers(a.(*authb.AccountData), n)
+	return a
+}
+
+func BenchmarkUserGet(b *testing.B) {
+	for _, n := range counts {
+		a := benchAccount(b, n)
+		b.Run(fmt.Sprintf("name/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if a.Users().Get(fmt.Sprintf("U%d", i%n)) == nil {
+					b.Fatal("not found")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("subject/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if a.Users().Get(fmt.Sprintf("SU%d", i%n)) == nil {
+					b.Fatal("not found")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("missing/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if a.Users().Get("missing") != nil {
+					b.Fatal("found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUserAddDelete(b *testing.B) {
+	for _, n := range counts {
+		a := benchAccount(b, n)
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := a.Users().Add("V", ""); err != nil {
+					b.Fatal(err)
+				}
+				if err := a.Users().Delete("V"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUserCreds(b *testing.B) {
+	for _, n := range counts {
+		a := benchAccount(b, n)
+		sk, err := a.ScopedSigningKeys().Add()
+		require.NoError(b, err)
+		_, err = a.Users().Add("V", sk)
+		require.NoError(b, err)
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := a.Users().Get("V").Creds(time.Hour); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAccountGet(b *testing.B) {
+	for _, n := range counts {
+		auth, err := authb.NewAuth(mem.NewMemProvider())
+		require.NoError(b, err)
+		o, err := auth.Operators().Add("O")
+		require.NoError(b, err)
+		od := o.(*authb.OperatorData)
+		for i := 0; i < n; i++ {
+			name := fmt.Sprintf("A%d", i)
+			od.AccountDatas = append(od.AccountDatas, &authb.AccountData{
+				BaseData: authb.BaseData{EntityName: name},
+				Operator: od,
+				Claim:    &jwt.AccountClaims{ClaimsData: jwt.ClaimsData{Subject: "S" + name}},
+			})
+		}
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if o.Accounts().Get(fmt.Sprintf("A%d", i%n)) == nil {
+					b.Fatal("not found")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+
+	"testing"
+)
+
+func Test_MemProviderCopiesData(t *testing.T) {
+	p := mem.NewMemProvider()
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	_, err = o.Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	// uncommitted edits are not visible to other loads
+	_, err = o.Accounts().Add("B")
+	require.NoError(t, err)
+	operators, err := p.Load()
+	require.NoError(t, err)
+	require.Len(t, operators, 1)
+	require.Len(t, operators[0].AccountDatas, 1)
+
+	// edits to loaded data are not visible either
+	operators[0].AccountDatas = nil
+	operators, err = p.Load()
+	require.NoError(t, err)
+	require.Len(t, operators[0].AccountDatas, 1)
+}
+
+func Test_MemProviderSnapshotRestore(t *testing.T) {
+	p := mem.NewMemProvider()
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	_, err = o.Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+	snap := p.Snapshot()
+
+	require.NoError(t, o.Accounts().Delete("A"))
+	b, err := o.Accounts().Add("B")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+	k, err := p.GetKey(b.Subject())
+	require.NoError(t, err)
+	require.NotNil(t, k)
+
+	p.Restore(snap)
+	require.NoError(t, auth.Reload())
+	o = auth.Operators().Get("O")
+	require.NotNil(t, o.Accounts().Get("A"))
+	require.Nil(t, o.Accounts().Get("B"))
+	k, err = p.GetKey(b.Subject())
+	require.NoError(t, err)
+	require.Nil(t, k)
+}
+
+func Test_MemProviderFailStore(t *testing.T) {
+	p := mem.NewMemProvider()
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	sk, err := o.SigningKeys().Add()
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	boom := errors.New("boom")
+	p.FailStore(boom, 1)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	ok, err := o.SigningKeys().Delete(sk)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.ErrorIs(t, auth.Commit(), boom)
+
+	// the added seeds were written, the deleted seeds are kept
+	k, err := p.GetKey(a.Subject())
+	require.NoError(t, err)
+	require.NotNil(t, k)
+	k, err = p.GetKey(sk)
+	require.NoError(t, err)
+	require.NotNil(t, k)
+
+	// nothing was stored, and reloading discards the edits
+	require.NoError(t, auth.Reload())
+	o = auth.Operators().Get("O")
+	require.Nil(t, o.Accounts().Get("A"))
+
+	// the failure only applied to one call
+	_, err = o.Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+	require.NoError(t, auth.Reload())
+	require.NotNil(t, auth.Operators().Get("O").Accounts().Get("A"))
+
+	p.FailStore(boom, -1)
+	require.ErrorIs(t, auth.Commit(), boom)
+	require.ErrorIs(t, auth.Commit(), boom)
+	p.FailStore(nil, 0)
+	require.NoError(t, auth.Commit())
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"github.com/nats-io/jwt/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+
+	"testing"
+)
+
+type MemStore struct {
+	provider *mem.MemProvider
+	t        *testing.T
+}
+
+func NewMemStore(t *testing.T, p *mem.MemProvider) *MemStore {
+	return &MemStore{provider: p, t: t}
+}
+
+func (ts *MemStore) KeyExists(k string) bool {
+	v, err := ts.provider.GetKey(k)
+	require.NoError(ts.t, err)
+	return v != nil
+}
+
+func (ts *MemStore) GetKey(k string) *authb.Key {
+	v, err := ts.provider.GetKey(k)
+	require.NoError(ts.t, err)
+	return v
+}
+
+func (ts *MemStore) operator(name string) *authb.OperatorData {
+	operators, err := ts.provider.Load()
+	require.NoError(ts.t, err)
+	for _, o := range operators {
+		if o.Name() == name || o.Subject() == name {
+			return o
+		}
+	}
+	return nil
+}
+
+func (ts *MemStore) account(operator string, name string) *authb.AccountData {
+	o := ts.operator(operator)
+	if o == nil {
+		return nil
+	}
+	for _, a := range o.AccountDatas {
+		if a.Name() == name || a.Subject() == name {
+			return a
+		}
+	}
+	return nil
+}
+
+func (ts *MemStore) user(operator string, account string, name string) *authb.UserData {
+	a := ts.account(operator, account)
+	if a == nil {
+		return nil
+	}
+	for _, u := range a.UserDatas {
+		if u.Name() == name || u.Subject() == name {
+			return u
+		}
+	}
+	return nil
+}
+
+func (ts *MemStore) OperatorExists(name string) bool {
+	return ts.operator(name) != nil
+}
+
+func (ts *MemStore) GetOperator(name string) *jwt.OperatorClaims {
+	o := ts.operator(name)
+	require.NotNil(ts.t, o)
+	return o.Claim
+}
+
+func (ts *MemStore) AccountExists(operator string, name string) bool {
+	return ts.account(operator, name) != nil
+}
+
+func (ts *MemStore) GetAccount(operator string, name string) *jwt.AccountClaims {
+	a := ts.account(operator, name)
+	if a == nil {
+		return nil
+	}
+	return a.Claim
+}
+
+func (ts *MemStore) UserExists(operator string, account string, name string) bool {
+	return ts.user(operator, account, name) != nil
+}
+
+func (ts *MemStore) GetUser(operator string, account string, name string) *jwt.UserClaims {
+	u := ts.user(operator, account, name)
+	if u == nil {
+		return nil
+	}
+	return u.Claim
+}
+
+func (ts *MemStore) Cleanup() {
+}
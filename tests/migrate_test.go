@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/migrate"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/kv"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/nsc"
+
+	"testing"
+)
+
+// populateWithSigningKeys creates an operator with a signing key, an account
+// with a scoped signing key and users issued by both the account and the scope
+func populateWithSigningKeys(t *testing.T, p authb.AuthProvider) {
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	_, err = o.SigningKeys().Add()
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	scope, err := a.ScopedSigningKeys().AddScope("admin")
+	require.NoError(t, err)
+	_, err = a.Users().Add("U", "")
+	require.NoError(t, err)
+	_, err = a.Users().Add("S", scope.Key())
+	require.NoError(t, err)
+	_, err = o.Accounts().Add("B")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+}
+
+func Test_MigrateNscToKv(t *testing.T) {
+	ts := NewNscStore(t)
+	from := nsc.NewNscProvider(ts.StoresDir(), ts.KeysDir())
+	populateWithSigningKeys(t, from)
+
+	s := StartJetStreamServer(t)
+	nc, err := nats.Connect(s.ClientURL())
+	require.NoError(t, err)
+	to, err := kv.NewKvProviderWithConnection(nc, nuid.Next(), "")
+	require.NoError(t, err)
+	defer to.Disconnect()
+
+	r, err := migrate.Migrate(from, to, migrate.Options{})
+	require.NoError(t, err)
+	require.Len(t, r.Entries, 5)
+	// operator, signing key, 2 accounts, scope, 2 users
+	require.Len(t, r.Keys, 7)
+	require.Empty(t, r.MissingKeys)
+	require.NoError(t, migrate.Verify(from, to, migrate.Options{}))
+
+	// the migrated store is usable
+	auth, err := authb.NewAuth(to)
+	require.NoError(t, err)
+	a := auth.Operators().Get("O").Accounts().Get("A")
+	require.NotNil(t, a)
+	u := a.Users().Get("S")
+	require.NotNil(t, u)
+	require.True(t, u.IsScoped())
+	require.NoError(t, a.Limits().SetMaxConnections(10))
+	require.NoError(t, auth.Commit())
+
+	// the stores now differ
+	var ve *migrate.VerifyError
+	require.ErrorAs(t, migrate.Verify(from, to, migrate.Options{}), &ve)
+	require.Len(t, ve.Differences, 1)
+
+	// operators are not overwritten
+	_, err = migrate.Migrate(from, to, migrate.Options{})
+	require.Error(t, err)
+}
+
+func Test_MigrateDryRun(t *testing.T) {
+	from := mem.NewMemProvider()
+	populateWithSigningKeys(t, from)
+	to := mem.NewMemProvider()
+
+	r, err := migrate.Migrate(from, to, migrate.Options{DryRun: true})
+	require.NoError(t, err)
+	require.True(t, r.DryRun)
+	require.Len(t, r.Entries, 5)
+	require.Contains(t, r.String(), "would copy account O/A")
+
+	operators, err := to.Load()
+	require.NoError(t, err)
+	require.Empty(t, operators)
+	require.Error(t, migrate.Verify(from, to, migrate.Options{}))
+}
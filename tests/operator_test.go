@@ -5,6 +5,7 @@ import (
 	"github.com/nats-io/nkeys"
 	"github.com/stretchr/testify/require"
 	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"time"
 )
 
 func (suite *ProviderSuite) Test_OperatorBasics() {
@@ -46,6 +47,15 @@ func (suite *ProviderSuite) Test_OperatorValidation() {
 	o, err := auth.Operators().Add("O")
 	require.NoError(t, err)
 	require.Error(t, o.SetOperatorServiceURL("foo://localhost:8080"))
+
+	// an operator that is not yet valid can be edited, an expired one cannot
+	o, err = auth.Operators().Add("P")
+	require.NoError(t, err)
+	require.NoError(t, o.SetNotBefore(time.Now().Add(time.Hour).Unix()))
+	require.NoError(t, o.SetOperatorServiceURL("nats://localhost:4222"))
+	o, err = auth.Operators().Add("Q")
+	require.NoError(t, err)
+	require.ErrorContains(t, o.SetExpiry(time.Now().Add(-time.Hour).Unix()), "claim is expired")
 }
 
 func (suite *ProviderSuite) Test_OperatorLoads() {
@@ -103,7 +113,7 @@ func (suite *ProviderSuite) Test_OperatorSigningKeys() {
 	require.NoError(t, auth.Commit())
 
 	ok, err = o.SigningKeys().Delete(sk2)
-	require.NoError(t, err)
+	require.ErrorIs(t, err, authb.ErrKeyNotFound)
 	require.False(t, ok)
 
 	keys = o.SigningKeys().List()
@@ -171,6 +181,30 @@ func (suite *ProviderSuite) Test_OperatorUsesSigningKeyToSignAccount() {
 	require.Equal(t, sk, ac.ClaimsData.Issuer)
 }
 
+func (suite *ProviderSuite) Test_OperatorSigningKeyDeleteStopsSigning() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	sk, err := o.SigningKeys().Add()
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	require.Equal(t, sk, a.Issuer())
+
+	ok, err := o.SigningKeys().Delete(sk)
+	require.NoError(t, err)
+	require.True(t, ok)
+	// edits are signed by the remaining key
+	require.NoError(t, a.SetExpiry(time.Now().Add(time.Hour).Unix()))
+	require.Equal(t, o.Subject(), a.Issuer())
+	require.NoError(t, auth.Commit())
+
+	ac := suite.Store.GetAccount("O", "A")
+	require.Equal(t, o.Subject(), ac.Issuer)
+}
+
 func (suite *ProviderSuite) Test_OperatorRotate() {
 	t := suite.T()
 	auth, err := authb.NewAuth(suite.Provider)
@@ -242,3 +276,45 @@ func (suite *ProviderSuite) Test_OperatorImport() {
 	require.Equal(t, kp.Public, o.Subject())
 	require.Equal(t, skp.Public, o.SigningKeys().List()[0])
 }
+
+func (suite *ProviderSuite) Test_OperatorBootstrapSystemAccount() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+
+	sys, err := o.BootstrapSystemAccount()
+	require.NoError(t, err)
+	require.Equal(t, authb.SystemAccountName, sys.Name())
+	require.Equal(t, sys.Subject(), o.SystemAccount().Subject())
+	require.NotNil(t, sys.Users().Get(authb.SystemUserName))
+	require.Len(t, sys.(*authb.AccountData).Claim.Exports, 2)
+	require.Len(t, a.(*authb.AccountData).Claim.Imports, 2)
+	require.NoError(t, auth.Commit())
+
+	// running it again doesn't change anything
+	require.NoError(t, auth.Reload())
+	o = auth.Operators().Get("O")
+	tokens := map[string]string{o.Subject(): o.(*authb.OperatorData).Token}
+	for _, a := range o.Accounts().List() {
+		tokens[a.Subject()] = a.(*authb.AccountData).Token
+	}
+	sys, err = o.BootstrapSystemAccount()
+	require.NoError(t, err)
+	require.Equal(t, tokens[sys.Subject()], sys.(*authb.AccountData).Token)
+	require.Equal(t, tokens[o.Subject()], o.(*authb.OperatorData).Token)
+	require.Len(t, o.Accounts().List(), 2)
+	require.Len(t, sys.Users().List(), 1)
+
+	// accounts added later are repaired
+	b, err := o.Accounts().Add("B")
+	require.NoError(t, err)
+	_, err = o.BootstrapSystemAccount()
+	require.NoError(t, err)
+	require.Len(t, b.(*authb.AccountData).Claim.Imports, 2)
+	require.Equal(t, tokens[o.Accounts().Get("A").Subject()], o.Accounts().Get("A").(*authb.AccountData).Token)
+	require.NoError(t, auth.Commit())
+}
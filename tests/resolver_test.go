@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func resolverOperator(t *testing.T) authb.Operator {
+	_, o := resolverAuth(t)
+	return o
+}
+
+func resolverAuth(t *testing.T) (authb.Auth, authb.Operator) {
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	sys, err := o.Accounts().Add("SYS")
+	require.NoError(t, err)
+	require.NoError(t, o.SetSystemAccount(sys))
+	_, err = o.Accounts().Add("A")
+	require.NoError(t, err)
+	return auth, o
+}
+
+func Test_ResolverConfigFull(t *testing.T) {
+	o := resolverOperator(t)
+	dir := t.TempDir()
+	c, err := o.ResolverConfig(authb.ResolverOptions{
+		Dir:         dir,
+		AllowDelete: true,
+		Interval:    time.Minute,
+	})
+	require.NoError(t, err)
+	require.Equal(t, authb.FullResolver, c.Resolver.Type)
+	require.Equal(t, o.SystemAccount().Subject(), c.SystemAccount)
+	require.Len(t, c.ResolverPreload, 2)
+
+	s := StartServerWithConfig(t, c.Text())
+	a := o.Accounts().Get("A")
+	acct, err := s.LookupAccount(a.Subject())
+	require.NoError(t, err)
+	require.Equal(t, a.Subject(), acct.Name)
+	require.Equal(t, o.SystemAccount().Subject(), s.SystemAccount().Name)
+
+	// the JSON output is also a valid server configuration
+	d, err := c.JSON()
+	require.NoError(t, err)
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(d, &m))
+	require.Equal(t, "full", m["resolver"].(map[string]any)["type"])
+	require.Equal(t, "1m0s", m["resolver"].(map[string]any)["interval"])
+	StartServerWithConfig(t, d)
+}
+
+func Test_ResolverConfigCache(t *testing.T) {
+	o := resolverOperator(t)
+	fp := filepath.Join(t.TempDir(), "operator.jwt")
+	require.NoError(t, os.WriteFile(fp, []byte(o.(*authb.OperatorData).Token), 0600))
+
+	c, err := o.ResolverConfig(authb.ResolverOptions{
+		Type:         authb.CacheResolver,
+		Dir:          t.TempDir(),
+		TTL:          time.Hour,
+		OperatorPath: fp,
+	})
+	require.NoError(t, err)
+	require.Equal(t, fp, c.Operator)
+	require.Contains(t, string(c.Text()), "type: cache")
+	StartServerWithConfig(t, c.Text())
+}
+
+func Test_ResolverConfigValidation(t *testing.T) {
+	o := resolverOperator(t)
+	_, err := o.ResolverConfig(authb.ResolverOptions{})
+	require.Error(t, err)
+	_, err = o.ResolverConfig(authb.ResolverOptions{Dir: "/tmp", TTL: time.Hour})
+	require.Error(t, err)
+	_, err = o.ResolverConfig(authb.ResolverOptions{Type: authb.CacheResolver, Dir: "/tmp", AllowDelete: true})
+	require.Error(t, err)
+	_, err = o.ResolverConfig(authb.ResolverOptions{Type: "mem", Dir: "/tmp"})
+	require.Error(t, err)
+}
+
+func Test_WriteResolverDir(t *testing.T) {
+	auth, o := resolverAuth(t)
+	b, err := o.Accounts().Add("B")
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, o.WriteResolverDir(dir))
+
+	for _, a := range o.Accounts().List() {
+		d, err := os.ReadFile(filepath.Join(dir, a.Subject()+".jwt"))
+		require.NoError(t, err)
+		require.Equal(t, a.(*authb.AccountData).Token, string(d))
+	}
+
+	require.NoError(t, o.Accounts().Delete("B"))
+	require.NoError(t, o.WriteResolverDir(dir))
+	_, err = os.Stat(filepath.Join(dir, b.Subject()+".jwt"))
+	require.True(t, os.IsNotExist(err))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// deletions are kept after they are committed
+	d, err := o.Accounts().Add("D")
+	require.NoError(t, err)
+	require.NoError(t, o.WriteResolverDir(dir))
+	require.FileExists(t, filepath.Join(dir, d.Subject()+".jwt"))
+	require.NoError(t, o.Accounts().Delete("D"))
+	require.NoError(t, auth.Commit())
+	require.NoError(t, o.WriteResolverDir(dir))
+	require.NoFileExists(t, filepath.Join(dir, d.Subject()+".jwt"))
+
+	// a server boots with the accounts without preloading them
+	c, err := o.ResolverConfig(authb.ResolverOptions{Dir: dir})
+	require.NoError(t, err)
+	c.ResolverPreload = nil
+	s := StartServerWithConfig(t, c.Text())
+	a := o.Accounts().Get("A")
+	acct, err := s.LookupAccount(a.Subject())
+	require.NoError(t, err)
+	require.Equal(t, a.Subject(), acct.Name)
+}
+
+func Test_RemovedAccountsAreRecordedOnce(t *testing.T) {
+	auth, o := resolverAuth(t)
+	od := o.(*authb.OperatorData)
+	b, err := o.Accounts().Add("B")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	// an account deleted twice, as a provider that doesn't clear the
+	// deletions would report it
+	require.NoError(t, o.Accounts().Delete("B"))
+	od.DeletedAccounts = append(od.DeletedAccounts, od.DeletedAccounts[0])
+	require.NoError(t, auth.Commit())
+	require.Len(t, od.RemovedAccounts, 1)
+	od.DeletedAccounts = append(od.DeletedAccounts, b.(*authb.AccountData))
+	require.NoError(t, auth.Commit())
+	require.Len(t, od.RemovedAccounts, 1)
+
+	// accounts added back with the same key are no longer removed
+	od.AccountDatas = append(od.AccountDatas, b.(*authb.AccountData))
+	require.NoError(t, auth.Commit())
+	require.Empty(t, od.RemovedAccounts)
+}
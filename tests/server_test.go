@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+
+	"testing"
+	"time"
+)
+
+// StartJetStreamServer starts an embedded JetStream enabled server that is
+// shutdown when the test completes
+func StartJetStreamServer(t *testing.T) *server.Server {
+	opts := &server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	}
+	s, err := server.NewServer(opts)
+	require.NoError(t, err)
+	s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("server failed to start")
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+// StartServerWithConfig starts an embedded server using the specified
+// configuration that is shutdown when the test completes
+func StartServerWithConfig(t *testing.T, conf []byte) *server.Server {
+	fp := filepath.Join(t.TempDir(), "server.conf")
+	require.NoError(t, os.WriteFile(fp, conf, 0600))
+	opts, err := server.ProcessConfigFile(fp)
+	require.NoError(t, err)
+	opts.Host = "127.0.0.1"
+	opts.Port = -1
+	opts.NoLog = true
+	opts.NoSigs = true
+	s, err := server.NewServer(opts)
+	require.NoError(t, err)
+	s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("server failed to start")
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/nsc"
+	"github.com/synadia-io/jwt-auth-builder.go/signer"
+
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// moveToSigner creates an operator and account, and moves their
+// seeds from the nsc keystore into a signer server
+func moveToSigner(t *testing.T, p *nsc.NscProvider) (*signer.Server, string, string) {
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	s, err := signer.NewServer()
+	require.NoError(t, err)
+	for _, pk := range []string{o.Subject(), a.Subject()} {
+		k, err := p.GetKey(pk)
+		require.NoError(t, err)
+		require.NoError(t, s.Add(k.Pair))
+		require.NoError(t, p.DeleteKey(pk))
+	}
+	return s, o.Subject(), a.Subject()
+}
+
+func testRemoteSigning(t *testing.T, p *nsc.NscProvider, r signer.Remote, opk string, apk string) {
+	auth, err := authb.NewAuthWithKeyStore(p, signer.NewKeyStore(r, p))
+	require.NoError(t, err)
+	o := auth.Operators().Get("O")
+	require.NotNil(t, o)
+	require.Nil(t, o.(*authb.OperatorData).Key.Seed)
+
+	// the operator signs the account remotely
+	a := o.Accounts().Get("A")
+	require.NotNil(t, a)
+	require.Nil(t, a.(*authb.AccountData).Key.Seed)
+	require.NoError(t, a.Limits().SetMaxConnections(10))
+	ac, err := jwt.DecodeAccountClaims(a.(*authb.AccountData).Token)
+	require.NoError(t, err)
+	require.Equal(t, opk, ac.Issuer)
+	require.Equal(t, int64(10), ac.Limits.Conn)
+
+	// the account signs the user remotely, the user key is local
+	u, err := a.Users().Add("U", "")
+	require.NoError(t, err)
+	require.Equal(t, apk, u.Issuer())
+	_, err = u.Creds(0)
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	k, err := p.GetKey(u.Subject())
+	require.NoError(t, err)
+	require.NotNil(t, k)
+	k, err = p.GetKey(apk)
+	require.NoError(t, err)
+	require.Nil(t, k)
+}
+
+func Test_LocalSigner(t *testing.T) {
+	ts := NewNscStore(t)
+	p := nsc.NewNscProvider(ts.StoresDir(), ts.KeysDir())
+	s, opk, apk := moveToSigner(t, p)
+	testRemoteSigning(t, p, s, opk, apk)
+}
+
+func Test_NatsSigner(t *testing.T) {
+	ns := StartJetStreamServer(t)
+	ts := NewNscStore(t)
+	p := nsc.NewNscProvider(ts.StoresDir(), ts.KeysDir())
+	s, opk, apk := moveToSigner(t, p)
+
+	nc, err := nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+	_, err = s.ServeNats(nc, "")
+	require.NoError(t, err)
+
+	testRemoteSigning(t, p, signer.NewNatsRemote(nc, "", 0), opk, apk)
+}
+
+func Test_UnixSigner(t *testing.T) {
+	ts := NewNscStore(t)
+	p := nsc.NewNscProvider(ts.StoresDir(), ts.KeysDir())
+	s, opk, apk := moveToSigner(t, p)
+
+	fp := filepath.Join(t.TempDir(), "signer.sock")
+	l, err := net.Listen("unix", fp)
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		_ = s.ServeUnix(l)
+	}()
+
+	testRemoteSigning(t, p, signer.NewUnixRemote(fp, 0), opk, apk)
+}
+
+func Test_SignerRejectsUnknownKey(t *testing.T) {
+	s, err := signer.NewServer()
+	require.NoError(t, err)
+	kp, err := nkeys.CreateAccount()
+	require.NoError(t, err)
+	pk, err := kp.PublicKey()
+	require.NoError(t, err)
+	_, err = s.Sign(pk, []byte("hello"))
+	require.ErrorIs(t, err, signer.ErrUnknownKey)
+
+	// remotes map the error code of the response to the error
+	fp := filepath.Join(t.TempDir(), "signer.sock")
+	l, err := net.Listen("unix", fp)
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		_ = s.ServeUnix(l)
+	}()
+	_, err = signer.NewUnixRemote(fp, 0).Sign(pk, []byte("hello"))
+	require.ErrorIs(t, err, signer.ErrUnknownKey)
+	require.ErrorContains(t, err, pk)
+
+	ns := StartJetStreamServer(t)
+	nc, err := nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+	_, err = s.ServeNats(nc, "")
+	require.NoError(t, err)
+	_, err = signer.NewNatsRemote(nc, "", 0).Sign(pk, []byte("hello"))
+	require.ErrorIs(t, err, signer.ErrUnknownKey)
+}
@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"github.com/synadia-io/jwt-auth-builder.go/spec"
+	"strings"
+	"testing"
+	"time"
+)
+
+const specYaml = `
+operators:
+  - name: O
+    signing_keys: 1
+    system_account: SYS
+    service_urls: [nats://localhost:4222]
+    accounts:
+      - name: SYS
+      - name: A
+        limits:
+          connections: 10
+        jetstream:
+          - tier: 0
+            disk_storage: -1
+            memory_storage: -1
+        signing_keys: 1
+        scopes:
+          - role: service
+            sub:
+              allow: ["q.>"]
+            response:
+              max_messages: 1
+              expires: 1s
+        exports:
+          - subject: "q.>"
+            type: service
+        users:
+          - name: U
+            pub:
+              allow: ["a.>"]
+            subscriptions: 100
+          - name: S
+            scope: service
+      - name: B
+        imports:
+          - subject: "q.>"
+            account: A
+            type: service
+`
+
+// steps returns the steps of the plan as strings without the skipped ones
+func steps(p *spec.Plan) []string {
+	var v []string
+	for _, s := range p.Pending() {
+		v = append(v, string(s.Action)+" "+s.Kind+" "+s.Path+" "+s.Field)
+	}
+	return v
+}
+
+func Test_SpecLoad(t *testing.T) {
+	s, err := spec.Load(strings.NewReader(specYaml))
+	require.NoError(t, err)
+	require.Len(t, s.Operators, 1)
+	a := s.Operators[0].Accounts[1]
+	require.Equal(t, "A", a.Name)
+	require.Equal(t, int64(10), *a.Limits.Connections)
+	require.Equal(t, time.Second, a.Scopes[0].Response.Expires)
+	require.Equal(t, []string{"a.>"}, a.Users[0].Pub.Allow)
+	require.Equal(t, "service", a.Users[1].Scope)
+
+	// JSON is also accepted
+	s, err = spec.Load(strings.NewReader(`{"operators": [{"name": "O", "accounts": [{"name": "A", "expiry": "2030-01-01T00:00:00Z"}]}]}`))
+	require.NoError(t, err)
+	require.Equal(t, int64(1893456000), s.Operators[0].Accounts[0].Expiry.Unix())
+
+	_, err = spec.Load(strings.NewReader("operators:\n  - name: O\n    unknown: true\n"))
+	require.Error(t, err)
+	_, err = spec.Load(strings.NewReader("operators:\n  - name: O\n  - name: O\n"))
+	require.ErrorContains(t, err, "duplicate operator")
+	_, err = spec.Load(strings.NewReader("operators:\n  - name: O\n    accounts:\n      - name: A\n        scopes:\n          - role: service\n        users:\n          - name: U\n            scope: missing\n"))
+	require.ErrorContains(t, err, "unknown scope")
+	_, err = spec.Load(strings.NewReader("operators:\n  - name: O\n    system_account: SYS\n    accounts:\n      - name: A\n"))
+	require.ErrorContains(t, err, "system account")
+}
+
+func Test_ReconcilePlanAndApply(t *testing.T) {
+	s, err := spec.Load(strings.NewReader(specYaml))
+	require.NoError(t, err)
+	p := mem.NewMemProvider()
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+
+	// planning doesn't change the store
+	r := spec.NewReconciler(auth, s, spec.Options{})
+	plan, err := r.Plan()
+	require.NoError(t, err)
+	require.Nil(t, auth.Operators().Get("O"))
+	require.Equal(t, []string{
+		"create operator O ",
+		"create signing key O ",
+		"create account O/SYS ",
+		"create account O/A ",
+		"create account O/B ",
+		"create signing key O/A ",
+		"create scope O/A/service ",
+		"create user O/A/U ",
+		"create user O/A/S ",
+	}, steps(plan))
+
+	applied, err := r.Apply()
+	require.NoError(t, err)
+	require.Equal(t, steps(plan), steps(applied))
+	require.NoError(t, auth.Commit())
+
+	o := auth.Operators().Get("O")
+	require.NotNil(t, o)
+	require.Len(t, o.SigningKeys().List(), 1)
+	require.Equal(t, "SYS", o.SystemAccount().Name())
+	require.Equal(t, []string{"nats://localhost:4222"}, o.OperatorServiceURLs())
+	a := o.Accounts().Get("A")
+	require.Equal(t, int64(10), a.Limits().MaxConnections())
+	js, err := a.Limits().JetStream().Get(0)
+	require.NoError(t, err)
+	disk, err := js.MaxDiskStorage()
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), disk)
+	sl := a.ScopedSigningKeys().GetScopeByRole("service")
+	require.NotNil(t, sl)
+	require.Equal(t, []string{"q.>"}, sl.SubPermissions().Allow())
+	require.Equal(t, 1, sl.ResponsePermissions().MaxMessages())
+	require.Equal(t, sl.Key(), a.Users().Get("S").Issuer())
+	u := a.Users().Get("U")
+	require.Equal(t, a.Subject(), u.Issuer())
+	require.Equal(t, int64(100), u.MaxSubscriptions())
+	require.Equal(t, []string{"a.>"}, u.PubPermissions().Allow())
+	ad := a.(*authb.AccountData)
+	require.Len(t, ad.Claim.Exports, 1)
+	bd := o.Accounts().Get("B").(*authb.AccountData)
+	require.Len(t, bd.Claim.Imports, 1)
+	require.Equal(t, a.Subject(), bd.Claim.Imports[0].Account)
+
+	// the store is in the state of the spec
+	require.NoError(t, auth.Reload())
+	plan, err = spec.NewReconciler(auth, s, spec.Options{}).Plan()
+	require.NoError(t, err)
+	require.True(t, plan.Empty(), plan.String())
+}
+
+func Test_ReconcileDeletes(t *testing.T) {
+	s, err := spec.Load(strings.NewReader(specYaml))
+	require.NoError(t, err)
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(t, err)
+	_, err = spec.NewReconciler(auth, s, spec.Options{}).Apply()
+	require.NoError(t, err)
+	o := auth.Operators().Get("O")
+	a := o.Accounts().Get("A")
+	sk := a.Users().Get("S").Issuer()
+
+	// drop B and U, move S to the account and raise the connections
+	oa := &s.Operators[0]
+	oa.Accounts = oa.Accounts[:2]
+	sa := &oa.Accounts[1]
+	conns := int64(20)
+	sa.Limits.Connections = &conns
+	sa.Users = []spec.User{{Name: "S"}}
+
+	r := spec.NewReconciler(auth, s, spec.Options{})
+	plan, err := r.Apply()
+	require.NoError(t, err)
+	require.Equal(t, []string{"update account O/A limits.connections"}, steps(plan))
+	require.Len(t, plan.Skipped(), 4)
+	for _, s := range plan.Skipped() {
+		require.Contains(t, s.Reason, "key deletion is not allowed", s.String())
+	}
+	require.Equal(t, int64(20), a.Limits().MaxConnections())
+	require.NotNil(t, o.Accounts().Get("B"))
+	require.NotNil(t, a.Users().Get("U"))
+	require.Equal(t, sk, a.Users().Get("S").Issuer())
+
+	plan, err = spec.NewReconciler(auth, s, spec.Options{AllowKeyDeletion: true}).Apply()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"delete user O/A/S ",
+		"create user O/A/S ",
+		"delete user O/A/U ",
+		"delete account O/B ",
+	}, steps(plan))
+	require.Nil(t, o.Accounts().Get("B"))
+	require.Nil(t, a.Users().Get("U"))
+	require.Equal(t, a.Subject(), a.Users().Get("S").Issuer())
+	require.NoError(t, auth.Commit())
+
+	// the system account is never deleted
+	oa.Accounts = oa.Accounts[1:]
+	oa.SystemAccount = ""
+	plan, err = spec.NewReconciler(auth, s, spec.Options{AllowKeyDeletion: true}).Plan()
+	require.NoError(t, err)
+	require.True(t, plan.Empty())
+	require.Len(t, plan.Skipped(), 1)
+	require.Equal(t, "the system account can't be deleted", plan.Skipped()[0].Reason)
+}
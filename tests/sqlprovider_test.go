@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/sqlite"
+
+	"path/filepath"
+	"testing"
+)
+
+func Test_SqlProviderEncryptedSeeds(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "auth.db")
+	k := curveSeed(t)
+	p, err := sqlite.Open(fp, k)
+	require.NoError(t, err)
+	defer p.Close()
+
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	var seed []byte
+	var encrypted bool
+	require.NoError(t, p.Db.QueryRow("SELECT seed, encrypted FROM seeds WHERE public_key = ?", o.Subject()).
+		Scan(&seed, &encrypted))
+	require.True(t, encrypted)
+	require.NotEqual(t, byte('S'), seed[0])
+
+	key, err := p.GetKey(o.Subject())
+	require.NoError(t, err)
+	require.Equal(t, o.Subject(), key.Public)
+
+	// without the key the seeds cannot be read
+	p2, err := sqlite.Open(fp, "")
+	require.NoError(t, err)
+	defer p2.Close()
+	_, err = authb.NewAuth(p2)
+	require.Error(t, err)
+}
+
+func Test_SqlProviderSigningKeys(t *testing.T) {
+	ts := NewSqlStore(t)
+	defer ts.Cleanup()
+	auth, err := authb.NewAuth(ts.provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	scope, err := a.ScopedSigningKeys().AddScope("admin")
+	require.NoError(t, err)
+	_, err = a.Users().Add("U", scope.Key())
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	var owner, role string
+	require.NoError(t, ts.provider.Db.QueryRow("SELECT owner_key, role FROM signing_keys WHERE scoped = 1").
+		Scan(&owner, &role))
+	require.Equal(t, a.Subject(), owner)
+	require.Equal(t, "admin", role)
+
+	var n int
+	require.NoError(t, ts.provider.Db.QueryRow("SELECT COUNT(*) FROM users WHERE issuer = ?", scope.Key()).Scan(&n))
+	require.Equal(t, 1, n)
+
+	require.NoError(t, o.Accounts().Delete("A"))
+	require.NoError(t, auth.Commit())
+	require.NoError(t, ts.provider.Db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n))
+	require.Equal(t, 0, n)
+	require.NoError(t, ts.provider.Db.QueryRow("SELECT COUNT(*) FROM signing_keys").Scan(&n))
+	require.Equal(t, 0, n)
+}
+
+func Test_SqlProviderOrphanRows(t *testing.T) {
+	// without the foreign_keys pragma rows can reference missing entities
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "auth.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	p, err := sqlite.NewSqlProvider(db, "")
+	require.NoError(t, err)
+
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	_, err = auth.Operators().Add("O")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	_, err = db.Exec(`INSERT INTO users(public_key, account_key, name, issuer, jwt, issued_at, expires)
+		VALUES('UX', 'AX', 'U', 'AX', '', 0, 0)`)
+	require.NoError(t, err)
+	_, err = authb.NewAuth(p)
+	require.ErrorContains(t, err, "account AX not found")
+
+	_, err = db.Exec("DELETE FROM users")
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO accounts(public_key, operator_key, name, issuer, jwt, issued_at, expires)
+		VALUES('AX', 'OX', 'A', 'OX', '', 0, 0)`)
+	require.NoError(t, err)
+	_, err = authb.NewAuth(p)
+	require.ErrorContains(t, err, "operator OX not found")
+}
+
+func Test_SqlProviderStoresModifiedRows(t *testing.T) {
+	ts := NewSqlStore(t)
+	defer ts.Cleanup()
+	auth, err := authb.NewAuth(ts.provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	_, err = o.Accounts().Add("A")
+	require.NoError(t, err)
+	_, err = o.Accounts().Add("B")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	// rows of entities that were loaded and not modified are not written
+	auth, err = authb.NewAuth(ts.provider)
+	require.NoError(t, err)
+	_, err = ts.provider.Db.Exec("UPDATE accounts SET issuer = 'X' WHERE name = 'B'")
+	require.NoError(t, err)
+	a := auth.Operators().Get("O").Accounts().Get("A")
+	require.NoError(t, a.Limits().SetMaxConnections(5))
+	require.NoError(t, auth.Commit())
+
+	var issuer string
+	require.NoError(t, ts.provider.Db.QueryRow("SELECT issuer FROM accounts WHERE name = 'B'").Scan(&issuer))
+	require.Equal(t, "X", issuer)
+}
+
+func Test_SqlProviderUniqueNames(t *testing.T) {
+	ts := NewSqlStore(t)
+	defer ts.Cleanup()
+	auth, err := authb.NewAuth(ts.provider)
+	require.NoError(t, err)
+	_, err = auth.Operators().Add("O")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	auth1, err := authb.NewAuth(ts.provider)
+	require.NoError(t, err)
+	auth2, err := authb.NewAuth(ts.provider)
+	require.NoError(t, err)
+	a1, err := auth1.Operators().Get("O").Accounts().Add("A")
+	require.NoError(t, err)
+	_, err = a1.Users().Add("U", "")
+	require.NoError(t, err)
+	_, err = auth2.Operators().Get("O").Accounts().Add("A")
+	require.NoError(t, err)
+	require.NoError(t, auth1.Commit())
+	require.ErrorIs(t, auth2.Commit(), authb.ErrAlreadyExists)
+
+	auth1, err = authb.NewAuth(ts.provider)
+	require.NoError(t, err)
+	auth2, err = authb.NewAuth(ts.provider)
+	require.NoError(t, err)
+	_, err = auth1.Operators().Get("O").Accounts().Get("A").Users().Add("V", "")
+	require.NoError(t, err)
+	_, err = auth2.Operators().Get("O").Accounts().Get("A").Users().Add("V", "")
+	require.NoError(t, err)
+	require.NoError(t, auth1.Commit())
+	require.ErrorIs(t, auth2.Commit(), authb.ErrAlreadyExists)
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/nats-io/jwt/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/sqlite"
+
+	"path/filepath"
+	"testing"
+)
+
+type SqlStore struct {
+	provider *sqlite.SqlProvider
+	t        *testing.T
+}
+
+func NewSqlStore(t *testing.T) *SqlStore {
+	p, err := sqlite.Open(filepath.Join(t.TempDir(), "auth.db"), "")
+	require.NoError(t, err)
+	return &SqlStore{provider: p, t: t}
+}
+
+func (ts *SqlStore) token(query string, args ...any) string {
+	var token string
+	err := ts.provider.Db.QueryRow(query, args...).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ""
+	}
+	require.NoError(ts.t, err)
+	return token
+}
+
+func (ts *SqlStore) KeyExists(k string) bool {
+	var n int
+	require.NoError(ts.t, ts.provider.Db.QueryRow("SELECT COUNT(*) FROM seeds WHERE public_key = ?", k).Scan(&n))
+	return n == 1
+}
+
+func (ts *SqlStore) GetKey(k string) *authb.Key {
+	v, err := ts.provider.GetKey(k)
+	require.NoError(ts.t, err)
+	return v
+}
+
+func (ts *SqlStore) operatorJwt(name string) string {
+	return ts.token("SELECT jwt FROM operators WHERE name = ? OR public_key = ?", name, name)
+}
+
+func (ts *SqlStore) accountJwt(operator string, name string) string {
+	return ts.token(`SELECT a.jwt FROM accounts a JOIN operators o ON a.operator_key = o.public_key
+		WHERE (o.name = ? OR o.public_key = ?) AND (a.name = ? OR a.public_key = ?)`,
+		operator, operator, name, name)
+}
+
+func (ts *SqlStore) userJwt(operator string, account string, name string) string {
+	return ts.token(`SELECT u.jwt FROM users u JOIN accounts a ON u.account_key = a.public_key
+		JOIN operators o ON a.operator_key = o.public_key
+		WHERE (o.name = ? OR o.public_key = ?) AND (a.name = ? OR a.public_key = ?) AND (u.name = ? OR u.public_key = ?)`,
+		operator, operator, account, account, name, name)
+}
+
+func (ts *SqlStore) OperatorExists(name string) bool {
+	return ts.operatorJwt(name) != ""
+}
+
+func (ts *SqlStore) GetOperator(name string) *jwt.OperatorClaims {
+	oc, err := jwt.DecodeOperatorClaims(ts.operatorJwt(name))
+	require.NoError(ts.t, err)
+	return oc
+}
+
+func (ts *SqlStore) AccountExists(operator string, name string) bool {
+	return ts.accountJwt(operator, name) != ""
+}
+
+func (ts *SqlStore) GetAccount(operator string, name string) *jwt.AccountClaims {
+	ac, err := jwt.DecodeAccountClaims(ts.accountJwt(operator, name))
+	require.NoError(ts.t, err)
+	return ac
+}
+
+func (ts *SqlStore) UserExists(operator string, account string, name string) bool {
+	return ts.userJwt(operator, account, name) != ""
+}
+
+func (ts *SqlStore) GetUser(operator string, account string, name string) *jwt.UserClaims {
+	uc, err := jwt.DecodeUserClaims(ts.userJwt(operator, account, name))
+	require.NoError(ts.t, err)
+	return uc
+}
+
+func (ts *SqlStore) Cleanup() {
+	if err := ts.provider.Close(); err != nil {
+		ts.t.Logf("error closing sql provider: %s", err)
+	}
+}
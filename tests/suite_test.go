@@ -5,7 +5,9 @@ import (
 	"github.com/nats-io/nuid"
 	"github.com/stretchr/testify/suite"
 	nats_auth "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/fs"
 	"github.com/synadia-io/jwt-auth-builder.go/providers/kv"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
 	"github.com/synadia-io/jwt-auth-builder.go/providers/nsc"
 	"testing"
 )
@@ -15,6 +17,9 @@ type ProviderType uint8
 const (
 	NscProvider ProviderType = iota
 	KvProvider
+	FsProvider
+	MemProvider
+	SqlProvider
 )
 
 type TestStore interface {
@@ -47,7 +52,8 @@ func (suite *ProviderSuite) SetupTest() {
 	case KvProvider:
 		ts := NewKvStore(suite.T())
 		suite.Store = ts
-		k, err := kv.NewKvProvider(kv.NatsOptions("demo.nats.io:4222",
+		ns := StartJetStreamServer(suite.T())
+		k, err := kv.NewKvProvider(kv.NatsOptions(ns.ClientURL(),
 			nil),
 			kv.Bucket(nuid.Next()),
 			kv.EncryptKey(""))
@@ -57,6 +63,21 @@ func (suite *ProviderSuite) SetupTest() {
 		suite.cleanup = func(t *testing.T) {
 			ts.Cleanup()
 		}
+	case FsProvider:
+		ts := NewFsStore(suite.T())
+		suite.Store = ts
+		suite.Provider = fs.NewFsProvider(ts.Dir(), ts.KeysDir())
+	case MemProvider:
+		p := mem.NewMemProvider()
+		suite.Store = NewMemStore(suite.T(), p)
+		suite.Provider = p
+	case SqlProvider:
+		ts := NewSqlStore(suite.T())
+		suite.Store = ts
+		suite.Provider = ts.provider
+		suite.cleanup = func(t *testing.T) {
+			ts.Cleanup()
+		}
 	default:
 		suite.FailNow("unknown provider type")
 	}
@@ -79,3 +100,21 @@ func Test_KvProvider(t *testing.T) {
 	a.Kind = KvProvider
 	suite.Run(t, a)
 }
+
+func Test_FsProvider(t *testing.T) {
+	a := new(ProviderSuite)
+	a.Kind = FsProvider
+	suite.Run(t, a)
+}
+
+func Test_MemProvider(t *testing.T) {
+	a := new(ProviderSuite)
+	a.Kind = MemProvider
+	suite.Run(t, a)
+}
+
+func Test_SqlProvider(t *testing.T) {
+	a := new(ProviderSuite)
+	a.Kind = SqlProvider
+	suite.Run(t, a)
+}
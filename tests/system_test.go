@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/deploy"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"testing"
+	"time"
+)
+
+func Test_BootstrapSystemAccountServer(t *testing.T) {
+	auth, err := authb.NewAuth(mem.NewMemProvider())
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	u, err := a.Users().Add("U", "")
+	require.NoError(t, err)
+	_, err = o.BootstrapSystemAccount()
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	c, err := o.ResolverConfig(authb.ResolverOptions{Dir: t.TempDir()})
+	require.NoError(t, err)
+	s := StartServerWithConfig(t, c.Text())
+
+	// the sys user can use the system services
+	snc, err := deploy.Connect(s.ClientURL(), o, authb.SystemUserName)
+	require.NoError(t, err)
+	defer snc.Close()
+	_, err = snc.Request("$SYS.REQ.SERVER.PING", nil, time.Second)
+	require.NoError(t, err)
+
+	// accounts can request their own monitoring information
+	nc, err := nats.Connect(s.ClientURL(), nats.UserCredentials(writeCreds(t, u)))
+	require.NoError(t, err)
+	defer nc.Close()
+	m, err := nc.Request(fmt.Sprintf("$SYS.REQ.ACCOUNT.%s.CONNZ", a.Subject()), nil, time.Second)
+	require.NoError(t, err)
+	require.Contains(t, string(m.Data), `"num_connections":1`)
+}
@@ -337,3 +337,122 @@ func (suite *ProviderSuite) Test_Creds() {
 	ud := u.(*authb.UserData)
 	require.Equal(t, int64(0), ud.Claim.Expires)
 }
+
+func (suite *ProviderSuite) Test_UserNotBefore() {
+	t := suite.T()
+	auth, u := setupUser(suite)
+	nbf := time.Now().Add(time.Hour).Unix()
+	require.NoError(t, u.SetNotBefore(nbf))
+	require.Equal(t, nbf, u.NotBefore())
+
+	// not before can't be later than the expiry
+	require.ErrorIs(t, u.SetExpiry(nbf-1), authb.ErrNotBeforeAfterExpiry)
+	require.NoError(t, u.SetExpiry(nbf+60))
+	require.ErrorIs(t, u.SetNotBefore(nbf+61), authb.ErrNotBeforeAfterExpiry)
+	require.Equal(t, nbf, u.NotBefore())
+
+	require.NoError(t, auth.Commit())
+	require.NoError(t, auth.Reload())
+	u = auth.Operators().Get("O").Accounts().Get("A").Users().Get("U")
+	require.Equal(t, nbf, u.NotBefore())
+	require.Equal(t, nbf+60, u.Expiry())
+}
+
+func (suite *ProviderSuite) Test_CredsWithNotBefore() {
+	t := suite.T()
+	_, u := setupUser(suite)
+	nbf := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	creds, err := u.CredsWithNotBefore(nbf, 48*time.Hour)
+	require.NoError(t, err)
+	s, err := jwt.ParseDecoratedJWT(creds)
+	require.NoError(t, err)
+	uc, err := jwt.DecodeUserClaims(s)
+	require.NoError(t, err)
+	require.Equal(t, nbf.Unix(), uc.NotBefore)
+	require.Equal(t, nbf.Add(48*time.Hour).Unix(), uc.Expires)
+
+	// the user is unchanged
+	require.Equal(t, int64(0), u.NotBefore())
+	require.Equal(t, int64(0), u.Expiry())
+
+	// an expiry shorter than the time until the not before is still valid
+	creds, err = u.CredsWithNotBefore(nbf, time.Hour)
+	require.NoError(t, err)
+	s, err = jwt.ParseDecoratedJWT(creds)
+	require.NoError(t, err)
+	uc, err = jwt.DecodeUserClaims(s)
+	require.NoError(t, err)
+	require.Equal(t, nbf.Add(time.Hour).Unix(), uc.Expires)
+
+	// the not before of the user is used if none is specified
+	require.NoError(t, u.SetNotBefore(nbf.Unix()))
+	creds, err = u.Creds(time.Hour)
+	require.NoError(t, err)
+	s, err = jwt.ParseDecoratedJWT(creds)
+	require.NoError(t, err)
+	uc, err = jwt.DecodeUserClaims(s)
+	require.NoError(t, err)
+	require.Equal(t, nbf.Add(time.Hour).Unix(), uc.Expires)
+}
+
+func (suite *ProviderSuite) Test_UserPermissionsReissueUser() {
+	t := suite.T()
+	auth, u := setupUser(suite)
+	token := u.(*authb.UserData).Token
+	require.NoError(t, u.PubPermissions().SetAllow("a.>"))
+	require.NoError(t, u.ConnectionSources().Set("192.0.2.0/24"))
+	require.NotEqual(t, token, u.(*authb.UserData).Token)
+
+	require.NoError(t, auth.Commit())
+	require.NoError(t, auth.Reload())
+	u = auth.Operators().Get("O").Accounts().Get("A").Users().Get("U")
+	require.Equal(t, []string{"a.>"}, u.PubPermissions().Allow())
+	require.Equal(t, []string{"192.0.2.0/24"}, u.ConnectionSources().Sources())
+}
+
+func (suite *ProviderSuite) Test_UserReplacedByName() {
+	t := suite.T()
+	auth, err := authb.NewAuth(suite.Provider)
+	require.NoError(t, err)
+	o, err := auth.Operators().Add("O")
+	require.NoError(t, err)
+	a, err := o.Accounts().Add("A")
+	require.NoError(t, err)
+	_, err = a.Users().Add("U", "")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+
+	// a user deleted before it was stored
+	_, err = a.Users().Add("V", "")
+	require.NoError(t, err)
+	require.NoError(t, a.Users().Delete("V"))
+	// a user replaced by a new one with the same name
+	require.NoError(t, a.Users().Delete("U"))
+	u, err := a.Users().Add("U", "")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+	require.NoError(t, auth.Commit())
+
+	require.NoError(t, auth.Reload())
+	a = auth.Operators().Get("O").Accounts().Get("A")
+	users := a.Users().List()
+	require.Len(t, users, 1)
+	require.Equal(t, u.Subject(), users[0].Subject())
+
+	// an account replaced by a new one with the same name
+	o = auth.Operators().Get("O")
+	b, err := o.Accounts().Add("B")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+	require.NoError(t, o.Accounts().Delete("B"))
+	b, err = o.Accounts().Add("B")
+	require.NoError(t, err)
+	require.NoError(t, auth.Commit())
+	require.NoError(t, auth.Reload())
+	require.Equal(t, b.Subject(), auth.Operators().Get("O").Accounts().Get("B").Subject())
+
+	require.NoError(t, auth.Operators().Get("O").Accounts().Delete("B"))
+	require.NoError(t, auth.Commit())
+	require.NoError(t, auth.Reload())
+	require.Nil(t, auth.Operators().Get("O").Accounts().Get("B"))
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/mem"
+	"github.com/synadia-io/jwt-auth-builder.go/validate"
+	"testing"
+	"time"
+)
+
+// findings returns the findings with the code for the entity subject
+func findings(r *validate.Report, code validate.Code, subject string) []validate.Finding {
+	var v []validate.Finding
+	for _, f := range r.Findings {
+		if f.Code == code && f.Subject == subject {
+			v = append(v, f)
+		}
+	}
+	return v
+}
+
+func Test_ValidateHealthyStore(t *testing.T) {
+	p := mem.NewMemProvider()
+	populateWithSigningKeys(t, p)
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+
+	r := validate.Auth(auth, validate.Options{})
+	require.Empty(t, r.Findings, r.String())
+	require.False(t, r.HasErrors())
+}
+
+func Test_ValidateIssuerChain(t *testing.T) {
+	p := mem.NewMemProvider()
+	populateWithSigningKeys(t, p)
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o := auth.Operators().Get("O")
+	a := o.Accounts().Get("A")
+
+	// S was issued by the scoped signing key
+	s := a.Users().Get("S")
+	scope := a.ScopedSigningKeys().GetScopeByRole("admin")
+	require.NotNil(t, scope)
+	ok, err := a.ScopedSigningKeys().Delete(scope.Key())
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// A was issued by the operator signing key
+	sk := o.SigningKeys().List()[0]
+	require.Equal(t, sk, a.Issuer())
+	ok, err = o.SigningKeys().Delete(sk)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// U has a tampered JWT
+	u := a.Users().Get("U").(*authb.UserData)
+	u.Token = u.Token[:len(u.Token)-4] + "AAAA"
+
+	r := validate.Auth(auth, validate.Options{})
+	require.True(t, r.HasErrors())
+	require.Len(t, findings(r, validate.UntrustedIssuer, a.Subject()), 1)
+	require.Len(t, findings(r, validate.UntrustedIssuer, s.Subject()), 1)
+	require.Len(t, findings(r, validate.InvalidJwt, u.Subject()), 1)
+	f := findings(r, validate.UntrustedIssuer, a.Subject())[0]
+	require.Equal(t, validate.Error, f.Severity)
+	require.Equal(t, "account", f.Kind)
+	require.Equal(t, "O/A", f.Path)
+}
+
+func Test_ValidateExpiry(t *testing.T) {
+	p := mem.NewMemProvider()
+	populateWithSigningKeys(t, p)
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o := auth.Operators().Get("O")
+	a := o.Accounts().Get("A")
+	b := o.Accounts().Get("B")
+	now := time.Now()
+	require.NoError(t, a.SetExpiry(now.Add(time.Hour).Unix()))
+	require.NoError(t, b.SetExpiry(now.Add(30*24*time.Hour).Unix()))
+
+	r := validate.Auth(auth, validate.Options{Now: now})
+	require.False(t, r.HasErrors())
+	require.Len(t, findings(r, validate.Expiring, a.Subject()), 1)
+	require.Empty(t, findings(r, validate.Expiring, b.Subject()))
+
+	r = validate.Auth(auth, validate.Options{Now: now.Add(2 * time.Hour), ExpiryWindow: 31 * 24 * time.Hour})
+	require.True(t, r.HasErrors())
+	require.Len(t, findings(r, validate.Expired, a.Subject()), 1)
+	require.Len(t, findings(r, validate.Expiring, b.Subject()), 1)
+	require.Len(t, r.Filter(validate.Error), 1)
+}
+
+func Test_ValidateImports(t *testing.T) {
+	p := mem.NewMemProvider()
+	populateWithSigningKeys(t, p)
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o := auth.Operators().Get("O")
+	a := o.Accounts().Get("A").(*authb.AccountData)
+	b := o.Accounts().Get("B").(*authb.AccountData)
+
+	a.Claim.Exports.Add(&jwt.Export{Subject: "q.>", Type: jwt.Service},
+		&jwt.Export{Subject: "private.>", Type: jwt.Stream, TokenReq: true})
+	require.NoError(t, a.SetExpiry(0))
+	b.Claim.Imports.Add(
+		&jwt.Import{Subject: "q.a", Account: a.Subject(), Type: jwt.Service},
+		&jwt.Import{Subject: "q.a", Account: a.Subject(), Type: jwt.Stream},
+		&jwt.Import{Subject: "private.a", Account: a.Subject(), Type: jwt.Stream},
+	)
+	require.NoError(t, b.SetExpiry(0))
+
+	r := validate.Auth(auth, validate.Options{})
+	require.Len(t, findings(r, validate.MissingExport, b.Subject()), 1)
+	require.Len(t, findings(r, validate.MissingActivation, b.Subject()), 1)
+	require.Len(t, r.Findings, 2, r.String())
+}
+
+func Test_ValidateMissingSeeds(t *testing.T) {
+	p := mem.NewMemProvider()
+	populateWithSigningKeys(t, p)
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o := auth.Operators().Get("O").(*authb.OperatorData)
+	a := o.Accounts().Get("A").(*authb.AccountData)
+
+	// the KeyStore doesn't have the seeds
+	require.NoError(t, p.DeleteKey(o.OperatorSigningKeys[0].Public))
+	require.NoError(t, p.DeleteKey(a.Subject()))
+	// and an import references an account of another operator
+	other, err := authb.KeyFor(nkeys.PrefixByteAccount)
+	require.NoError(t, err)
+	a.Claim.Imports.Add(&jwt.Import{Subject: "q", Account: other.Public, Type: jwt.Service})
+	require.NoError(t, a.SetExpiry(0))
+	require.NoError(t, auth.Commit())
+	require.NoError(t, auth.Reload())
+
+	r := validate.Auth(auth, validate.Options{})
+	require.False(t, r.HasErrors(), r.String())
+	require.Len(t, findings(r, validate.MissingSeed, o.Subject()), 1)
+	require.Len(t, findings(r, validate.MissingSeed, a.Subject()), 1)
+	require.Len(t, findings(r, validate.UnknownAccount, a.Subject()), 1)
+	require.Len(t, r.Filter(validate.Warning), 3)
+}
+
+func Test_ValidateNotBefore(t *testing.T) {
+	p := mem.NewMemProvider()
+	populateWithSigningKeys(t, p)
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	o := auth.Operators().Get("O")
+	a := o.Accounts().Get("A").(*authb.AccountData)
+	b := o.Accounts().Get("B")
+	now := time.Now()
+	require.NoError(t, b.SetNotBefore(now.Add(time.Hour).Unix()))
+
+	// a provider could load a claim that the setters reject
+	a.Claim.NotBefore = now.Add(2 * time.Hour).Unix()
+	a.Claim.Expires = now.Add(time.Hour).Unix()
+
+	r := validate.Auth(auth, validate.Options{Now: now})
+	require.Len(t, findings(r, validate.NotYetValid, b.Subject()), 1)
+	require.Equal(t, validate.Info, findings(r, validate.NotYetValid, b.Subject())[0].Severity)
+	require.Len(t, findings(r, validate.InvalidValidity, a.Subject()), 1)
+	require.Len(t, r.Filter(validate.Error), 1)
+}
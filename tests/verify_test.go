@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"errors"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/require"
+	authb "github.com/synadia-io/jwt-auth-builder.go"
+	"github.com/synadia-io/jwt-auth-builder.go/providers/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tamperedStore returns a store where account B is re-signed by a foreign
+// operator, user U is re-signed by a foreign account key, and the seed
+// of user S is replaced
+func tamperedStore(t *testing.T) (*FsStore, map[string]string) {
+	ts := NewFsStore(t)
+	p := fs.NewFsProvider(ts.Dir(), ts.KeysDir())
+	populateWithSigningKeys(t, p)
+	auth, err := authb.NewAuth(p)
+	require.NoError(t, err)
+	a := auth.Operators().Get("O").Accounts().Get("A")
+	subjects := map[string]string{
+		"B": auth.Operators().Get("O").Accounts().Get("B").Subject(),
+		"U": a.Users().Get("U").Subject(),
+		"S": a.Users().Get("S").Subject(),
+	}
+
+	resign := func(fp string, prefix nkeys.PrefixByte, decode func(string) (jwt.Claims, error)) {
+		d, err := os.ReadFile(fp)
+		require.NoError(t, err)
+		c, err := decode(string(d))
+		require.NoError(t, err)
+		if uc, ok := c.(*jwt.UserClaims); ok {
+			uc.IssuerAccount = a.Subject()
+		}
+		kp, err := nkeys.CreatePair(prefix)
+		require.NoError(t, err)
+		token, err := c.Encode(kp)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(fp, []byte(token), 0600))
+	}
+	resign(filepath.Join(ts.Dir(), "O", "B.jwt"), nkeys.PrefixByteOperator, func(s string) (jwt.Claims, error) {
+		return jwt.DecodeAccountClaims(s)
+	})
+	resign(filepath.Join(ts.Dir(), "O", "A", "U.jwt"), nkeys.PrefixByteAccount, func(s string) (jwt.Claims, error) {
+		return jwt.DecodeUserClaims(s)
+	})
+
+	k, err := authb.KeyFor(nkeys.PrefixByteUser)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(ts.KeysDir(), subjects["S"]+fs.NKeyExtension), k.Seed, 0600))
+	return ts, subjects
+}
+
+func Test_LoadTrusted(t *testing.T) {
+	ts, _ := tamperedStore(t)
+	auth, err := authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()))
+	require.NoError(t, err)
+	require.NotNil(t, auth.Operators().Get("O").Accounts().Get("B"))
+	require.Empty(t, auth.Quarantined())
+}
+
+func Test_LoadStrict(t *testing.T) {
+	ts, subjects := tamperedStore(t)
+	_, err := authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()), authb.WithLoadMode(authb.LoadStrict))
+	require.Error(t, err)
+	require.ErrorIs(t, err, authb.ErrUntrustedIssuer)
+	require.ErrorIs(t, err, authb.ErrKeyMismatch)
+
+	var le *authb.LoadError
+	require.True(t, errors.As(err, &le))
+	require.Len(t, le.Errors, 3)
+	failed := make(map[string]*authb.VerifyError)
+	for _, v := range le.Errors {
+		failed[v.Subject] = v
+	}
+	require.Equal(t, "account", failed[subjects["B"]].Kind)
+	require.Equal(t, "O/B", failed[subjects["B"]].Path)
+	require.ErrorIs(t, failed[subjects["B"]], authb.ErrUntrustedIssuer)
+	require.Equal(t, "O/A/U", failed[subjects["U"]].Path)
+	require.ErrorIs(t, failed[subjects["U"]], authb.ErrUntrustedIssuer)
+	require.ErrorIs(t, failed[subjects["S"]], authb.ErrKeyMismatch)
+
+	// a healthy store loads
+	ts = NewFsStore(t)
+	populateWithSigningKeys(t, fs.NewFsProvider(ts.Dir(), ts.KeysDir()))
+	_, err = authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()), authb.WithLoadMode(authb.LoadStrict))
+	require.NoError(t, err)
+}
+
+func Test_LoadQuarantine(t *testing.T) {
+	ts, subjects := tamperedStore(t)
+	auth, err := authb.NewAuth(fs.NewFsProvider(ts.Dir(), ts.KeysDir()), authb.WithLoadMode(authb.LoadQuarantine))
+	require.NoError(t, err)
+	require.Len(t, auth.Quarantined(), 3)
+
+	o := auth.Operators().Get("O")
+	require.Nil(t, o.Accounts().Get("B"))
+	a := o.Accounts().Get("A")
+	require.NotNil(t, a)
+	require.Nil(t, a.Users().Get(subjects["U"]))
+	require.Nil(t, a.Users().Get(subjects["S"]))
+	require.Len(t, a.Users().List(), 0)
+	require.NotEmpty(t, auth.Quarantined()[0].Token)
+}
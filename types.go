@@ -14,17 +14,38 @@ type Auth interface {
 	Reload() error
 	// Operators returns an interface for managing operators
 	Operators() Operators
+	// HasChanges returns true if any entity was added, modified or deleted
+	// since the last Load or Commit
+	HasChanges() bool
+	// Changes returns the entities added, modified or deleted since the
+	// last Load or Commit
+	Changes() []Change
 }
 
 // AuthProvider is the interface that wraps the basic Load and
 // Store methods to read/store data into a store. The provider
 // and Auth APIs communicate using the OperatorData, AccountData,
-// and UserData structures.
+// and UserData structures. Providers only persist the JWTs, secrets
+// are resolved and persisted by the library using a KeyStore.
 type AuthProvider interface {
 	Load() ([]*OperatorData, error)
 	Store(operators []*OperatorData) error
 }
 
+// KeyStore is the interface that wraps the methods to read/store the
+// secret keys (seeds) for the entities. A KeyStore can use a different
+// backend than the AuthProvider, so that seeds can be kept with stricter
+// access than the JWTs. The library keeps track of the keys that were
+// added or deleted and updates the KeyStore on Commit().
+type KeyStore interface {
+	// GetKey returns the Key for the specified public key or nil if not found
+	GetKey(pk string) (*Key, error)
+	// PutKey stores the specified Key
+	PutKey(key *Key) error
+	// DeleteKey removes the Key for the specified public key
+	DeleteKey(pk string) error
+}
+
 // BaseData is shared across all entities
 type BaseData struct {
 	// Loaded matches the issue time of a loaded JWT (UTC in seconds). When
@@ -37,30 +58,47 @@ type BaseData struct {
 	// will display simple name which differs from the actual name
 	// of the entity stored in the JWT.
 	EntityName string
-	// Key is the main identity key for the entity.
+	// Key is the main identity key for the entity. Providers can leave
+	// it unset, the library resolves it from the KeyStore.
 	Key *Key
 	// Token is the JWT for the entity, always kept up-to-date
 	// by the APIs
 	Token string
+	// committed is the JWT at the last Load or Commit, used to track changes
+	committed string
 }
 
 type OperatorData struct {
 	BaseData
 	// OperatorSigningKeys is the list of all current signing keys for
-	// the operator. All keys should be reachable by the APIs.
+	// the operator. All keys should be reachable by the APIs. If not set
+	// by the provider, the library resolves them from the KeyStore.
 	OperatorSigningKeys []*Key
+	// committedKeys are the signing keys at the last Load or Commit, so
+	// that Discard can restore deleted keys
+	committedKeys []*Key
 	// Claim is the currently decoded version of the JWT. Always up-to-date by
 	// the APIs.
 	Claim *jwt.OperatorClaims
 	// AccountDatas The list of all Accounts for the operator
 	AccountDatas []*AccountData
+	// accounts indexes AccountDatas by name and subject
+	accounts index[*AccountData]
 	// DeletedAccounts is a list of all accounts that were deleted using
 	// the API. On calling Commit() the AuthProvider will remove them
 	// and set this to nil.
 	DeletedAccounts []*AccountData
-	// AddedKeys is a list of added keys related to the operator entity tree
+	// RemovedAccounts is a list of the accounts removed by Commit(). Unlike
+	// DeletedAccounts it is not cleared by Commit(), so that the deletions
+	// can be propagated to servers after committing. The deploy package
+	// drops the accounts the servers deleted. It is not stored, so it is
+	// empty after a Reload().
+	RemovedAccounts []*AccountData
+	// AddedKeys is a list of added keys related to the operator entity tree.
+	// On calling Commit() the keys are stored in the KeyStore and this is set to nil.
 	AddedKeys []*Key
-	// List of deleted keys related to the operator entity tree
+	// List of deleted keys related to the operator entity tree. On calling
+	// Commit() the keys are removed from the KeyStore and this is set to nil.
 	DeletedKeys []string
 }
 
@@ -69,13 +107,21 @@ type AccountData struct {
 	// Operator the operator that manages the account
 	Operator *OperatorData
 	// AccountSigningKeys is the list of all current signing keys for
-	// the account. All keys should be reachable by the API
+	// the account. All keys should be reachable by the API. If not set
+	// by the provider, the library resolves them from the KeyStore.
 	AccountSigningKeys []*Key
+	// committedKeys are the signing keys at the last Load or Commit, so
+	// that Discard can restore deleted keys
+	committedKeys []*Key
 	// Claim is the currently decoded version of the JWT. Always up-to-date by
 	// the APIs
 	Claim *jwt.AccountClaims
 	// UserData is the list of account users
 	UserDatas []*UserData
+	// users indexes UserDatas by name and subject
+	users index[*UserData]
+	// signingKeys indexes AccountSigningKeys by public key
+	signingKeys index[*Key]
 	//// DeletedUsers is a list of users that will be deleted on the next commit
 	DeletedUsers []*UserData
 }
@@ -123,14 +169,48 @@ type Operator interface {
 	SystemAccount() Account
 	// SetSystemAccount sets the system account
 	SetSystemAccount(account Account) error
+	// BootstrapSystemAccount creates or repairs the system account the way
+	// nsc creates it: a "SYS" account with the standard monitoring exports
+	// and a "sys" user. Other accounts get the matching imports, and the
+	// account is set as the system account. It is safe to call repeatedly,
+	// entities are only reissued when they are missing something.
+	BootstrapSystemAccount() (Account, error)
 	// MemResolver generates a mem resolver server configuration
 	MemResolver() ([]byte, error)
+	// ResolverConfig generates a server configuration for a full or cache
+	// resolver that preloads all the accounts
+	ResolverConfig(opts ResolverOptions) (*ResolverConfig, error)
+	// WriteResolverDir writes the JWT of every account to a full resolver
+	// directory as "<account public key>.jwt", and removes the JWTs of
+	// deleted accounts, whether or not the deletion was committed. Files are
+	// replaced atomically so the directory can be in use by a server.
+	WriteResolverDir(dir string) error
 	// SetExpiry sets the expiry for the operator in Unix Time Seconds.
 	// 0 never expires.
 	SetExpiry(exp int64) error
 	// Expiry returns the expiry for the operator in Unix Time Seconds.
 	// 0 never expires
 	Expiry() int64
+	// SetNotBefore sets the time the operator becomes valid in Unix Time
+	// Seconds. 0 is valid immediately. Returns ErrNotBeforeAfterExpiry if
+	// later than the expiry.
+	SetNotBefore(nbf int64) error
+	// NotBefore returns the time the operator becomes valid in Unix Time
+	// Seconds. 0 is valid immediately
+	NotBefore() int64
+	// Discard reverts the operator and its accounts and users to their
+	// state at the last Load or Commit. Operators that were never committed
+	// can't be discarded.
+	Discard() error
+	// Expiring returns the operator, accounts and users that have an
+	// expiry within the specified duration from now, including the ones
+	// that already expired
+	Expiring(within time.Duration) []ExpiryEntry
+	// Renew extends the expiry of the entities returned by Expiring as
+	// specified by the policy. Entities are re-signed by the key that
+	// issued them, and entities issued by keys whose seeds are not held
+	// are skipped.
+	Renew(within time.Duration, policy RenewalPolicy) (*RenewalReport, error)
 }
 
 // Accounts is an interface for managing accounts
@@ -141,8 +221,9 @@ type Accounts interface {
 	Delete(name string) error
 	// Get returns an Account by matching its name or subject
 	Get(name string) Account
-	// List returns a list of Account
-	List() []Account
+	// List returns a list of Account. Options select a page of the accounts
+	// or filter them.
+	List(opts ...ListOption) []Account
 }
 
 // Account is an interface for editing an account
@@ -161,14 +242,38 @@ type Account interface {
 	Imports() Imports
 	// Exports returns an interface for managing exports
 	Exports() Exports
+	// SetImports replaces the imports of the account
+	SetImports(imports jwt.Imports) error
+	// SetExports replaces the exports of the account
+	SetExports(exports jwt.Exports) error
 	// Limits returns an interface for managing account limits
 	Limits() AccountLimits
+	// SetExternalAuthorization enables auth callout for the account. Users
+	// are the public keys of the users that respond to authorization
+	// requests, accounts are the accounts the issued users can be placed in,
+	// and xkey is an optional public curve key used to encrypt requests.
+	// Setting no users disables auth callout.
+	SetExternalAuthorization(users []string, accounts []string, xkey string) error
+	// ExternalAuthorization returns the auth callout users, allowed
+	// accounts and xkey
+	ExternalAuthorization() ([]string, []string, string)
 	// SetExpiry sets the expiry for the account in Unix Time Seconds.
 	// 0 never expires.
 	SetExpiry(exp int64) error
 	// Expiry returns the expiry for the account in Unix Time Seconds.
 	// 0 never expires
 	Expiry() int64
+	// SetNotBefore sets the time the account becomes valid in Unix Time
+	// Seconds. 0 is valid immediately. Returns ErrNotBeforeAfterExpiry if
+	// later than the expiry.
+	SetNotBefore(nbf int64) error
+	// NotBefore returns the time the account becomes valid in Unix Time
+	// Seconds. 0 is valid immediately
+	NotBefore() int64
+	// Discard reverts the account and its users to their state at the last
+	// Load or Commit. An added account is removed, and a deleted account
+	// is restored.
+	Discard() error
 }
 
 // Users is an interface for managing users
@@ -183,8 +288,9 @@ type Users interface {
 	Delete(name string) error
 	// Get returns the user by matching its name or subject
 	Get(name string) User
-	// List returns a list of User from the account
-	List() []User
+	// List returns a list of User from the account. Options select a page
+	// of the users or filter them.
+	List(opts ...ListOption) []User
 }
 
 // User is an interface for editing a User
@@ -200,6 +306,11 @@ type User interface {
 	// Creds generates a credentials for the specified user. A credentials file is
 	// an armored JWT and nkey secret that a client can use to connect to NATS.
 	Creds(expiry time.Duration) ([]byte, error)
+	// CredsWithNotBefore generates credentials that are not valid before the
+	// specified time. The expiry is relative to the not before, or to now if
+	// the not before is in the past. A zero time keeps the not before of
+	// the user.
+	CredsWithNotBefore(notBefore time.Time, expiry time.Duration) ([]byte, error)
 	// Issuer returns the issuer of the user. Typically, this will be the account's
 	// ID or a signing key. If it is a signing key, IssuerAccount will return the
 	// ID of the account owning the user
@@ -207,6 +318,22 @@ type User interface {
 	// IssuerAccount returns the ID of the account owning the user. Note that if not set,
 	//it returns Issuer
 	IssuerAccount() string
+	// SetExpiry sets the expiry for the user in Unix Time Seconds.
+	// 0 never expires. Scoped users can set an expiry.
+	SetExpiry(exp int64) error
+	// Expiry returns the expiry for the user in Unix Time Seconds.
+	// 0 never expires
+	Expiry() int64
+	// SetNotBefore sets the time the user becomes valid in Unix Time
+	// Seconds. 0 is valid immediately. Returns ErrNotBeforeAfterExpiry if
+	// later than the expiry. Scoped users can set a not before.
+	SetNotBefore(nbf int64) error
+	// NotBefore returns the time the user becomes valid in Unix Time
+	// Seconds. 0 is valid immediately
+	NotBefore() int64
+	// Discard reverts the user to its state at the last Load or Commit.
+	// An added user is removed, and a deleted user is restored.
+	Discard() error
 	UserLimits
 }
 
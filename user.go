@@ -96,6 +96,7 @@ func (u *UserData) ConnectionTypes() ConnectionTypes {
 	v.rejectEdits = u.RejectEdits
 	v.limits = &u.Claim.UserPermissionLimits
 	v.accountData = u.AccountData
+	v.user = u
 	return v
 }
 func (u *UserData) PubPermissions() Permissions {
@@ -104,6 +105,7 @@ func (u *UserData) PubPermissions() Permissions {
 	v.pub = true
 	v.limits = &u.Claim.UserPermissionLimits
 	v.accountData = u.AccountData
+	v.user = u
 	return v
 }
 func (u *UserData) SubPermissions() Permissions {
@@ -111,6 +113,7 @@ func (u *UserData) SubPermissions() Permissions {
 	v.rejectEdits = u.RejectEdits
 	v.limits = &u.Claim.UserPermissionLimits
 	v.accountData = u.AccountData
+	v.user = u
 	return v
 }
 func (u *UserData) ResponsePermissions() ResponsePermissions {
@@ -118,6 +121,7 @@ func (u *UserData) ResponsePermissions() ResponsePermissions {
 	v.rejectEdits = u.RejectEdits
 	v.limits = &u.Claim.UserPermissionLimits
 	v.accountData = u.AccountData
+	v.user = u
 	return v
 }
 
@@ -126,6 +130,7 @@ func (u *UserData) ConnectionSources() ConnectionSources {
 	v.rejectEdits = u.RejectEdits
 	v.limits = &u.Claim.UserPermissionLimits
 	v.accountData = u.AccountData
+	v.user = u
 	return v
 }
 
@@ -133,6 +138,7 @@ func (u *UserData) ConnectionTimes() ConnectionTimes {
 	v := &ConnectionTimesImpl{}
 	v.rejectEdits = u.RejectEdits
 	v.accountData = u.AccountData
+	v.user = u
 	v.limits = &u.Claim.UserPermissionLimits
 	return v
 }
@@ -148,17 +154,58 @@ func (u *UserData) SetLocale(locale string) error {
 	return u.update()
 }
 
+func (u *UserData) SetExpiry(exp int64) error {
+	if err := checkValidity(u.Claim.NotBefore, exp); err != nil {
+		return err
+	}
+	u.Claim.Expires = exp
+	return u.update()
+}
+
+func (u *UserData) Expiry() int64 {
+	return u.Claim.Expires
+}
+
+func (u *UserData) SetNotBefore(nbf int64) error {
+	if err := checkValidity(nbf, u.Claim.Expires); err != nil {
+		return err
+	}
+	u.Claim.NotBefore = nbf
+	return u.update()
+}
+
+func (u *UserData) NotBefore() int64 {
+	return u.Claim.NotBefore
+}
+
 func (u *UserData) Creds(expiry time.Duration) ([]byte, error) {
+	return u.CredsWithNotBefore(time.Time{}, expiry)
+}
+
+func (u *UserData) CredsWithNotBefore(notBefore time.Time, expiry time.Duration) ([]byte, error) {
 	// remember the current configuration
 	token := u.Token
-	if expiry > 0 {
+	if expiry > 0 || !notBefore.IsZero() {
 		defer func() {
 			// restore the old values
 			u.Token = token
 			u.Claim, _ = jwt.DecodeUserClaims(token)
 		}()
-		// if we have an expires, set it
-		u.Claim.Expires = time.Now().Add(expiry).Unix()
+		if !notBefore.IsZero() {
+			u.Claim.NotBefore = notBefore.Unix()
+		}
+		// if we have an expires, set it relative to when the creds
+		// become valid
+		if expiry > 0 {
+			start := time.Now()
+			if nbf := time.Unix(u.Claim.NotBefore, 0); nbf.After(start) {
+				start = nbf
+			}
+			u.Claim.Expires = start.Add(expiry).Unix()
+		}
+		if err := checkValidity(u.Claim.NotBefore, u.Claim.Expires); err != nil {
+			return nil, err
+		}
 		if err := u.update(); err != nil {
 			return nil, err
 		}
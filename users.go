@@ -10,6 +10,9 @@ type UsersImpl struct {
 }
 
 func (a *UsersImpl) Add(name string, key string) (User, error) {
+	if a.Get(name) != nil {
+		return nil, alreadyExists("user", name)
+	}
 	if key == "" {
 		key = a.accountData.Key.Public
 	}
@@ -40,35 +43,34 @@ func (a *UsersImpl) Add(name string, key string) (User, error) {
 	if err != nil {
 		return nil, err
 	}
-	a.accountData.UserDatas = append(a.accountData.UserDatas, d)
+	a.accountData.UserDatas = a.accountData.users.append(a.accountData.UserDatas, d)
 	a.accountData.Operator.AddedKeys = append(a.accountData.Operator.AddedKeys, uk)
 	return d, nil
 }
 
 func (a *UsersImpl) Get(name string) User {
-	for _, u := range a.accountData.UserDatas {
-		if u.EntityName == name || u.Claim.Subject == name {
-			return u
-		}
+	ad := a.accountData
+	if idx := ad.users.find(ad.UserDatas, name); idx != -1 {
+		return ad.UserDatas[idx]
 	}
 	return nil
 }
 
-func (a *UsersImpl) List() []User {
-	v := make([]User, len(a.accountData.UserDatas))
-	for idx, u := range a.accountData.UserDatas {
-		v[idx] = u
-	}
-	return v
+func (a *UsersImpl) List(opts ...ListOption) []User {
+	ad := a.accountData
+	lo := newListOptions(opts)
+	return page(len(ad.UserDatas), func(i int) User { return ad.UserDatas[i] }, lo.users, lo)
 }
 
 func (a *UsersImpl) Delete(name string) error {
-	for idx, u := range a.accountData.UserDatas {
-		if u.EntityName == name || u.Claim.Subject == name {
-			a.accountData.DeletedUsers = append(a.accountData.DeletedUsers, u)
-			a.accountData.UserDatas = append(a.accountData.UserDatas[:idx], a.accountData.UserDatas[idx+1:]...)
-			a.accountData.Operator.DeletedKeys = append(a.accountData.Operator.DeletedKeys, u.Key.Public)
-		}
+	ad := a.accountData
+	idx := ad.users.find(ad.UserDatas, name)
+	if idx == -1 {
+		return notFound("user", name)
 	}
+	u := ad.UserDatas[idx]
+	ad.DeletedUsers = append(ad.DeletedUsers, u)
+	ad.UserDatas = ad.users.remove(ad.UserDatas, idx)
+	ad.Operator.DeletedKeys = append(ad.Operator.DeletedKeys, u.Subject())
 	return nil
 }
@@ -0,0 +1,326 @@
+// Package validate checks the entities of a store for problems, such as
+// broken issuer chains, missing seeds, expired JWTs and imports that can't
+// be satisfied, and reports them as structured findings.
+package validate
+
+import (
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/synadia-io/jwt-auth-builder.go"
+	"strings"
+	"time"
+)
+
+// Severity is the severity of a Finding
+type Severity string
+
+const (
+	// Info findings are informational
+	Info Severity = "info"
+	// Warning findings don't prevent the entity from working, but likely
+	// need attention
+	Warning Severity = "warning"
+	// Error findings prevent the entity from working, or from being edited
+	Error Severity = "error"
+)
+
+var rank = map[Severity]int{
+	Info:    0,
+	Warning: 1,
+	Error:   2,
+}
+
+// Code identifies the check that produced a Finding
+type Code string
+
+const (
+	// InvalidJwt means the JWT of the entity doesn't decode or its
+	// signature doesn't verify
+	InvalidJwt Code = "invalid-jwt"
+	// SubjectMismatch means the JWT is for a different entity
+	SubjectMismatch Code = "subject-mismatch"
+	// InvalidClaim means the claim failed the JWT validation
+	InvalidClaim Code = "invalid-claim"
+	// UntrustedIssuer means the JWT is issued by a key that is not the
+	// parent entity or one of its signing keys
+	UntrustedIssuer Code = "untrusted-issuer"
+	// MissingSeed means the store doesn't have the seed for a key of
+	// the entity
+	MissingSeed Code = "missing-seed"
+	// Expired means the JWT has expired
+	Expired Code = "expired"
+	// Expiring means the JWT expires within the expiry window
+	Expiring Code = "expiring"
+	// NotYetValid means the JWT has a not before in the future
+	NotYetValid Code = "not-yet-valid"
+	// InvalidValidity means the JWT has a not before later than its expiry
+	InvalidValidity Code = "invalid-validity"
+	// UnknownAccount means an import references an account that is not
+	// in the store
+	UnknownAccount Code = "unknown-account"
+	// MissingExport means an import doesn't match an export of the
+	// account it imports from
+	MissingExport Code = "missing-export"
+	// MissingActivation means an import of a private export doesn't
+	// have an activation token
+	MissingActivation Code = "missing-activation"
+)
+
+// DefaultExpiryWindow is the window used to report entities that are
+// about to expire
+const DefaultExpiryWindow = 7 * 24 * time.Hour
+
+// Options configures the checks
+type Options struct {
+	// ExpiryWindow reports entities expiring within the window as Expiring,
+	// if not set DefaultExpiryWindow is used
+	ExpiryWindow time.Duration
+	// Now is the time expiries are checked against, if not set the current
+	// time is used
+	Now time.Time
+}
+
+// Finding is a problem found with an entity
+type Finding struct {
+	Severity Severity
+	Code     Code
+	// Kind is one of "operator", "account" or "user"
+	Kind string
+	// Path is the name of the entity qualified by its parents' names
+	Path string
+	// Subject is the public key of the entity
+	Subject string
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s %s %s (%s): %s", f.Severity, f.Kind, f.Path, f.Subject, f.Message)
+}
+
+// Report lists the findings of a validation
+type Report struct {
+	Findings []Finding
+}
+
+// Filter returns the findings with the specified severity or worse
+func (r *Report) Filter(min Severity) []Finding {
+	var findings []Finding
+	for _, f := range r.Findings {
+		if rank[f.Severity] >= rank[min] {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// HasErrors returns true if any finding is an Error
+func (r *Report) HasErrors() bool {
+	return len(r.Filter(Error)) > 0
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, f := range r.Findings {
+		b.WriteString(f.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Auth validates all the operators of the Auth
+func Auth(auth authb.Auth, opts Options) *Report {
+	var operators []*authb.OperatorData
+	for _, o := range auth.Operators().List() {
+		operators = append(operators, o.(*authb.OperatorData))
+	}
+	return Operators(operators, opts)
+}
+
+// Operators validates the operators, their accounts and users
+func Operators(operators []*authb.OperatorData, opts Options) *Report {
+	if opts.ExpiryWindow == 0 {
+		opts.ExpiryWindow = DefaultExpiryWindow
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	c := &checker{opts: opts, report: &Report{}}
+	for _, o := range operators {
+		c.operator(o)
+	}
+	return c.report
+}
+
+type checker struct {
+	opts   Options
+	report *Report
+}
+
+// entity identifies the entity findings are added for
+type entity struct {
+	kind    string
+	path    string
+	subject string
+}
+
+func (c *checker) add(e entity, s Severity, code Code, format string, args ...any) {
+	c.report.Findings = append(c.report.Findings, Finding{
+		Severity: s,
+		Code:     code,
+		Kind:     e.kind,
+		Path:     e.path,
+		Subject:  e.subject,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// claim checks the decoded token matches the subject and validates it.
+// Time checks are skipped, as expiry is reported by expiry.
+func (c *checker) claim(e entity, decoded jwt.Claims, err error) bool {
+	if err != nil {
+		c.add(e, Error, InvalidJwt, "JWT doesn't verify: %v", err)
+		return false
+	}
+	if decoded.Claims().Subject != e.subject {
+		c.add(e, Error, SubjectMismatch, "JWT is for %s", decoded.Claims().Subject)
+		return false
+	}
+	var vr jwt.ValidationResults
+	decoded.Validate(&vr)
+	for _, i := range vr.Issues {
+		if i.TimeCheck {
+			continue
+		}
+		s := Warning
+		if i.Blocking {
+			s = Error
+		}
+		c.add(e, s, InvalidClaim, "%s", i.Description)
+	}
+	return true
+}
+
+func (c *checker) expiry(e entity, cd *jwt.ClaimsData) {
+	exp := cd.Expires
+	if cd.NotBefore != 0 {
+		nbf := time.Unix(cd.NotBefore, 0)
+		if exp != 0 && cd.NotBefore > exp {
+			c.add(e, Error, InvalidValidity, "not before %s is later than the expiry", nbf.UTC().Format(time.RFC3339))
+			return
+		}
+		if nbf.After(c.opts.Now) {
+			c.add(e, Info, NotYetValid, "valid from %s", nbf.UTC().Format(time.RFC3339))
+		}
+	}
+	if exp == 0 {
+		return
+	}
+	t := time.Unix(exp, 0)
+	switch {
+	case !t.After(c.opts.Now):
+		c.add(e, Error, Expired, "expired on %s", t.UTC().Format(time.RFC3339))
+	case t.Before(c.opts.Now.Add(c.opts.ExpiryWindow)):
+		c.add(e, Warning, Expiring, "expires on %s", t.UTC().Format(time.RFC3339))
+	}
+}
+
+// issuer reports an issuer chain error from the checks shared with the
+// strict and quarantine load modes
+func (c *checker) issuer(e entity, err error) {
+	if err != nil {
+		c.add(e, Error, UntrustedIssuer, "%v", err)
+	}
+}
+
+func (c *checker) seed(e entity, k *authb.Key, pk string, what string) {
+	if !k.CanSign() {
+		c.add(e, Warning, MissingSeed, "no seed for %s %s", what, pk)
+	}
+}
+
+func (c *checker) operator(o *authb.OperatorData) {
+	e := entity{kind: "operator", path: o.Name(), subject: o.Subject()}
+	decoded, err := jwt.DecodeOperatorClaims(o.Token)
+	if c.claim(e, decoded, err) {
+		c.issuer(e, authb.VerifyOperatorIssuer(decoded))
+	}
+	c.expiry(e, &o.Claim.ClaimsData)
+
+	c.seed(e, o.Key, o.Subject(), "operator key")
+	keys := make(map[string]*authb.Key)
+	for _, k := range o.OperatorSigningKeys {
+		keys[k.Public] = k
+	}
+	for _, pk := range o.Claim.SigningKeys {
+		c.seed(e, keys[pk], pk, "signing key")
+	}
+
+	for _, a := range o.AccountDatas {
+		c.account(o, a)
+	}
+}
+
+func (c *checker) account(o *authb.OperatorData, a *authb.AccountData) {
+	e := entity{kind: "account", path: o.Name() + "/" + a.Name(), subject: a.Subject()}
+	decoded, err := jwt.DecodeAccountClaims(a.Token)
+	if c.claim(e, decoded, err) {
+		c.issuer(e, authb.VerifyAccountIssuer(o, decoded))
+	}
+	c.expiry(e, &a.Claim.ClaimsData)
+
+	c.seed(e, a.Key, a.Subject(), "account key")
+	keys := make(map[string]*authb.Key)
+	for _, k := range a.AccountSigningKeys {
+		keys[k.Public] = k
+	}
+	for _, pk := range a.Claim.SigningKeys.Keys() {
+		c.seed(e, keys[pk], pk, "signing key")
+	}
+
+	c.imports(e, o, a)
+	for _, u := range a.UserDatas {
+		c.user(e, a, u)
+	}
+}
+
+// imports checks the imports of the account match an export of the
+// account they import from
+func (c *checker) imports(e entity, o *authb.OperatorData, a *authb.AccountData) {
+	for _, i := range a.Claim.Imports {
+		var from *authb.AccountData
+		for _, v := range o.AccountDatas {
+			if v.Subject() == i.Account {
+				from = v
+				break
+			}
+		}
+		if from == nil {
+			c.add(e, Warning, UnknownAccount, "import %q is from account %s which is not in the store", i.Subject, i.Account)
+			continue
+		}
+		var export *jwt.Export
+		for _, x := range from.Claim.Exports {
+			if x.Type == i.Type && i.Subject.IsContainedIn(x.Subject) {
+				export = x
+				break
+			}
+		}
+		if export == nil {
+			c.add(e, Error, MissingExport, "import %q doesn't match a %s export of account %q", i.Subject, i.Type, from.Name())
+			continue
+		}
+		if export.TokenReq && i.Token == "" {
+			c.add(e, Error, MissingActivation, "import %q of private export %q has no activation token", i.Subject, export.Subject)
+		}
+	}
+}
+
+func (c *checker) user(ae entity, a *authb.AccountData, u *authb.UserData) {
+	e := entity{kind: "user", path: ae.path + "/" + u.Name(), subject: u.Subject()}
+	decoded, err := jwt.DecodeUserClaims(u.Token)
+	if c.claim(e, decoded, err) {
+		c.issuer(e, authb.VerifyUserIssuer(a, decoded))
+	}
+	c.expiry(e, &u.Claim.ClaimsData)
+	c.seed(e, u.Key, u.Subject(), "user key")
+}
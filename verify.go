@@ -0,0 +1,247 @@
+package authb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"strings"
+)
+
+// LoadMode controls how the entities read by the AuthProvider are verified
+type LoadMode int
+
+const (
+	// LoadTrusted loads the entities without verifying their issuer chain
+	LoadTrusted LoadMode = iota
+	// LoadStrict fails the load with a LoadError if any entity doesn't verify
+	LoadStrict
+	// LoadQuarantine removes the entities that don't verify, and the entities
+	// they manage, from the loaded tree. The removed entities are available
+	// from Quarantined(). Note that providers that rewrite the whole store on
+	// Commit, such as the MemProvider, drop quarantined entities.
+	LoadQuarantine
+)
+
+var (
+	// ErrInvalidJwt is returned when a JWT doesn't decode, or doesn't
+	// match the claim of the entity
+	ErrInvalidJwt = errors.New("invalid JWT")
+	// ErrUntrustedIssuer is returned when a JWT is not issued by the parent
+	// entity or one of its signing keys
+	ErrUntrustedIssuer = errors.New("untrusted issuer")
+	// ErrKeyMismatch is returned when a seed doesn't match its public key
+	ErrKeyMismatch = errors.New("key mismatch")
+)
+
+// AuthOption configures an Auth
+type AuthOption func(a *AuthImpl) error
+
+// WithLoadMode sets how entities are verified when the store is loaded
+func WithLoadMode(mode LoadMode) AuthOption {
+	return func(a *AuthImpl) error {
+		a.mode = mode
+		return nil
+	}
+}
+
+// VerifyError describes an entity that failed verification
+type VerifyError struct {
+	// Kind is one of "operator", "account" or "user"
+	Kind string
+	// Path is the name of the entity qualified by its parents' names
+	Path string
+	// Subject is the public key of the entity
+	Subject string
+	// Token is the JWT of the entity
+	Token string
+	Err   error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("%s %s (%s): %v", e.Kind, e.Path, e.Subject, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// LoadError is returned by a strict load, it lists all the entities that
+// failed verification
+type LoadError struct {
+	Errors []*VerifyError
+}
+
+func (e *LoadError) Error() string {
+	var msgs []string
+	for _, v := range e.Errors {
+		msgs = append(msgs, v.Error())
+	}
+	return fmt.Sprintf("%d entities failed verification: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *LoadError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, v := range e.Errors {
+		errs[i] = v
+	}
+	return errs
+}
+
+// verifyKey checks that the seed of the key matches the public key
+func verifyKey(k *Key, pk string) error {
+	if k == nil {
+		return nil
+	}
+	if k.Public != pk {
+		return fmt.Errorf("%w: key %s is not %s", ErrKeyMismatch, k.Public, pk)
+	}
+	if k.Seed == nil {
+		return nil
+	}
+	kp, err := nkeys.FromSeed(k.Seed)
+	if err != nil {
+		return fmt.Errorf("%w: seed for %s: %v", ErrKeyMismatch, pk, err)
+	}
+	if pub, err := kp.PublicKey(); err != nil || pub != pk {
+		return fmt.Errorf("%w: seed doesn't match %s", ErrKeyMismatch, pk)
+	}
+	return nil
+}
+
+// verifyToken checks that the token decodes and is the JWT of the claim
+func verifyToken(token string, id string) error {
+	c, err := jwt.Decode(token)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJwt, err)
+	}
+	if c.Claims().ID != id {
+		return fmt.Errorf("%w: JWT doesn't match the claim", ErrInvalidJwt)
+	}
+	return nil
+}
+
+// VerifyOperatorIssuer checks that the operator claim is self-signed.
+// The error wraps ErrUntrustedIssuer.
+func VerifyOperatorIssuer(oc *jwt.OperatorClaims) error {
+	if oc.Issuer != oc.Subject {
+		return fmt.Errorf("%w: operator is issued by %s", ErrUntrustedIssuer, oc.Issuer)
+	}
+	return nil
+}
+
+// VerifyAccountIssuer checks that the account claim is issued by the
+// operator or one of its signing keys, and that the operator key is not
+// used if the operator requires signing keys. The error wraps
+// ErrUntrustedIssuer.
+func VerifyAccountIssuer(o *OperatorData, ac *jwt.AccountClaims) error {
+	switch {
+	case ac.Issuer == o.Claim.Subject:
+		if o.Claim.StrictSigningKeyUsage {
+			return fmt.Errorf("%w: issued by the operator key, but the operator requires signing keys", ErrUntrustedIssuer)
+		}
+	case !o.Claim.SigningKeys.Contains(ac.Issuer):
+		return fmt.Errorf("%w: %s is not a key of operator %q", ErrUntrustedIssuer, ac.Issuer, o.EntityName)
+	}
+	return nil
+}
+
+// VerifyUserIssuer checks that the user claim is issued by the account or
+// one of its signing keys, and that users issued by a signing key name the
+// account as their issuer account. The error wraps ErrUntrustedIssuer.
+func VerifyUserIssuer(a *AccountData, uc *jwt.UserClaims) error {
+	switch {
+	case uc.Issuer == a.Claim.Subject:
+	case !a.Claim.SigningKeys.Contains(uc.Issuer):
+		return fmt.Errorf("%w: %s is not a key of account %q", ErrUntrustedIssuer, uc.Issuer, a.EntityName)
+	case uc.IssuerAccount != a.Claim.Subject:
+		return fmt.Errorf("%w: issued by a signing key, but the issuer account is %q", ErrUntrustedIssuer, uc.IssuerAccount)
+	}
+	return nil
+}
+
+func verifyOperator(o *OperatorData) error {
+	if err := verifyToken(o.Token, o.Claim.ID); err != nil {
+		return err
+	}
+	if err := VerifyOperatorIssuer(o.Claim); err != nil {
+		return err
+	}
+	if err := verifyKey(o.Key, o.Claim.Subject); err != nil {
+		return err
+	}
+	for _, k := range o.OperatorSigningKeys {
+		if !o.Claim.SigningKeys.Contains(k.Public) {
+			return fmt.Errorf("%w: %s is not a signing key of the operator", ErrKeyMismatch, k.Public)
+		}
+		if err := verifyKey(k, k.Public); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyAccount(a *AccountData) error {
+	if err := verifyToken(a.Token, a.Claim.ID); err != nil {
+		return err
+	}
+	if err := VerifyAccountIssuer(a.Operator, a.Claim); err != nil {
+		return err
+	}
+	if err := verifyKey(a.Key, a.Claim.Subject); err != nil {
+		return err
+	}
+	for _, k := range a.AccountSigningKeys {
+		if !a.Claim.SigningKeys.Contains(k.Public) {
+			return fmt.Errorf("%w: %s is not a signing key of the account", ErrKeyMismatch, k.Public)
+		}
+		if err := verifyKey(k, k.Public); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyUser(u *UserData) error {
+	if err := verifyToken(u.Token, u.Claim.ID); err != nil {
+		return err
+	}
+	if err := VerifyUserIssuer(u.AccountData, u.Claim); err != nil {
+		return err
+	}
+	return verifyKey(u.Key, u.Claim.Subject)
+}
+
+// verify checks the issuer chain and keys of the operator tree. When
+// quarantine is set, the entities that fail are removed from the tree.
+// The returned bool is false if the operator itself failed.
+func verify(o *OperatorData, quarantine bool) ([]*VerifyError, bool) {
+	if err := verifyOperator(o); err != nil {
+		return []*VerifyError{{Kind: "operator", Path: o.EntityName, Subject: o.Claim.Subject, Token: o.Token, Err: err}}, false
+	}
+	var errs []*VerifyError
+	var accounts []*AccountData
+	for _, a := range o.AccountDatas {
+		path := o.EntityName + "/" + a.EntityName
+		if err := verifyAccount(a); err != nil {
+			errs = append(errs, &VerifyError{Kind: "account", Path: path, Subject: a.Claim.Subject, Token: a.Token, Err: err})
+			continue
+		}
+		var users []*UserData
+		for _, u := range a.UserDatas {
+			if err := verifyUser(u); err != nil {
+				errs = append(errs, &VerifyError{Kind: "user", Path: path + "/" + u.EntityName, Subject: u.Claim.Subject, Token: u.Token, Err: err})
+				continue
+			}
+			users = append(users, u)
+		}
+		if quarantine {
+			a.UserDatas = users
+		}
+		accounts = append(accounts, a)
+	}
+	if quarantine {
+		o.AccountDatas = accounts
+	}
+	return errs, true
+}